@@ -5,12 +5,14 @@ import (
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/log"
 	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/tenant"
 )
 
 // cfgMongoDB config environmental variables.
 const cfgMongoDB = "MONGO_DB"
 
-// Mongo handles session management.
+// Mongo handles session management. When tenants are configured the session
+// is for the database of the tenant of the request.
 func Mongo(h app.Handler) app.Handler {
 
 	// Check if mongodb is configured.
@@ -22,9 +24,40 @@ func Mongo(h app.Handler) app.Handler {
 		}
 	}
 
+	// Check if the service is shared by tenants.
+	tenants, err := tenant.Load()
+	if err != nil {
+		return func(c *app.Context) error {
+			log.Error(c.SessionID, "Mongo", err, "Loading tenants")
+			return app.ErrDBNotConfigured
+		}
+	}
+
 	// Wrap the handlers inside a session copy/close.
 	return func(c *app.Context) error {
-		mgoDB, err := db.NewMGO("Mongo", dbName)
+		name := dbName
+
+		if tenants != nil {
+			claims, _ := c.Ctx["jwt"].(map[string]interface{})
+
+			tnt, tntDB, err := tenants.Resolve(c.Request, claims)
+			if err != nil {
+				log.Error(c.SessionID, "Mongo", err, "Resolving tenant from %s[%s]", tenants.From, tenants.Key)
+				switch err {
+				case tenant.ErrNotFound:
+					return app.ErrNotFound
+				case tenant.ErrDenied:
+					return app.ErrNotAuthorized
+				}
+				return app.ErrValidation
+			}
+
+			log.Dev(c.SessionID, "Mongo", "******> Tenant[%s] DB[%s]", tnt, tntDB)
+			c.Ctx["tenant"] = tnt
+			name = tntDB
+		}
+
+		mgoDB, err := db.NewMGO("Mongo", name)
 		if err != nil {
 			log.Error(c.SessionID, "Mongo", err, "Method[%s] URL[%s] RADDR[%s]", c.Request.Method, c.Request.URL.Path, c.Request.RemoteAddr)
 			return app.ErrDBNotConfigured
@@ -13,6 +13,7 @@ import (
 	"github.com/coralproject/shelf/cmd/askd/handlers"
 	"github.com/coralproject/shelf/cmd/askd/midware"
 	"github.com/coralproject/shelf/internal/ask/form/submission"
+	"github.com/coralproject/shelf/internal/tenant"
 )
 
 // Environmental variables.
@@ -26,11 +27,21 @@ const (
 	cfgRecaptchaSecret = "RECAPTCHA_SECRET"
 )
 
+// tenants holds the tenants sharing the service, if any.
+var tenants *tenant.Config
+
 func init() {
 	// Initialize the configuration and logging systems. Plus anything
 	// else the web app layer needs.
 	app.Init(cfg.EnvProvider{Namespace: "XENIA"})
 
+	// Initialize the tenants sharing the service.
+	var err error
+	if tenants, err = tenant.Load(); err != nil {
+		log.Error("startup", "Init", err, "Initializing tenants")
+		os.Exit(1)
+	}
+
 	// Initialize MongoDB.
 	if _, err := cfg.String(cfgMongoHost); err == nil {
 		cfg := mongo.Config{
@@ -49,6 +60,15 @@ func init() {
 			log.Error("startup", "Init", err, "Initializing MongoDB")
 			os.Exit(1)
 		}
+
+		// Each tenant sharing the service has a master session for its
+		// own database.
+		if tenants != nil {
+			if err := tenant.RegMasterSessions("startup", tenants, cfg); err != nil {
+				log.Error("startup", "Init", err, "Initializing tenants")
+				os.Exit(1)
+			}
+		}
 	}
 }
 
@@ -78,7 +98,8 @@ func API() http.Handler {
 		}
 	*/
 
-	a := app.New(midware.Mongo, midware.Auth)
+	// Authentication happens first so the claims can name the tenant.
+	a := app.New(midware.Auth, midware.Mongo)
 	//		a.Ctx["anvil"] = anv
 
 	// Load in the recaptcha secret from the config.
@@ -97,6 +118,11 @@ func API() http.Handler {
 	log.Dev("startup", "Init", "Initalizing CORS")
 	a.CORS()
 
+	// Tenants can be named by a prefix of the path.
+	if tenants != nil && tenants.From == tenant.FromPath {
+		return tenant.StripPrefix(tenants, a)
+	}
+
 	return a
 }
 
@@ -175,6 +201,27 @@ func ensureDBIndexes() error {
 		return nil
 	}
 
+	// The database of each tenant needs the indexes as well.
+	dbNames := []string{dbName}
+	if tenants != nil {
+		for _, tntDB := range tenants.DBs {
+			if tntDB != dbName {
+				dbNames = append(dbNames, tntDB)
+			}
+		}
+	}
+
+	for _, name := range dbNames {
+		if err := ensureIndexes(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureIndexes makes sure the indexes exist in the specified database.
+func ensureIndexes(dbName string) error {
 	mgoDB, err := db.NewMGO("startup", dbName)
 	if err != nil {
 		return err
@@ -13,6 +13,7 @@ import (
 	"github.com/ardanlabs/kit/web/app"
 	"github.com/coralproject/shelf/cmd/sponged/handlers"
 	"github.com/coralproject/shelf/cmd/sponged/midware"
+	"github.com/coralproject/shelf/internal/tenant"
 )
 
 // Environmental variables.
@@ -25,11 +26,21 @@ const (
 	cfgAnvilHost     = "ANVIL_HOST"
 )
 
+// tenants holds the tenants sharing the service, if any.
+var tenants *tenant.Config
+
 func init() {
 	// Initialize the configuration and logging systems. Plus anything
 	// else the web app layer needs.
 	app.Init(cfg.EnvProvider{Namespace: "XENIA"})
 
+	// Initialize the tenants sharing the service.
+	var err error
+	if tenants, err = tenant.Load(); err != nil {
+		log.Error("startup", "Init", err, "Initializing tenants")
+		os.Exit(1)
+	}
+
 	// Initialize MongoDB.
 	if _, err := cfg.String(cfgMongoHost); err == nil {
 		cfg := mongo.Config{
@@ -48,6 +59,15 @@ func init() {
 			log.Error("startup", "Init", err, "Initializing MongoDB")
 			os.Exit(1)
 		}
+
+		// Each tenant sharing the service has a master session for its
+		// own database.
+		if tenants != nil {
+			if err := tenant.RegMasterSessions("startup", tenants, cfg); err != nil {
+				log.Error("startup", "Init", err, "Initializing tenants")
+				os.Exit(1)
+			}
+		}
 	}
 }
 
@@ -68,7 +88,8 @@ func API() http.Handler {
 		}
 	}
 
-	a := app.New(midware.Mongo, midware.Auth)
+	// Authentication happens first so the claims can name the tenant.
+	a := app.New(midware.Auth, midware.Mongo)
 	a.Ctx["anvil"] = anv
 
 	log.Dev("startup", "Init", "Initalizing routes")
@@ -77,6 +98,11 @@ func API() http.Handler {
 	log.Dev("startup", "Init", "Initalizing CORS")
 	a.CORS()
 
+	// Tenants can be named by a prefix of the path.
+	if tenants != nil && tenants.From == tenant.FromPath {
+		return tenant.StripPrefix(tenants, a)
+	}
+
 	return a
 }
 
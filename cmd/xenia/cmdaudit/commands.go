@@ -0,0 +1,15 @@
+package cmdaudit
+
+import "github.com/spf13/cobra"
+
+// auditCmd represents the parent for all audit cli commands.
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "audit provides a xenia CLI for querying the audit log of executed sets.",
+}
+
+// GetCommands returns the audit commands.
+func GetCommands() *cobra.Command {
+	addList()
+	return auditCmd
+}
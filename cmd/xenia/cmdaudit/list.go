@@ -0,0 +1,90 @@
+package cmdaudit
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/coralproject/shelf/cmd/xenia/web"
+	"github.com/spf13/cobra"
+)
+
+var listLong = `Retrieves the records of the audit log, newest first.
+The records can be narrowed by set, subject, session and time.
+Times are provided in RFC3339 format. Only admins may read the records
+of every subject, other callers only get their own records.
+
+Example:
+	audit list
+
+	audit list -n set_name -u user1 -l 10
+
+	audit list -f 2016-01-02T15:04:05Z -t 2016-01-03T15:04:05Z
+`
+
+// list contains the state for this command.
+var list struct {
+	set     string
+	subject string
+	session string
+	from    string
+	to      string
+	limit   int
+}
+
+// addList handles the retrival of the audit records.
+func addList() {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Retrieves the records of the audit log.",
+		Long:  listLong,
+		Run:   runList,
+	}
+
+	cmd.Flags().StringVarP(&list.set, "name", "n", "", "Name of the Set executed.")
+	cmd.Flags().StringVarP(&list.subject, "subject", "u", "", "Subject of the caller.")
+	cmd.Flags().StringVarP(&list.session, "session", "s", "", "Session of the request.")
+	cmd.Flags().StringVarP(&list.from, "from", "f", "", "Oldest execution to retrieve.")
+	cmd.Flags().StringVarP(&list.to, "to", "t", "", "Newest execution to retrieve.")
+	cmd.Flags().IntVarP(&list.limit, "limit", "l", 0, "Most records to retrieve.")
+
+	auditCmd.AddCommand(cmd)
+}
+
+// runList issues the command talking to the web service.
+func runList(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/audit"
+
+	if q := listQuery(); q != "" {
+		url += "?" + q
+	}
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		if serr, ok := err.(*web.StatusError); ok && serr.Status == http.StatusForbidden {
+			cmd.Println("Getting Audit List : Only admins may read the records of other subjects")
+			return
+		}
+		cmd.Println("Getting Audit List : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// listQuery returns the query string for filtering the audit records.
+func listQuery() string {
+	q := url.Values{}
+
+	for name, v := range map[string]string{"set": list.set, "subject": list.subject, "session": list.session, "from": list.from, "to": list.to} {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+
+	if list.limit > 0 {
+		q.Set("limit", strconv.Itoa(list.limit))
+	}
+
+	return q.Encode()
+}
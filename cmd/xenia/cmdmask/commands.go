@@ -11,7 +11,9 @@ var maskCmd = &cobra.Command{
 // GetCommands returns the mask commands.
 func GetCommands() *cobra.Command {
 	addUpsert()
+	addList()
 	addGet()
 	addDel()
+	addHistory()
 	return maskCmd
 }
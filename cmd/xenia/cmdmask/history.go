@@ -0,0 +1,118 @@
+package cmdmask
+
+import (
+	"strconv"
+
+	"github.com/coralproject/shelf/cmd/xenia/web"
+	"github.com/spf13/cobra"
+)
+
+var historyLong = `Lists every version of a Mask kept in the history with the time it
+was saved. The first version ever saved is version 1.
+
+Example:
+	mask history -c collection -f field
+`
+
+var diffLong = `Shows the changes between two versions of a Mask from the history.
+
+Example:
+	mask diff -c collection -f field --from 1 --to 3
+`
+
+var restoreLong = `Restores a version of a Mask from the history as the current version.
+The restore is added to the history as a new version so it can be undone.
+
+Example:
+	mask restore -c collection -f field -v 2
+`
+
+// hist contains the state for the history commands.
+var hist struct {
+	collection string
+	field      string
+	from       int
+	to         int
+	version    int
+}
+
+// addHistory handles the history, diff and restore of Mask records.
+func addHistory() {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Lists the versions of a Mask in the history.",
+		Long:  historyLong,
+		Run:   runHistory,
+	}
+
+	cmd.Flags().StringVarP(&hist.collection, "collection", "c", "", "Name of the Collection.")
+	cmd.Flags().StringVarP(&hist.field, "field", "f", "", "Name of the Field.")
+
+	maskCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Shows the changes between two versions of a Mask.",
+		Long:  diffLong,
+		Run:   runDiff,
+	}
+
+	cmd.Flags().StringVarP(&hist.collection, "collection", "c", "", "Name of the Collection.")
+	cmd.Flags().StringVarP(&hist.field, "field", "f", "", "Name of the Field.")
+	cmd.Flags().IntVarP(&hist.from, "from", "", 0, "Version to compare from.")
+	cmd.Flags().IntVarP(&hist.to, "to", "", 0, "Version to compare to.")
+
+	maskCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restores a version of a Mask as the current version.",
+		Long:  restoreLong,
+		Run:   runRestore,
+	}
+
+	cmd.Flags().StringVarP(&hist.collection, "collection", "c", "", "Name of the Collection.")
+	cmd.Flags().StringVarP(&hist.field, "field", "f", "", "Name of the Field.")
+	cmd.Flags().IntVarP(&hist.version, "version", "v", 0, "Version to restore.")
+
+	maskCmd.AddCommand(cmd)
+}
+
+// runHistory issues the history command talking to the web service.
+func runHistory(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/mask/" + hist.collection + "/" + hist.field + "/history"
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Getting Mask History : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runDiff issues the diff command talking to the web service.
+func runDiff(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/mask/" + hist.collection + "/" + hist.field + "/diff/" + strconv.Itoa(hist.from) + "/" + strconv.Itoa(hist.to)
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Diffing Mask : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runRestore issues the restore command talking to the web service.
+func runRestore(cmd *cobra.Command, args []string) {
+	verb := "PUT"
+	url := "/1.0/mask/" + hist.collection + "/" + hist.field + "/restore/" + strconv.Itoa(hist.version)
+
+	if _, err := web.Request(cmd, verb, url, nil); err != nil {
+		cmd.Println("Restoring Mask : ", err)
+		return
+	}
+
+	cmd.Println("\n", "Restoring Mask : Restored")
+}
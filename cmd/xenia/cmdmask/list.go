@@ -0,0 +1,58 @@
+package cmdmask
+
+import (
+	"net/url"
+
+	"github.com/coralproject/shelf/cmd/xenia/web"
+	"github.com/spf13/cobra"
+)
+
+var listLong = `Retrieves a list of all available Masks.
+The list can be narrowed to the Masks with all of the supplied tags.
+
+Example:
+	mask list
+
+	mask list -t orders -t reporting
+`
+
+// list contains the state for this command.
+var list struct {
+	tags []string
+}
+
+// addList handles the retrival Mask records names.
+func addList() {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Retrieves a list of all available Masks.",
+		Long:  listLong,
+		Run:   runList,
+	}
+
+	cmd.Flags().StringSliceVarP(&list.tags, "tag", "t", nil, "Tag the Masks must have.")
+
+	maskCmd.AddCommand(cmd)
+}
+
+// runList issues the command talking to the web service.
+func runList(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/mask"
+
+	if len(list.tags) > 0 {
+		url += "?" + tagsQuery(list.tags)
+	}
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Getting Mask List : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// tagsQuery returns the query string for filtering the list by tags.
+func tagsQuery(tags []string) string {
+	return url.Values{"tag": tags}.Encode()
+}
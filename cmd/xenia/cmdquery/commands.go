@@ -16,5 +16,6 @@ func GetCommands() *cobra.Command {
 	addExec()
 	addList()
 	addIndex()
+	addHistory()
 	return queryCmd
 }
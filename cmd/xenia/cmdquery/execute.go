@@ -1,6 +1,8 @@
 package cmdquery
 
 import (
+	"net/url"
+	"os"
 	"strings"
 
 	"github.com/coralproject/shelf/cmd/xenia/web"
@@ -13,12 +15,28 @@ Example:
 	query exec -n "user_advice"
 
 	query exec -n "my_set" -v "key:value,key:value"
+
+	query exec -n "my_set" -v "key:value,key:[value,value]"
+
+	query exec -n "my_set" -f csv > my_set.csv
+
+	query exec -n "my_set" -v "key:value" --dry-run
 `
 
+// formats maps the supported output formats to their media type.
+var formats = map[string]string{
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+	"csv":    "text/csv",
+	"xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
 // exe contains the state for this command.
 var exe struct {
-	name string
-	vars string
+	name   string
+	vars   string
+	format string
+	dryRun bool
 }
 
 // addExec handles the execution of queries.
@@ -32,49 +50,101 @@ func addExec() {
 
 	cmd.Flags().StringVarP(&exe.name, "name", "n", "", "Name of Set.")
 	cmd.Flags().StringVarP(&exe.vars, "vars", "v", "", "Variables required by Set.")
+	cmd.Flags().StringVarP(&exe.format, "format", "f", "json", "Output format: json, ndjson, csv or xlsx.")
+	cmd.Flags().BoolVarP(&exe.dryRun, "dry-run", "", false, "Show the final commands of each query without executing them.")
 
 	queryCmd.AddCommand(cmd)
 }
 
-// runExec is the code that implements the execute command.
-func runExec(cmd *cobra.Command, args []string) {
-	vars := make(map[string]string)
-	if exe.vars != "" {
-		vs := strings.Split(exe.vars, ",")
-		for _, kvs := range vs {
-			kv := strings.Split(kvs, ":")
-			if len(kv) != 2 {
-				continue
+// parseVars parses the variables provided as key:value pairs separated by
+// commas. A list of values is provided in brackets as key:[value,value] and
+// is sent as a repeated parameter.
+func parseVars(s string) url.Values {
+	vars := make(url.Values)
+	if s == "" {
+		return vars
+	}
+
+	// Split the pairs on the commas that are not within a list.
+	var pairs []string
+	var list bool
+	var start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			list = true
+		case ']':
+			list = false
+		case ',':
+			if !list {
+				pairs = append(pairs, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	pairs = append(pairs, s[start:])
+
+	for _, kvs := range pairs {
+		kv := strings.SplitN(kvs, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		// Is this a list of values.
+		if v := kv[1]; len(v) > 1 && v[0] == '[' && v[len(v)-1] == ']' {
+			for _, item := range strings.Split(v[1:len(v)-1], ",") {
+				vars.Add(kv[0], item)
 			}
-			vars[kv[0]] = kv[1]
+			continue
 		}
+
+		vars.Set(kv[0], kv[1])
+	}
+
+	return vars
+}
+
+// runExec is the code that implements the execute command.
+func runExec(cmd *cobra.Command, args []string) {
+	if _, exists := formats[exe.format]; !exists {
+		cmd.Println("Executing Set : Invalid format", exe.format)
+		return
+	}
+
+	// The final commands are only returned as JSON.
+	if exe.dryRun && exe.format != "json" {
+		cmd.Println("Executing Set : Dry run only supports the json format")
+		return
+	}
+
+	vars := parseVars(exe.vars)
+	if exe.dryRun {
+		vars.Set("dry_run", "true")
 	}
 
 	runExecWeb(cmd, vars)
 }
 
 // runExecWeb issues the command talking to the web service.
-func runExecWeb(cmd *cobra.Command, vars map[string]string) {
+func runExecWeb(cmd *cobra.Command, vars url.Values) {
 	verb := "GET"
 	url := "/1.0/exec/" + exe.name
 
 	if len(vars) > 0 {
-		var i int
-		for k, v := range vars {
-			if i == 0 {
-				url += "?"
-			} else {
-				url += "&"
-			}
-			i++
-
-			url += k + "=" + v
-		}
+		url += "?" + vars.Encode()
 	}
 
-	resp, err := web.Request(cmd, verb, url, nil)
+	resp, err := web.RequestAccept(cmd, verb, url, nil, formats[exe.format])
 	if err != nil {
-		cmd.Println("Getting Set List : ", err)
+		cmd.Println("Executing Set : ", err)
+		return
+	}
+
+	// Anything other than JSON is written as is so it can be redirected
+	// into a file.
+	if exe.format != "json" {
+		os.Stdout.WriteString(resp)
+		return
 	}
 
 	cmd.Printf("\n%s\n\n", resp)
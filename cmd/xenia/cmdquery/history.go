@@ -0,0 +1,114 @@
+package cmdquery
+
+import (
+	"strconv"
+
+	"github.com/coralproject/shelf/cmd/xenia/web"
+	"github.com/spf13/cobra"
+)
+
+var historyLong = `Lists every version of a Set kept in the history with the time it
+was saved. The first version ever saved is version 1.
+
+Example:
+	query history -n user_advice
+`
+
+var diffLong = `Shows the changes between two versions of a Set from the history.
+
+Example:
+	query diff -n user_advice --from 1 --to 3
+`
+
+var restoreLong = `Restores a version of a Set from the history as the current version.
+The restore is added to the history as a new version so it can be undone.
+
+Example:
+	query restore -n user_advice -v 2
+`
+
+// hist contains the state for the history commands.
+var hist struct {
+	name    string
+	from    int
+	to      int
+	version int
+}
+
+// addHistory handles the history, diff and restore of Set records.
+func addHistory() {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Lists the versions of a Set in the history.",
+		Long:  historyLong,
+		Run:   runHistory,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Set.")
+
+	queryCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Shows the changes between two versions of a Set.",
+		Long:  diffLong,
+		Run:   runDiff,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Set.")
+	cmd.Flags().IntVarP(&hist.from, "from", "", 0, "Version to compare from.")
+	cmd.Flags().IntVarP(&hist.to, "to", "", 0, "Version to compare to.")
+
+	queryCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restores a version of a Set as the current version.",
+		Long:  restoreLong,
+		Run:   runRestore,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Set.")
+	cmd.Flags().IntVarP(&hist.version, "version", "v", 0, "Version to restore.")
+
+	queryCmd.AddCommand(cmd)
+}
+
+// runHistory issues the history command talking to the web service.
+func runHistory(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/query/" + hist.name + "/history"
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Getting Set History : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runDiff issues the diff command talking to the web service.
+func runDiff(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/query/" + hist.name + "/diff/" + strconv.Itoa(hist.from) + "/" + strconv.Itoa(hist.to)
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Diffing Set : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runRestore issues the restore command talking to the web service.
+func runRestore(cmd *cobra.Command, args []string) {
+	verb := "PUT"
+	url := "/1.0/query/" + hist.name + "/restore/" + strconv.Itoa(hist.version)
+
+	if _, err := web.Request(cmd, verb, url, nil); err != nil {
+		cmd.Println("Restoring Set : ", err)
+		return
+	}
+
+	cmd.Println("\n", "Restoring Set : Restored")
+}
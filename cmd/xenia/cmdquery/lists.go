@@ -1,16 +1,26 @@
 package cmdquery
 
 import (
+	"net/url"
+
 	"github.com/coralproject/shelf/cmd/xenia/web"
 	"github.com/spf13/cobra"
 )
 
 var listLong = `Retrieves a list of all available Set names.
+The list can be narrowed to the Sets with all of the supplied tags.
 
 Example:
 	query list
+
+	query list -t orders -t reporting
 `
 
+// list contains the state for this command.
+var list struct {
+	tags []string
+}
+
 // addList handles the retrival Set records names.
 func addList() {
 	cmd := &cobra.Command{
@@ -19,6 +29,9 @@ func addList() {
 		Long:  listLong,
 		Run:   runList,
 	}
+
+	cmd.Flags().StringSliceVarP(&list.tags, "tag", "t", nil, "Tag the Sets must have.")
+
 	queryCmd.AddCommand(cmd)
 }
 
@@ -27,6 +40,10 @@ func runList(cmd *cobra.Command, args []string) {
 	verb := "GET"
 	url := "/1.0/query"
 
+	if len(list.tags) > 0 {
+		url += "?" + tagsQuery(list.tags)
+	}
+
 	resp, err := web.Request(cmd, verb, url, nil)
 	if err != nil {
 		cmd.Println("Getting Set List : ", err)
@@ -34,3 +51,8 @@ func runList(cmd *cobra.Command, args []string) {
 
 	cmd.Printf("\n%s\n\n", resp)
 }
+
+// tagsQuery returns the query string for filtering the list by tags.
+func tagsQuery(tags []string) string {
+	return url.Values{"tag": tags}.Encode()
+}
@@ -3,6 +3,7 @@ package cmdquery
 import (
 	"bytes"
 	"encoding/json"
+	"net/http"
 	"os"
 	"path/filepath"
 
@@ -13,17 +14,21 @@ import (
 )
 
 var upsertLong = `Use upsert to add or update a Set in the system.
-Adding can be done per file or per directory.
+Adding can be done per file or per directory. Every reference in a Set, like
+the regexes of its parameters, its scripts, its variables and the results read
+with #data, is resolved before it is stored and all problems are reported. The
+no-check flag stores the Set without resolving its references.
 
 Example:
 	query upsert -p user_advice.json
 
-	query upsert -p ./sets
+	query upsert --no-check -p ./sets
 `
 
 // upsert contains the state for this command.
 var upsert struct {
-	path string
+	path    string
+	noCheck bool
 }
 
 // addUpsert handles the add or update of Set records into the db.
@@ -36,6 +41,7 @@ func addUpsert() {
 	}
 
 	cmd.Flags().StringVarP(&upsert.path, "path", "p", "", "Path of Set file or directory.")
+	cmd.Flags().BoolVar(&upsert.noCheck, "no-check", false, "Store the Set without resolving its references.")
 
 	queryCmd.AddCommand(cmd)
 }
@@ -98,6 +104,9 @@ func runUpsert(cmd *cobra.Command, args []string) {
 func runUpsertWeb(cmd *cobra.Command, set *query.Set) error {
 	verb := "PUT"
 	url := "/1.0/query"
+	if upsert.noCheck {
+		url += "?check=false"
+	}
 
 	data, err := json.Marshal(set)
 	if err != nil {
@@ -107,8 +116,31 @@ func runUpsertWeb(cmd *cobra.Command, set *query.Set) error {
 	cmd.Printf("\n%s\n\n", string(data))
 
 	if _, err := web.Request(cmd, verb, url, bytes.NewBuffer(data)); err != nil {
+		printProblems(cmd, set, err)
 		return err
 	}
 
 	return nil
 }
+
+// printProblems displays each problem the web service found with the set,
+// like references to regexes or scripts that don't exist.
+func printProblems(cmd *cobra.Command, set *query.Set, err error) {
+	serr, ok := err.(*web.StatusError)
+	if !ok || serr.Status != http.StatusBadRequest {
+		return
+	}
+
+	var resp struct {
+		Fields []query.Problem `json:"fields"`
+	}
+
+	if err := json.Unmarshal([]byte(serr.Body), &resp); err != nil || len(resp.Fields) == 0 {
+		return
+	}
+
+	cmd.Printf("Set %q has %d problem(s) :\n", set.Name, len(resp.Fields))
+	for _, p := range resp.Fields {
+		cmd.Printf("\t%s : %s\n", p.Field, p.Err)
+	}
+}
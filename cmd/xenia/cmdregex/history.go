@@ -0,0 +1,114 @@
+package cmdregex
+
+import (
+	"strconv"
+
+	"github.com/coralproject/shelf/cmd/xenia/web"
+	"github.com/spf13/cobra"
+)
+
+var historyLong = `Lists every version of a Regex kept in the history with the time it
+was saved. The first version ever saved is version 1.
+
+Example:
+	regex history -n email
+`
+
+var diffLong = `Shows the changes between two versions of a Regex from the history.
+
+Example:
+	regex diff -n email --from 1 --to 3
+`
+
+var restoreLong = `Restores a version of a Regex from the history as the current version.
+The restore is added to the history as a new version so it can be undone.
+
+Example:
+	regex restore -n email -v 2
+`
+
+// hist contains the state for the history commands.
+var hist struct {
+	name    string
+	from    int
+	to      int
+	version int
+}
+
+// addHistory handles the history, diff and restore of Regex records.
+func addHistory() {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Lists the versions of a Regex in the history.",
+		Long:  historyLong,
+		Run:   runHistory,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Regex.")
+
+	regexCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Shows the changes between two versions of a Regex.",
+		Long:  diffLong,
+		Run:   runDiff,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Regex.")
+	cmd.Flags().IntVarP(&hist.from, "from", "", 0, "Version to compare from.")
+	cmd.Flags().IntVarP(&hist.to, "to", "", 0, "Version to compare to.")
+
+	regexCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restores a version of a Regex as the current version.",
+		Long:  restoreLong,
+		Run:   runRestore,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Regex.")
+	cmd.Flags().IntVarP(&hist.version, "version", "v", 0, "Version to restore.")
+
+	regexCmd.AddCommand(cmd)
+}
+
+// runHistory issues the history command talking to the web service.
+func runHistory(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/regex/" + hist.name + "/history"
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Getting Regex History : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runDiff issues the diff command talking to the web service.
+func runDiff(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/regex/" + hist.name + "/diff/" + strconv.Itoa(hist.from) + "/" + strconv.Itoa(hist.to)
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Diffing Regex : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runRestore issues the restore command talking to the web service.
+func runRestore(cmd *cobra.Command, args []string) {
+	verb := "PUT"
+	url := "/1.0/regex/" + hist.name + "/restore/" + strconv.Itoa(hist.version)
+
+	if _, err := web.Request(cmd, verb, url, nil); err != nil {
+		cmd.Println("Restoring Regex : ", err)
+		return
+	}
+
+	cmd.Println("\n", "Restoring Regex : Restored")
+}
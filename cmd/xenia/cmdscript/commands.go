@@ -14,5 +14,6 @@ func GetCommands() *cobra.Command {
 	addGet()
 	addDel()
 	addList()
+	addHistory()
 	return scriptCmd
 }
@@ -0,0 +1,114 @@
+package cmdscript
+
+import (
+	"strconv"
+
+	"github.com/coralproject/shelf/cmd/xenia/web"
+	"github.com/spf13/cobra"
+)
+
+var historyLong = `Lists every version of a Script kept in the history with the time it
+was saved. The first version ever saved is version 1.
+
+Example:
+	script history -n basic_script_pre
+`
+
+var diffLong = `Shows the changes between two versions of a Script from the history.
+
+Example:
+	script diff -n basic_script_pre --from 1 --to 3
+`
+
+var restoreLong = `Restores a version of a Script from the history as the current version.
+The restore is added to the history as a new version so it can be undone.
+
+Example:
+	script restore -n basic_script_pre -v 2
+`
+
+// hist contains the state for the history commands.
+var hist struct {
+	name    string
+	from    int
+	to      int
+	version int
+}
+
+// addHistory handles the history, diff and restore of Script records.
+func addHistory() {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Lists the versions of a Script in the history.",
+		Long:  historyLong,
+		Run:   runHistory,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Script.")
+
+	scriptCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Shows the changes between two versions of a Script.",
+		Long:  diffLong,
+		Run:   runDiff,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Script.")
+	cmd.Flags().IntVarP(&hist.from, "from", "", 0, "Version to compare from.")
+	cmd.Flags().IntVarP(&hist.to, "to", "", 0, "Version to compare to.")
+
+	scriptCmd.AddCommand(cmd)
+
+	cmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restores a version of a Script as the current version.",
+		Long:  restoreLong,
+		Run:   runRestore,
+	}
+
+	cmd.Flags().StringVarP(&hist.name, "name", "n", "", "Name of the Script.")
+	cmd.Flags().IntVarP(&hist.version, "version", "v", 0, "Version to restore.")
+
+	scriptCmd.AddCommand(cmd)
+}
+
+// runHistory issues the history command talking to the web service.
+func runHistory(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/script/" + hist.name + "/history"
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Getting Script History : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runDiff issues the diff command talking to the web service.
+func runDiff(cmd *cobra.Command, args []string) {
+	verb := "GET"
+	url := "/1.0/script/" + hist.name + "/diff/" + strconv.Itoa(hist.from) + "/" + strconv.Itoa(hist.to)
+
+	resp, err := web.Request(cmd, verb, url, nil)
+	if err != nil {
+		cmd.Println("Diffing Script : ", err)
+	}
+
+	cmd.Printf("\n%s\n\n", resp)
+}
+
+// runRestore issues the restore command talking to the web service.
+func runRestore(cmd *cobra.Command, args []string) {
+	verb := "PUT"
+	url := "/1.0/script/" + hist.name + "/restore/" + strconv.Itoa(hist.version)
+
+	if _, err := web.Request(cmd, verb, url, nil); err != nil {
+		cmd.Println("Restoring Script : ", err)
+		return
+	}
+
+	cmd.Println("\n", "Restoring Script : Restored")
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/db/mongo"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/cmd/xenia/cmdaudit"
 	"github.com/coralproject/shelf/cmd/xenia/cmddb"
 	"github.com/coralproject/shelf/cmd/xenia/cmdmask"
 	"github.com/coralproject/shelf/cmd/xenia/cmdpattern"
@@ -88,6 +89,7 @@ func main() {
 		cmdrelationship.GetCommands(),
 		cmdview.GetCommands(),
 		cmdpattern.GetCommands(),
+		cmdaudit.GetCommands(),
 	)
 	xenia.Execute()
 }
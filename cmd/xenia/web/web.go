@@ -15,9 +15,28 @@ const (
 	cfgAuth = "WEB_AUTH"
 )
 
+// StatusError is returned when the web service responds with a status that
+// is not a success. The body of the response is kept since it can describe
+// why the request failed.
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+// Error implements the error interface.
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("Status : %d", se.Status)
+}
+
 // Request provides support for executing commands against the
 // web service.
 func Request(cmd *cobra.Command, verb string, url string, post io.Reader) (string, error) {
+	return RequestAccept(cmd, verb, url, post, "")
+}
+
+// RequestAccept provides support for executing commands against the
+// web service asking for the response in the specified media type.
+func RequestAccept(cmd *cobra.Command, verb string, url string, post io.Reader, accept string) (string, error) {
 	host, err := cfg.String(cfgHost)
 	if err != nil {
 		return "", err
@@ -31,6 +50,10 @@ func Request(cmd *cobra.Command, verb string, url string, post io.Reader) (strin
 		return "", err
 	}
 
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
 	auth, err := cfg.String(cfgAuth)
 	if err == nil {
 		cmd.Println("Using Authentication")
@@ -42,10 +65,6 @@ func Request(cmd *cobra.Command, verb string, url string, post io.Reader) (strin
 		return "", err
 	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return "", fmt.Errorf("Status : %d", resp.StatusCode)
-	}
-
 	defer resp.Body.Close()
 
 	contents, err := ioutil.ReadAll(resp.Body)
@@ -53,5 +72,9 @@ func Request(cmd *cobra.Command, verb string, url string, post io.Reader) (strin
 		return "", err
 	}
 
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return "", &StatusError{Status: resp.StatusCode, Body: string(contents)}
+	}
+
 	return string(contents), nil
 }
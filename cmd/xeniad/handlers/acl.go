@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/mask"
+	"github.com/coralproject/shelf/internal/xenia/policy"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/internal/xenia/regex"
+	"github.com/coralproject/shelf/internal/xenia/script"
+)
+
+// callerOf returns the caller of the request as described by the claims of
+// its JWT. A nil Caller is returned when authentication is off.
+func callerOf(c *app.Context) *acl.Caller {
+	claims, _ := c.Ctx["jwt"].(map[string]interface{})
+	return acl.FromClaims(claims)
+}
+
+// execContext returns the context for executing sets on behalf of the
+// caller, so the sets they include are checked against the caller too.
+func execContext(c *app.Context) context.Context {
+	return acl.NewContext(c.Request.Context(), callerOf(c))
+}
+
+// respondForbidden responds that the ACL of the document does not allow
+// the caller to make the request.
+func respondForbidden(c *app.Context) error {
+	c.RespondError("Not allowed", http.StatusForbidden)
+	return nil
+}
+
+//==============================================================================
+
+// customExecute lists who besides the admins may run custom sets.
+var customExecute []string
+
+// UseCustomExecute sets the ACL entries, like "role:analyst", naming who
+// besides the admins may run custom sets. Without entries only the admins
+// may. This should be called during initialization.
+func UseCustomExecute(entries []string) {
+	customExecute = entries
+}
+
+// canRunCustom reports if the caller may run a custom set. The ACL of a
+// custom set is provided by the caller so it can't restrict them.
+func canRunCustom(caller *acl.Caller) bool {
+	if caller == nil || caller.IsAdmin() {
+		return true
+	}
+
+	if len(customExecute) == 0 {
+		return false
+	}
+
+	custom := acl.ACL{Execute: customExecute, Edit: []string{acl.KindRole + acl.RoleAdmin}}
+	return custom.CanExecute(caller)
+}
+
+//==============================================================================
+
+// canEditSet reports if the caller may edit the named Set. A Set that does
+// not exist yet can be created by every caller.
+func canEditSet(c *app.Context, db *db.DB, name string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	set, err := query.GetByName(c.SessionID, db, name)
+	if err != nil {
+		if err == query.ErrNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return set.ACL.CanEdit(caller), nil
+}
+
+// canEditScript reports if the caller may edit the named Script. A Script
+// that does not exist yet can be created by every caller.
+func canEditScript(c *app.Context, db *db.DB, name string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	scr, err := script.GetByName(c.SessionID, db, name)
+	if err != nil {
+		if err == script.ErrNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return scr.ACL.CanEdit(caller), nil
+}
+
+// canEditRegex reports if the caller may edit the named Regex. A Regex that
+// does not exist yet can be created by every caller.
+func canEditRegex(c *app.Context, db *db.DB, name string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	rgx, err := regex.GetByName(c.SessionID, db, name)
+	if err != nil {
+		if err == regex.ErrNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return rgx.ACL.CanEdit(caller), nil
+}
+
+// canEditMask reports if the caller may edit the mask of the field. A mask
+// that does not exist yet can be created by every caller.
+func canEditMask(c *app.Context, db *db.DB, collection string, field string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	msk, err := mask.GetByName(c.SessionID, db, collection, field)
+	if err != nil {
+		if err == mask.ErrNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return msk.ACL.CanEdit(caller), nil
+}
+
+// canEditPolicy reports if the caller may edit the policy of the role. Only
+// admins may create, update or delete policies since they restrict what
+// every caller sees. An existing policy with an ACL must also name the admin.
+func canEditPolicy(c *app.Context, db *db.DB, collection string, role string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	if !caller.IsAdmin() {
+		return false, nil
+	}
+
+	p, err := policy.GetByName(c.SessionID, db, collection, role)
+	if err != nil {
+		if err == policy.ErrNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return p.ACL.CanEdit(caller), nil
+}
+
+// canReadSetHistory reports if the caller may read the versions of the named
+// Set. Only its editors may, and only the admins once the Set is deleted.
+func canReadSetHistory(c *app.Context, db *db.DB, name string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	set, err := query.GetByName(c.SessionID, db, name)
+	if err != nil {
+		if err == query.ErrNotFound {
+			return caller.IsAdmin(), nil
+		}
+		return false, err
+	}
+
+	return set.ACL.CanEdit(caller), nil
+}
+
+// canReadScriptHistory reports if the caller may read the versions of the
+// named Script. Only its editors may, and only the admins once the Script is
+// deleted.
+func canReadScriptHistory(c *app.Context, db *db.DB, name string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	scr, err := script.GetByName(c.SessionID, db, name)
+	if err != nil {
+		if err == script.ErrNotFound {
+			return caller.IsAdmin(), nil
+		}
+		return false, err
+	}
+
+	return scr.ACL.CanEdit(caller), nil
+}
+
+// canReadRegexHistory reports if the caller may read the versions of the
+// named Regex. Only its editors may, and only the admins once the Regex is
+// deleted.
+func canReadRegexHistory(c *app.Context, db *db.DB, name string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	rgx, err := regex.GetByName(c.SessionID, db, name)
+	if err != nil {
+		if err == regex.ErrNotFound {
+			return caller.IsAdmin(), nil
+		}
+		return false, err
+	}
+
+	return rgx.ACL.CanEdit(caller), nil
+}
+
+// canReadMaskHistory reports if the caller may read the versions of the mask
+// of the field. Only its editors may, and only the admins once the mask is
+// deleted.
+func canReadMaskHistory(c *app.Context, db *db.DB, collection string, field string) (bool, error) {
+	caller := callerOf(c)
+	if caller == nil {
+		return true, nil
+	}
+
+	msk, err := mask.GetByName(c.SessionID, db, collection, field)
+	if err != nil {
+		if err == mask.ErrNotFound {
+			return caller.IsAdmin(), nil
+		}
+		return false, err
+	}
+
+	return msk.ACL.CanEdit(caller), nil
+}
+
+// canReadAudit reports if the caller may read the records of the audit log
+// matching the filter. Admins may read every record, other callers only
+// their own so the filter is narrowed to their subject.
+func canReadAudit(caller *acl.Caller, filter *audit.Filter) bool {
+	if caller == nil || caller.IsAdmin() {
+		return true
+	}
+
+	if caller.Subject == "" || (filter.Subject != "" && filter.Subject != caller.Subject) {
+		return false
+	}
+
+	filter.Subject = caller.Subject
+	return true
+}
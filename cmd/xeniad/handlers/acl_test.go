@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+)
+
+func init() {
+	tests.Init("XENIA")
+}
+
+// TestCanReadAudit tests who may read the records of the audit log.
+func TestCanReadAudit(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	user := &acl.Caller{Subject: "user1", Roles: []string{"editor"}}
+	admin := &acl.Caller{Subject: "user2", Roles: []string{acl.RoleAdmin}}
+
+	table := []struct {
+		name    string
+		caller  *acl.Caller
+		subject string
+		allowed bool
+		exp     string
+	}{
+		{"no caller", nil, "", true, ""},
+		{"admin reading every record", admin, "", true, ""},
+		{"admin reading the records of another subject", admin, "user1", true, "user1"},
+		{"caller reading every record", user, "", true, "user1"},
+		{"caller reading their own records", user, "user1", true, "user1"},
+		{"caller reading the records of another subject", user, "user2", false, ""},
+		{"caller without a subject", &acl.Caller{Roles: []string{"editor"}}, "", false, ""},
+	}
+
+	t.Log("Given the need to check who may read the records of the audit log.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen checking the %s", tt.name)
+			{
+				filter := audit.Filter{Subject: tt.subject}
+
+				if got := canReadAudit(tt.caller, &filter); got != tt.allowed {
+					t.Fatalf("\t%s\tShould get %v for reading the records : %v", tests.Failed, tt.allowed, got)
+				}
+				t.Logf("\t%s\tShould get %v for reading the records.", tests.Success, tt.allowed)
+
+				if tt.allowed && filter.Subject != tt.exp {
+					t.Fatalf("\t%s\tShould read the records of subject %q : %q", tests.Failed, tt.exp, filter.Subject)
+				}
+				t.Logf("\t%s\tShould read the records of the right subject.", tests.Success)
+			}
+		}
+	}
+}
+
+// TestCanRunCustom tests who may run custom sets.
+func TestCanRunCustom(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	defer UseCustomExecute(customExecute)
+
+	user := &acl.Caller{Subject: "user1", Roles: []string{"editor"}}
+	analyst := &acl.Caller{Subject: "user2", Roles: []string{"analyst"}}
+	admin := &acl.Caller{Subject: "user3", Roles: []string{acl.RoleAdmin}}
+
+	table := []struct {
+		name    string
+		entries []string
+		caller  *acl.Caller
+		allowed bool
+	}{
+		{"no caller", nil, nil, true},
+		{"admin without entries", nil, admin, true},
+		{"caller without entries", nil, user, false},
+		{"caller named by the entries", []string{"role:analyst"}, analyst, true},
+		{"caller not named by the entries", []string{"role:analyst"}, user, false},
+	}
+
+	t.Log("Given the need to check who may run custom sets.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen checking the %s", tt.name)
+			{
+				UseCustomExecute(tt.entries)
+
+				if got := canRunCustom(tt.caller); got != tt.allowed {
+					t.Fatalf("\t%s\tShould get %v for running custom sets : %v", tests.Failed, tt.allowed, got)
+				}
+				t.Logf("\t%s\tShould get %v for running custom sets.", tests.Success, tt.allowed)
+			}
+		}
+	}
+}
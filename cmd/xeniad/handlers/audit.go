@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+)
+
+// auditHandle maintains the set of handlers for the audit api.
+type auditHandle struct{}
+
+// Audit fronts the access to the audit service functionality.
+var Audit auditHandle
+
+//==============================================================================
+
+// List returns the records of the audit log, newest first. The records can
+// be narrowed with the set, subject and session parameters, and the from and
+// to parameters as RFC3339 times. The limit parameter caps the number of
+// records returned. Callers who are not admins only get their own records.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (auditHandle) List(c *app.Context) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+
+	if !canReadAudit(callerOf(c), &filter) {
+		return respondForbidden(c)
+	}
+
+	recs, err := audit.Get(c.SessionID, c.Ctx["DB"].(*db.DB), filter)
+	if err != nil {
+		if err == audit.ErrNotFound {
+			err = app.ErrNotFound
+		}
+		return err
+	}
+
+	c.Respond(recs, http.StatusOK)
+	return nil
+}
+
+// auditFilter reads the filter for the audit log from the query string.
+func auditFilter(c *app.Context) (audit.Filter, error) {
+	q := c.Request.URL.Query()
+
+	filter := audit.Filter{
+		Set:       q.Get("set"),
+		Subject:   q.Get("subject"),
+		SessionID: q.Get("session"),
+	}
+
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return audit.Filter{}, app.ErrValidation
+			}
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return audit.Filter{}, app.ErrValidation
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
@@ -2,13 +2,21 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
 	"github.com/ardanlabs/kit/web/app"
 	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/export"
 	"github.com/coralproject/shelf/internal/xenia/query"
 )
 
@@ -21,7 +29,7 @@ var Exec execHandle
 //==============================================================================
 
 // Name runs the specified Set and return results.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (execHandle) Name(c *app.Context) error {
 	set, err := query.GetByName(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"])
 	if err != nil {
@@ -31,37 +39,217 @@ func (execHandle) Name(c *app.Context) error {
 		return err
 	}
 
+	if !set.ACL.CanExecute(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
 	return execute(c, set)
 }
 
-// Custom runs the provided Set and return results.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// Custom runs the provided Set and return results. Only the admins and the
+// callers allowed to run custom sets may.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (execHandle) Custom(c *app.Context) error {
+	if !canRunCustom(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
 	var set *query.Set
 	if err := json.NewDecoder(c.Request.Body).Decode(&set); err != nil {
 		return err
 	}
 
+	// Only stored sets can be cached since a custom set could have the
+	// same name as a stored set.
+	set.Cache = nil
+
 	return execute(c, set)
 }
 
+// Purge removes the cached results for the specified Set.
+// 204 SuccessNoContent, 403 Forbidden, 404 Not Found, 500 Internal
+func (execHandle) Purge(c *app.Context) error {
+	db := c.Ctx["DB"].(*db.DB)
+
+	set, err := query.GetByName(c.SessionID, db, c.Params["name"])
+	if err != nil {
+		if err == query.ErrNotFound {
+			err = app.ErrNotFound
+		}
+		return err
+	}
+
+	if !set.ACL.CanExecute(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
+	if err := xenia.PurgeCache(c.SessionID, db, set.Name); err != nil {
+		return err
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
+
 //==============================================================================
 
+// Set of media types the results can be returned as besides JSON.
+const (
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+	mimeXLSX   = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Set of query string parameters that are options of the request and not
+// variables of the set.
+const (
+	dryRunParam      = "dry_run"
+	accessTokenParam = "access_token"
+)
+
 // execute takes a context and Set and executes the set returning
 // any possible response.
 func execute(c *app.Context, set *query.Set) error {
-	var vars map[string]string
+	vars := make(map[string]string)
 	if c.Request.URL.RawQuery != "" {
 		if m, err := url.ParseQuery(c.Request.URL.RawQuery); err == nil {
-			vars = make(map[string]string)
 			for k, v := range m {
-				vars[k] = v[0]
+				switch k {
+				case dryRunParam:
+
+					// The dry run option is not a variable of the set.
+					set.DryRun, _ = strconv.ParseBool(m.Get(k))
+
+				case accessTokenParam:
+
+					// The token used to authenticate the request must
+					// never reach the commands or the audit log.
+
+				default:
+
+					// Repeated parameters are joined into a comma
+					// separated list.
+					vars[k] = strings.Join(v, ",")
+				}
 			}
 		}
 	}
 
-	result := xenia.Exec(c.SessionID, c.Ctx["DB"].(*db.DB), set, vars)
+	// Report the variables that don't satisfy the parameters of the set
+	// as a bad request. The parameters are only processed once, executing
+	// the set does not process them again.
+	if err := xenia.CheckParams(c.SessionID, c.Ctx["DB"].(*db.DB), set, vars); err != nil {
+		if perr, ok := err.(xenia.ParamsError); ok {
+			fields := make([]app.Invalid, len(perr))
+			for i := range perr {
+				fields[i] = app.Invalid{Fld: perr[i].Name, Err: perr[i].Err}
+			}
+
+			c.RespondInvalid(fields)
+			return nil
+		}
+
+		return err
+	}
+
+	ctx := execContext(c)
+
+	// The final commands of a dry run are only returned as JSON.
+	if set.DryRun {
+		result := xenia.ExecContext(ctx, c.SessionID, c.Ctx["DB"].(*db.DB), set, vars, true)
+		c.Respond(result, http.StatusOK)
+		return nil
+	}
+
+	accept := c.Request.Header.Get("Accept")
+
+	// Stream the results if the client asked for them that way.
+	if strings.Contains(accept, mimeNDJSON) {
+		return stream(c, ctx, set, vars)
+	}
+
+	result := xenia.ExecContext(ctx, c.SessionID, c.Ctx["DB"].(*db.DB), set, vars, true)
+
+	// Return the results as a spreadsheet if the client asked for them
+	// that way.
+	switch {
+	case strings.Contains(accept, mimeCSV):
+		return spreadsheet(c, set, result, mimeCSV, ".csv", export.CSV)
+
+	case strings.Contains(accept, mimeXLSX):
+		return spreadsheet(c, set, result, mimeXLSX, ".xlsx", export.XLSX)
+	}
 
 	c.Respond(result, http.StatusOK)
 	return nil
 }
+
+// spreadsheet writes the results of the set in the specified format. If the
+// set failed, the error is returned as JSON like any other failure.
+func spreadsheet(c *app.Context, set *query.Set, result *query.Result, mime string, ext string, write func(io.Writer, []export.Table) error) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	docs, err := export.Decode(data)
+	if err != nil {
+		c.Respond(result, http.StatusOK)
+		return nil
+	}
+
+	// Build the file in memory so any error can still be reported.
+	var b bytes.Buffer
+	if err := write(&b, export.Tables(docs)); err != nil {
+		return err
+	}
+
+	c.Status = http.StatusOK
+	c.Header().Set("Content-Type", mime)
+	c.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", set.Name+ext))
+	c.WriteHeader(http.StatusOK)
+
+	if _, err := b.WriteTo(c.ResponseWriter); err != nil {
+		log.Error(c.SessionID, "spreadsheet", err, "Writing results")
+	}
+
+	return nil
+}
+
+// stream executes the set writing the results to the client as newline
+// delimited JSON as they are read. Once the first line is written the
+// status can't change, so errors executing the set are reported in the
+// last line of the response.
+func stream(c *app.Context, ctx context.Context, set *query.Set, vars map[string]string) error {
+	c.Status = http.StatusOK
+	c.Header().Set("Content-Type", mimeNDJSON)
+	c.WriteHeader(http.StatusOK)
+
+	w := flushWriter{w: c.ResponseWriter}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		w.f = f
+	}
+
+	if err := xenia.ExecStream(ctx, c.SessionID, c.Ctx["DB"].(*db.DB), set, vars, true, w); err != nil {
+		log.Error(c.SessionID, "stream", err, "Writing results")
+	}
+
+	return nil
+}
+
+// flushWriter flushes each write to the client so the results are not
+// held in a buffer.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+// Write implements the io.Writer interface.
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+
+	return n, err
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/xenia/history"
+)
+
+// versionParam returns the version number provided in the named route
+// parameter.
+func versionParam(c *app.Context, name string) (int, error) {
+	version, err := strconv.Atoi(c.Params[name])
+	if err != nil || version < 1 {
+		return 0, app.ErrValidation
+	}
+
+	return version, nil
+}
+
+// historyErr converts the errors of reading the history into the errors
+// of the web api.
+func historyErr(err error, notFound error) error {
+	if err == notFound || err == history.ErrVersionNotFound {
+		return app.ErrNotFound
+	}
+
+	return err
+}
+
+// respondDiff responds with the changes between the two versions.
+func respondDiff(c *app.Context, from, to interface{}) error {
+	changes, err := history.Diff(from, to)
+	if err != nil {
+		return err
+	}
+
+	c.Respond(changes, http.StatusOK)
+	return nil
+}
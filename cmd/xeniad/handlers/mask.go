@@ -17,10 +17,11 @@ var Mask maskHandle
 
 //==============================================================================
 
-// List returns all the existing mask in the system.
+// List returns all the existing mask in the system. The list can be
+// narrowed to the masks with all of the tags provided in the tag parameter.
 // 200 Success, 404 Not Found, 500 Internal
 func (maskHandle) List(c *app.Context) error {
-	masks, err := mask.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), nil)
+	masks, err := mask.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), tagsParam(c))
 	if err != nil {
 		if err == mask.ErrNotFound {
 			err = app.ErrNotFound
@@ -32,8 +33,10 @@ func (maskHandle) List(c *app.Context) error {
 	return nil
 }
 
-// Retrieve returns the specified mask from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// Retrieve returns the specified mask from the system. Only the editors of a
+// mask may retrieve it, the masks of a collection are narrowed to those the
+// caller may edit.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (maskHandle) Retrieve(c *app.Context) error {
 	collection := c.Params["collection"]
 	field := c.Params["field"]
@@ -42,6 +45,8 @@ func (maskHandle) Retrieve(c *app.Context) error {
 		collection = "*"
 	}
 
+	caller := callerOf(c)
+
 	if field == "" {
 		masks, err := mask.GetByCollection(c.SessionID, c.Ctx["DB"].(*db.DB), collection)
 		if err != nil {
@@ -51,6 +56,12 @@ func (maskHandle) Retrieve(c *app.Context) error {
 			return err
 		}
 
+		for name, msk := range masks {
+			if !msk.ACL.CanEdit(caller) {
+				delete(masks, name)
+			}
+		}
+
 		c.Respond(masks, http.StatusOK)
 		return nil
 	}
@@ -63,6 +74,10 @@ func (maskHandle) Retrieve(c *app.Context) error {
 		return err
 	}
 
+	if !msk.ACL.CanEdit(caller) {
+		return respondForbidden(c)
+	}
+
 	c.Respond(msk, http.StatusOK)
 	return nil
 }
@@ -70,14 +85,24 @@ func (maskHandle) Retrieve(c *app.Context) error {
 //==============================================================================
 
 // Upsert inserts or updates the posted mask document into the database.
-// 204 SuccessNoContent, 400 Bad Request, 404 Not Found, 500 Internal
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (maskHandle) Upsert(c *app.Context) error {
 	var msk mask.Mask
 	if err := json.NewDecoder(c.Request.Body).Decode(&msk); err != nil {
 		return err
 	}
 
-	if err := mask.Upsert(c.SessionID, c.Ctx["DB"].(*db.DB), msk); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditMask(c, db, msk.Collection, msk.Field)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := mask.Upsert(c.SessionID, db, msk); err != nil {
 		return err
 	}
 
@@ -88,9 +113,19 @@ func (maskHandle) Upsert(c *app.Context) error {
 //==============================================================================
 
 // Delete removes the specified mask from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (maskHandle) Delete(c *app.Context) error {
-	if err := mask.Delete(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["collection"], c.Params["field"]); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditMask(c, db, c.Params["collection"], c.Params["field"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := mask.Delete(c.SessionID, db, c.Params["collection"], c.Params["field"]); err != nil {
 		if err == mask.ErrNotFound {
 			err = app.ErrNotFound
 		}
@@ -100,3 +135,89 @@ func (maskHandle) Delete(c *app.Context) error {
 	c.Respond(nil, http.StatusNoContent)
 	return nil
 }
+
+//==============================================================================
+
+// History returns every version of the specified mask within the history.
+// 200 Success, 403 Forbidden, 404 Not Found, 500 Internal
+func (maskHandle) History(c *app.Context) error {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadMaskHistory(c, db, c.Params["collection"], c.Params["field"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	versions, err := mask.GetHistory(c.SessionID, db, c.Params["collection"], c.Params["field"])
+	if err != nil {
+		return historyErr(err, mask.ErrNotFound)
+	}
+
+	c.Respond(versions, http.StatusOK)
+	return nil
+}
+
+// Diff returns the changes between two versions of the specified mask.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (maskHandle) Diff(c *app.Context) error {
+	from, err := versionParam(c, "from")
+	if err != nil {
+		return err
+	}
+
+	to, err := versionParam(c, "to")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadMaskHistory(c, db, c.Params["collection"], c.Params["field"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	v1, err := mask.GetVersion(c.SessionID, db, c.Params["collection"], c.Params["field"], from)
+	if err != nil {
+		return historyErr(err, mask.ErrNotFound)
+	}
+
+	v2, err := mask.GetVersion(c.SessionID, db, c.Params["collection"], c.Params["field"], to)
+	if err != nil {
+		return historyErr(err, mask.ErrNotFound)
+	}
+
+	return respondDiff(c, v1, v2)
+}
+
+// Restore makes the specified version of the mask the current version.
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (maskHandle) Restore(c *app.Context) error {
+	version, err := versionParam(c, "version")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditMask(c, db, c.Params["collection"], c.Params["field"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := mask.Restore(c.SessionID, db, c.Params["collection"], c.Params["field"], version); err != nil {
+		return historyErr(err, mask.ErrNotFound)
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
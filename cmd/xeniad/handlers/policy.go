@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/xenia/policy"
+)
+
+// policyHandle maintains the set of handlers for the policy api.
+type policyHandle struct{}
+
+// Policy fronts the access to the policy service functionality.
+var Policy policyHandle
+
+//==============================================================================
+
+// List returns all the existing policies in the system.
+// 200 Success, 404 Not Found, 500 Internal
+func (policyHandle) List(c *app.Context) error {
+	policies, err := policy.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB))
+	if err != nil {
+		if err == policy.ErrNotFound {
+			err = app.ErrNotFound
+		}
+		return err
+	}
+
+	c.Respond(policies, http.StatusOK)
+	return nil
+}
+
+// Retrieve returns the specified policy from the system. Without a role, the
+// policies that apply to the collection are returned.
+// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+func (policyHandle) Retrieve(c *app.Context) error {
+	collection := c.Params["collection"]
+	role := c.Params["role"]
+
+	if role == "" {
+		policies, err := policy.GetByCollection(c.SessionID, c.Ctx["DB"].(*db.DB), collection)
+		if err != nil {
+			if err == policy.ErrNotFound {
+				err = app.ErrNotFound
+			}
+			return err
+		}
+
+		c.Respond(policies, http.StatusOK)
+		return nil
+	}
+
+	p, err := policy.GetByName(c.SessionID, c.Ctx["DB"].(*db.DB), collection, role)
+	if err != nil {
+		if err == policy.ErrNotFound {
+			err = app.ErrNotFound
+		}
+		return err
+	}
+
+	c.Respond(p, http.StatusOK)
+	return nil
+}
+
+//==============================================================================
+
+// Upsert inserts or updates the posted policy document into the database.
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (policyHandle) Upsert(c *app.Context) error {
+	var p policy.Policy
+	if err := json.NewDecoder(c.Request.Body).Decode(&p); err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditPolicy(c, db, p.Collection, p.Role)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := policy.Upsert(c.SessionID, db, p); err != nil {
+		return err
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
+
+//==============================================================================
+
+// Delete removes the specified policy from the system.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (policyHandle) Delete(c *app.Context) error {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditPolicy(c, db, c.Params["collection"], c.Params["role"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := policy.Delete(c.SessionID, db, c.Params["collection"], c.Params["role"]); err != nil {
+		if err == policy.ErrNotFound {
+			err = app.ErrNotFound
+		}
+		return err
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
@@ -4,9 +4,12 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/xenia"
 	"github.com/coralproject/shelf/internal/xenia/query"
 )
 
@@ -18,10 +21,11 @@ var Query queryHandle
 
 //==============================================================================
 
-// List returns all the existing Set names in the system.
+// List returns all the existing Set names in the system. The list can be
+// narrowed to the Sets with all of the tags provided in the tag parameter.
 // 200 Success, 404 Not Found, 500 Internal
 func (queryHandle) List(c *app.Context) error {
-	sets, err := query.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), nil)
+	sets, err := query.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), tagsParam(c))
 	if err != nil {
 		if err == query.ErrNotFound {
 			err = app.ErrNotFound
@@ -33,8 +37,23 @@ func (queryHandle) List(c *app.Context) error {
 	return nil
 }
 
+// tagsParam returns the tags provided in the tag query parameter. The
+// parameter can be repeated or hold a comma separated list of tags.
+func tagsParam(c *app.Context) []string {
+	var tags []string
+	for _, v := range c.Request.URL.Query()["tag"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
 // Retrieve returns the specified Set from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (queryHandle) Retrieve(c *app.Context) error {
 	set, err := query.GetByName(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"])
 	if err != nil {
@@ -44,21 +63,50 @@ func (queryHandle) Retrieve(c *app.Context) error {
 		return err
 	}
 
+	if !set.ACL.CanExecute(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
 	c.Respond(set, http.StatusOK)
 	return nil
 }
 
 //==============================================================================
 
-// Upsert inserts or updates the posted Set document into the database.
-// 204 SuccessNoContent, 400 Bad Request, 404 Not Found, 500 Internal
+// Upsert inserts or updates the posted Set document into the database. The
+// references of the Set are resolved first unless the check parameter is false.
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (queryHandle) Upsert(c *app.Context) error {
 	var set query.Set
 	if err := json.NewDecoder(c.Request.Body).Decode(&set); err != nil {
 		return err
 	}
 
-	if err := query.Upsert(c.SessionID, c.Ctx["DB"].(*db.DB), &set); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditSet(c, db, set.Name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if check, err := strconv.ParseBool(c.Request.URL.Query().Get("check")); err != nil || check {
+		if err := query.Check(c.SessionID, db, &set); err != nil {
+			if respondProblems(c, err) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if err := query.Upsert(c.SessionID, db, &set); err != nil {
+		return err
+	}
+
+	// Any cached results are for the previous version of the set.
+	if err := xenia.PurgeCache(c.SessionID, db, set.Name); err != nil {
 		return err
 	}
 
@@ -66,8 +114,26 @@ func (queryHandle) Upsert(c *app.Context) error {
 	return nil
 }
 
+// respondProblems responds with the problems found with the references of
+// a Set as a bad request. False is returned if the error is not about the
+// problems with a Set.
+func respondProblems(c *app.Context, err error) bool {
+	probs, ok := err.(query.Problems)
+	if !ok {
+		return false
+	}
+
+	fields := make([]app.Invalid, len(probs))
+	for i := range probs {
+		fields[i] = app.Invalid{Fld: probs[i].Field, Err: probs[i].Err}
+	}
+
+	c.RespondInvalid(fields)
+	return true
+}
+
 // EnsureIndexes makes sure indexes for the specified set exist.
-// 204 SuccessNoContent, 400 Bad Request, 404 Not Found, 500 Internal
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (queryHandle) EnsureIndexes(c *app.Context) error {
 	db := c.Ctx["DB"].(*db.DB)
 
@@ -79,6 +145,10 @@ func (queryHandle) EnsureIndexes(c *app.Context) error {
 		return err
 	}
 
+	if !set.ACL.CanEdit(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
 	if err := query.EnsureIndexes(c.SessionID, db, set); err != nil {
 		return err
 	}
@@ -90,15 +160,123 @@ func (queryHandle) EnsureIndexes(c *app.Context) error {
 //==============================================================================
 
 // Delete removes the specified Set from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (queryHandle) Delete(c *app.Context) error {
-	if err := query.Delete(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"]); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditSet(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := query.Delete(c.SessionID, db, c.Params["name"]); err != nil {
 		if err == query.ErrNotFound {
 			err = app.ErrNotFound
 		}
 		return err
 	}
 
+	if err := xenia.PurgeCache(c.SessionID, db, c.Params["name"]); err != nil {
+		return err
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
+
+//==============================================================================
+
+// History returns every version of the specified Set within the history.
+// 200 Success, 403 Forbidden, 404 Not Found, 500 Internal
+func (queryHandle) History(c *app.Context) error {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadSetHistory(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	versions, err := query.GetHistory(c.SessionID, db, c.Params["name"])
+	if err != nil {
+		return historyErr(err, query.ErrNotFound)
+	}
+
+	c.Respond(versions, http.StatusOK)
+	return nil
+}
+
+// Diff returns the changes between two versions of the specified Set.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (queryHandle) Diff(c *app.Context) error {
+	from, err := versionParam(c, "from")
+	if err != nil {
+		return err
+	}
+
+	to, err := versionParam(c, "to")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadSetHistory(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	v1, err := query.GetVersion(c.SessionID, db, c.Params["name"], from)
+	if err != nil {
+		return historyErr(err, query.ErrNotFound)
+	}
+
+	v2, err := query.GetVersion(c.SessionID, db, c.Params["name"], to)
+	if err != nil {
+		return historyErr(err, query.ErrNotFound)
+	}
+
+	return respondDiff(c, v1, v2)
+}
+
+// Restore makes the specified version of the Set the current version.
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (queryHandle) Restore(c *app.Context) error {
+	version, err := versionParam(c, "version")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditSet(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := query.Restore(c.SessionID, db, c.Params["name"], version); err != nil {
+		if respondProblems(c, err) {
+			return nil
+		}
+		return historyErr(err, query.ErrNotFound)
+	}
+
+	// Any cached results are for the previous version of the set.
+	if err := xenia.PurgeCache(c.SessionID, db, c.Params["name"]); err != nil {
+		return err
+	}
+
 	c.Respond(nil, http.StatusNoContent)
 	return nil
 }
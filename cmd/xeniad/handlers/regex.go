@@ -17,10 +17,11 @@ var Regex regexHandle
 
 //==============================================================================
 
-// List returns all the existing regex in the system.
+// List returns all the existing regex in the system. The list can be
+// narrowed to the regexs with all of the tags provided in the tag parameter.
 // 200 Success, 404 Not Found, 500 Internal
 func (regexHandle) List(c *app.Context) error {
-	rgxs, err := regex.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), nil)
+	rgxs, err := regex.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), tagsParam(c))
 	if err != nil {
 		if err == regex.ErrNotFound {
 			err = app.ErrNotFound
@@ -32,8 +33,9 @@ func (regexHandle) List(c *app.Context) error {
 	return nil
 }
 
-// Retrieve returns the specified regex from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// Retrieve returns the specified regex from the system. Only its editors may
+// retrieve it.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (regexHandle) Retrieve(c *app.Context) error {
 	rgx, err := regex.GetByName(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"])
 	if err != nil {
@@ -43,6 +45,10 @@ func (regexHandle) Retrieve(c *app.Context) error {
 		return err
 	}
 
+	if !rgx.ACL.CanEdit(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
 	c.Respond(rgx, http.StatusOK)
 	return nil
 }
@@ -50,14 +56,24 @@ func (regexHandle) Retrieve(c *app.Context) error {
 //==============================================================================
 
 // Upsert inserts or updates the posted Regex document into the database.
-// 204 SuccessNoContent, 400 Bad Request, 404 Not Found, 500 Internal
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (regexHandle) Upsert(c *app.Context) error {
 	var rgx regex.Regex
 	if err := json.NewDecoder(c.Request.Body).Decode(&rgx); err != nil {
 		return err
 	}
 
-	if err := regex.Upsert(c.SessionID, c.Ctx["DB"].(*db.DB), rgx); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditRegex(c, db, rgx.Name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := regex.Upsert(c.SessionID, db, rgx); err != nil {
 		return err
 	}
 
@@ -68,9 +84,19 @@ func (regexHandle) Upsert(c *app.Context) error {
 //==============================================================================
 
 // Delete removes the specified Regex from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (regexHandle) Delete(c *app.Context) error {
-	if err := regex.Delete(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"]); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditRegex(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := regex.Delete(c.SessionID, db, c.Params["name"]); err != nil {
 		if err == regex.ErrNotFound {
 			err = app.ErrNotFound
 		}
@@ -80,3 +106,89 @@ func (regexHandle) Delete(c *app.Context) error {
 	c.Respond(nil, http.StatusNoContent)
 	return nil
 }
+
+//==============================================================================
+
+// History returns every version of the specified Regex within the history.
+// 200 Success, 403 Forbidden, 404 Not Found, 500 Internal
+func (regexHandle) History(c *app.Context) error {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadRegexHistory(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	versions, err := regex.GetHistory(c.SessionID, db, c.Params["name"])
+	if err != nil {
+		return historyErr(err, regex.ErrNotFound)
+	}
+
+	c.Respond(versions, http.StatusOK)
+	return nil
+}
+
+// Diff returns the changes between two versions of the specified Regex.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (regexHandle) Diff(c *app.Context) error {
+	from, err := versionParam(c, "from")
+	if err != nil {
+		return err
+	}
+
+	to, err := versionParam(c, "to")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadRegexHistory(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	v1, err := regex.GetVersion(c.SessionID, db, c.Params["name"], from)
+	if err != nil {
+		return historyErr(err, regex.ErrNotFound)
+	}
+
+	v2, err := regex.GetVersion(c.SessionID, db, c.Params["name"], to)
+	if err != nil {
+		return historyErr(err, regex.ErrNotFound)
+	}
+
+	return respondDiff(c, v1, v2)
+}
+
+// Restore makes the specified version of the Regex the current version.
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (regexHandle) Restore(c *app.Context) error {
+	version, err := versionParam(c, "version")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditRegex(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := regex.Restore(c.SessionID, db, c.Params["name"], version); err != nil {
+		return historyErr(err, regex.ErrNotFound)
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
@@ -17,10 +17,11 @@ var Script scriptHandle
 
 //==============================================================================
 
-// List returns all the existing scripts in the system.
+// List returns all the existing scripts in the system. The list can be
+// narrowed to the scripts with all of the tags provided in the tag parameter.
 // 200 Success, 404 Not Found, 500 Internal
 func (scriptHandle) List(c *app.Context) error {
-	scrs, err := script.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), nil)
+	scrs, err := script.GetAll(c.SessionID, c.Ctx["DB"].(*db.DB), tagsParam(c))
 	if err != nil {
 		if err == script.ErrNotFound {
 			err = app.ErrNotFound
@@ -32,8 +33,9 @@ func (scriptHandle) List(c *app.Context) error {
 	return nil
 }
 
-// Retrieve returns the specified script from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// Retrieve returns the specified script from the system. Only its editors may
+// retrieve it.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (scriptHandle) Retrieve(c *app.Context) error {
 	scr, err := script.GetByName(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"])
 	if err != nil {
@@ -43,6 +45,10 @@ func (scriptHandle) Retrieve(c *app.Context) error {
 		return err
 	}
 
+	if !scr.ACL.CanEdit(callerOf(c)) {
+		return respondForbidden(c)
+	}
+
 	c.Respond(scr, http.StatusOK)
 	return nil
 }
@@ -50,14 +56,24 @@ func (scriptHandle) Retrieve(c *app.Context) error {
 //==============================================================================
 
 // Upsert inserts or updates the posted Script document into the database.
-// 204 SuccessNoContent, 400 Bad Request, 404 Not Found, 500 Internal
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (scriptHandle) Upsert(c *app.Context) error {
 	var scr script.Script
 	if err := json.NewDecoder(c.Request.Body).Decode(&scr); err != nil {
 		return err
 	}
 
-	if err := script.Upsert(c.SessionID, c.Ctx["DB"].(*db.DB), scr); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditScript(c, db, scr.Name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := script.Upsert(c.SessionID, db, scr); err != nil {
 		return err
 	}
 
@@ -68,9 +84,19 @@ func (scriptHandle) Upsert(c *app.Context) error {
 //==============================================================================
 
 // Delete removes the specified Script from the system.
-// 200 Success, 400 Bad Request, 404 Not Found, 500 Internal
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
 func (scriptHandle) Delete(c *app.Context) error {
-	if err := script.Delete(c.SessionID, c.Ctx["DB"].(*db.DB), c.Params["name"]); err != nil {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditScript(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := script.Delete(c.SessionID, db, c.Params["name"]); err != nil {
 		if err == script.ErrNotFound {
 			err = app.ErrNotFound
 		}
@@ -80,3 +106,89 @@ func (scriptHandle) Delete(c *app.Context) error {
 	c.Respond(nil, http.StatusNoContent)
 	return nil
 }
+
+//==============================================================================
+
+// History returns every version of the specified Script within the history.
+// 200 Success, 403 Forbidden, 404 Not Found, 500 Internal
+func (scriptHandle) History(c *app.Context) error {
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadScriptHistory(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	versions, err := script.GetHistory(c.SessionID, db, c.Params["name"])
+	if err != nil {
+		return historyErr(err, script.ErrNotFound)
+	}
+
+	c.Respond(versions, http.StatusOK)
+	return nil
+}
+
+// Diff returns the changes between two versions of the specified Script.
+// 200 Success, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (scriptHandle) Diff(c *app.Context) error {
+	from, err := versionParam(c, "from")
+	if err != nil {
+		return err
+	}
+
+	to, err := versionParam(c, "to")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canReadScriptHistory(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	v1, err := script.GetVersion(c.SessionID, db, c.Params["name"], from)
+	if err != nil {
+		return historyErr(err, script.ErrNotFound)
+	}
+
+	v2, err := script.GetVersion(c.SessionID, db, c.Params["name"], to)
+	if err != nil {
+		return historyErr(err, script.ErrNotFound)
+	}
+
+	return respondDiff(c, v1, v2)
+}
+
+// Restore makes the specified version of the Script the current version.
+// 204 SuccessNoContent, 400 Bad Request, 403 Forbidden, 404 Not Found, 500 Internal
+func (scriptHandle) Restore(c *app.Context) error {
+	version, err := versionParam(c, "version")
+	if err != nil {
+		return err
+	}
+
+	db := c.Ctx["DB"].(*db.DB)
+
+	ok, err := canEditScript(c, db, c.Params["name"])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return respondForbidden(c)
+	}
+
+	if err := script.Restore(c.SessionID, db, c.Params["name"], version); err != nil {
+		return historyErr(err, script.ErrNotFound)
+	}
+
+	c.Respond(nil, http.StatusNoContent)
+	return nil
+}
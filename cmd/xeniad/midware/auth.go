@@ -5,6 +5,7 @@ import (
 	"github.com/ardanlabs/kit/cfg"
 	"github.com/ardanlabs/kit/log"
 	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/internal/token"
 )
 
 const cfgAnvilHost = "ANVIL_HOST"
@@ -32,6 +33,16 @@ func Auth(h app.Handler) app.Handler {
 
 		c.Ctx["claims"] = claims
 
+		// Anvil only provides the standard claims so keep every claim for
+		// resolving the tenant and checking the ACLs.
+		all, err := token.Claims(c.Request)
+		if err != nil {
+			log.Error(c.SessionID, "Auth", err, "Reading claims")
+			return app.ErrNotAuthorized
+		}
+
+		c.Ctx["jwt"] = all
+
 		log.Dev(c.SessionID, "Auth", "Completed")
 		return h(c)
 	}
@@ -2,10 +2,13 @@ package routes
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/anvilresearch/go-anvil"
@@ -16,6 +19,10 @@ import (
 	"github.com/ardanlabs/kit/web/app"
 	"github.com/coralproject/shelf/cmd/xeniad/handlers"
 	"github.com/coralproject/shelf/cmd/xeniad/midware"
+	"github.com/coralproject/shelf/internal/tenant"
+	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/cache"
 )
 
 // Environmental variables.
@@ -26,13 +33,28 @@ const (
 	cfgMongoUser     = "MONGO_USER"
 	cfgMongoPassword = "MONGO_PASS"
 	cfgAnvilHost     = "ANVIL_HOST"
+	cfgCache         = "CACHE"
+	cfgAudit         = "AUDIT"
+	cfgAuditSize     = "AUDIT_SIZE"
+	cfgSavePrefix    = "SAVE_PREFIX"
+	cfgCustomExecute = "CUSTOM_EXECUTE"
 )
 
+// tenants holds the tenants sharing the service, if any.
+var tenants *tenant.Config
+
 func init() {
 	// Initialize the configuration and logging systems. Plus anything
 	// else the web app layer needs.
 	app.Init(cfg.EnvProvider{Namespace: "XENIA"})
 
+	// Initialize the tenants sharing the service.
+	var err error
+	if tenants, err = tenant.Load(); err != nil {
+		log.Error("startup", "Init", err, "Initializing tenants")
+		os.Exit(1)
+	}
+
 	// Initialize MongoDB.
 	if _, err := cfg.String(cfgMongoHost); err == nil {
 		cfg := mongo.Config{
@@ -51,6 +73,63 @@ func init() {
 			log.Error("startup", "Init", err, "Initializing MongoDB")
 			os.Exit(1)
 		}
+
+		// Each tenant sharing the service has a master session for its
+		// own database.
+		if tenants != nil {
+			if err := tenant.RegMasterSessions("startup", tenants, cfg); err != nil {
+				log.Error("startup", "Init", err, "Initializing tenants")
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Share cached results between services when configured to use Mongo.
+	if c, err := cfg.String(cfgCache); err == nil && c == "mongo" {
+		log.Dev("startup", "Init", "Initalizing Mongo cache")
+		xenia.UseCache(cache.NewMongo())
+	}
+
+	// Record the executions of sets in the audit log when configured. The
+	// rate is the fraction of the executions recorded, 1 for all of them.
+	if r, err := cfg.String(cfgAudit); err == nil {
+		rate, err := strconv.ParseFloat(r, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			log.Error("startup", "Init", fmt.Errorf("Invalid audit rate %q", r), "Initializing audit log")
+			os.Exit(1)
+		}
+
+		if size, err := cfg.Int(cfgAuditSize); err == nil {
+			audit.Size = size
+		}
+
+		log.Dev("startup", "Init", "Initalizing audit log : Rate[%v] Size[%d]", rate, audit.Size)
+		xenia.UseAudit(rate)
+	}
+
+	// Sets can only save results into the collections with this prefix.
+	if prefix, err := cfg.String(cfgSavePrefix); err == nil {
+		if prefix == "" {
+			log.Error("startup", "Init", fmt.Errorf("Invalid save prefix %q", prefix), "Initializing save prefix")
+			os.Exit(1)
+		}
+
+		log.Dev("startup", "Init", "Initalizing save prefix : Prefix[%s]", prefix)
+		xenia.UseSavePrefix(prefix)
+	}
+
+	// Besides the admins, custom sets can only be run by the callers named
+	// by this comma separated list of ACL entries, like "role:analyst".
+	if list, err := cfg.String(cfgCustomExecute); err == nil {
+		var entries []string
+		for _, entry := range strings.Split(list, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+
+		log.Dev("startup", "Init", "Initalizing custom sets : Execute[%v]", entries)
+		handlers.UseCustomExecute(entries)
 	}
 }
 
@@ -71,7 +150,8 @@ func API(testing ...bool) http.Handler {
 		}
 	}
 
-	a := app.New(midware.Mongo, midware.Auth)
+	// Authentication happens first so the claims can name the tenant.
+	a := app.New(midware.Auth, midware.Mongo)
 	a.Ctx["anvil"] = anv
 
 	log.Dev("startup", "Init", "Initalizing routes")
@@ -86,6 +166,11 @@ func API(testing ...bool) http.Handler {
 	// 	website(a)
 	// }
 
+	// Tenants can be named by a prefix of the path.
+	if tenants != nil && tenants.From == tenant.FromPath {
+		return tenant.StripPrefix(tenants, a)
+	}
+
 	return a
 }
 
@@ -97,11 +182,17 @@ func routes(a *app.App) {
 	a.Handle("PUT", "/1.0/script", handlers.Script.Upsert)
 	a.Handle("GET", "/1.0/script/:name", handlers.Script.Retrieve)
 	a.Handle("DELETE", "/1.0/script/:name", handlers.Script.Delete)
+	a.Handle("GET", "/1.0/script/:name/history", handlers.Script.History)
+	a.Handle("GET", "/1.0/script/:name/diff/:from/:to", handlers.Script.Diff)
+	a.Handle("PUT", "/1.0/script/:name/restore/:version", handlers.Script.Restore)
 
 	a.Handle("GET", "/1.0/query", handlers.Query.List)
 	a.Handle("PUT", "/1.0/query", handlers.Query.Upsert)
 	a.Handle("GET", "/1.0/query/:name", handlers.Query.Retrieve)
 	a.Handle("DELETE", "/1.0/query/:name", handlers.Query.Delete)
+	a.Handle("GET", "/1.0/query/:name/history", handlers.Query.History)
+	a.Handle("GET", "/1.0/query/:name/diff/:from/:to", handlers.Query.Diff)
+	a.Handle("PUT", "/1.0/query/:name/restore/:version", handlers.Query.Restore)
 
 	a.Handle("PUT", "/1.0/index/:name", handlers.Query.EnsureIndexes)
 
@@ -109,15 +200,30 @@ func routes(a *app.App) {
 	a.Handle("PUT", "/1.0/regex", handlers.Regex.Upsert)
 	a.Handle("GET", "/1.0/regex/:name", handlers.Regex.Retrieve)
 	a.Handle("DELETE", "/1.0/regex/:name", handlers.Regex.Delete)
+	a.Handle("GET", "/1.0/regex/:name/history", handlers.Regex.History)
+	a.Handle("GET", "/1.0/regex/:name/diff/:from/:to", handlers.Regex.Diff)
+	a.Handle("PUT", "/1.0/regex/:name/restore/:version", handlers.Regex.Restore)
 
 	a.Handle("GET", "/1.0/mask", handlers.Mask.List)
 	a.Handle("PUT", "/1.0/mask", handlers.Mask.Upsert)
 	a.Handle("GET", "/1.0/mask/:collection/:field", handlers.Mask.Retrieve)
 	a.Handle("GET", "/1.0/mask/:collection", handlers.Mask.Retrieve)
 	a.Handle("DELETE", "/1.0/mask/:collection/:field", handlers.Mask.Delete)
+	a.Handle("GET", "/1.0/mask/:collection/:field/history", handlers.Mask.History)
+	a.Handle("GET", "/1.0/mask/:collection/:field/diff/:from/:to", handlers.Mask.Diff)
+	a.Handle("PUT", "/1.0/mask/:collection/:field/restore/:version", handlers.Mask.Restore)
+
+	a.Handle("GET", "/1.0/policy", handlers.Policy.List)
+	a.Handle("PUT", "/1.0/policy", handlers.Policy.Upsert)
+	a.Handle("GET", "/1.0/policy/:collection/:role", handlers.Policy.Retrieve)
+	a.Handle("GET", "/1.0/policy/:collection", handlers.Policy.Retrieve)
+	a.Handle("DELETE", "/1.0/policy/:collection/:role", handlers.Policy.Delete)
+
+	a.Handle("GET", "/1.0/audit", handlers.Audit.List)
 
 	a.Handle("POST", "/1.0/exec", handlers.Exec.Custom)
 	a.Handle("GET", "/1.0/exec/:name", handlers.Exec.Name)
+	a.Handle("DELETE", "/1.0/exec/:name/cache", handlers.Exec.Purge)
 
 	a.Handle("GET", "/1.0/relationship", handlers.Relationship.List)
 	a.Handle("PUT", "/1.0/relationship", handlers.Relationship.Upsert)
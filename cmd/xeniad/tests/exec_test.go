@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
 	"github.com/coralproject/shelf/internal/xenia/query/qfix"
 )
 
@@ -184,3 +185,172 @@ func TestExecExplain(t *testing.T) {
 		}
 	}
 }
+
+// TestExecPurge tests purging the cached results of a query.
+func TestExecPurge(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to purge the cached results of a query.")
+	{
+		url := "/1.0/exec/" + qPrefix + "_basic/cache"
+		r := tests.NewRequest("DELETE", url, nil)
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, r)
+
+		t.Logf("\tWhen calling url : %s", url)
+		{
+			if w.Code != 204 {
+				t.Fatalf("\t%s\tShould be able to purge the cached results : %v", tests.Failed, w.Code)
+			}
+			t.Logf("\t%s\tShould be able to purge the cached results.", tests.Success)
+		}
+
+		url = "/1.0/exec/" + qPrefix + "_unknown/cache"
+		r = tests.NewRequest("DELETE", url, nil)
+		w = httptest.NewRecorder()
+
+		a.ServeHTTP(w, r)
+
+		t.Logf("\tWhen calling url : %s", url)
+		{
+			if w.Code != 404 {
+				t.Fatalf("\t%s\tShould not be able to purge an unknown query : %v", tests.Failed, w.Code)
+			}
+			t.Logf("\t%s\tShould not be able to purge an unknown query.", tests.Success)
+		}
+	}
+}
+
+// TestExecStream tests the execution of a specific query streaming the
+// results as newline delimited JSON.
+func TestExecStream(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to execute a specific query streaming the results.")
+	{
+		url := "/1.0/exec/" + qPrefix + "_basic?station_id=42021"
+		r := tests.NewRequest("GET", url, nil)
+		r.Header.Set("Accept", "application/x-ndjson")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, r)
+
+		t.Logf("\tWhen calling url : %s", url)
+		{
+			if w.Code != 200 {
+				t.Fatalf("\t%s\tShould be able to retrieve the query : %v", tests.Failed, w.Code)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the query.", tests.Success)
+
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Fatalf("\t%s\tShould get the newline delimited JSON content type : %s", tests.Failed, ct)
+			}
+			t.Logf("\t%s\tShould get the newline delimited JSON content type.", tests.Success)
+
+			recv := w.Body.String()
+			resp := `{"Name":"Basic","Doc":{"name":"C14 - Pasco County Buoy, FL"}}` + "\n"
+
+			if resp != recv {
+				t.Log(resp)
+				t.Log(recv)
+				t.Fatalf("\t%s\tShould get the expected result.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the expected result.", tests.Success)
+		}
+	}
+}
+
+// TestExecCSV tests the execution of a specific query returning the
+// results as CSV.
+func TestExecCSV(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to execute a specific query with CSV output.")
+	{
+		url := "/1.0/exec/" + qPrefix + "_basic?station_id=42021"
+		r := tests.NewRequest("GET", url, nil)
+		r.Header.Set("Accept", "text/csv")
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, r)
+
+		t.Logf("\tWhen calling url : %s", url)
+		{
+			if w.Code != 200 {
+				t.Fatalf("\t%s\tShould be able to retrieve the query : %v", tests.Failed, w.Code)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the query.", tests.Success)
+
+			if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+				t.Fatalf("\t%s\tShould get the CSV content type : %s", tests.Failed, ct)
+			}
+			t.Logf("\t%s\tShould get the CSV content type.", tests.Success)
+
+			recv := w.Body.String()
+			resp := "name\nC14 - Pasco County Buoy, FL\n"
+
+			if resp != recv {
+				t.Log(resp)
+				t.Log(recv)
+				t.Fatalf("\t%s\tShould get the expected result.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the expected result.", tests.Success)
+		}
+	}
+}
+
+// TestExecInvalidParams tests the execution of a custom query with variables
+// that don't satisfy the parameters of the set.
+func TestExecInvalidParams(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to execute a custom query with invalid variables.")
+	{
+		qs, err := qfix.Get("basic.json")
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to retrieve the fixture : %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to retrieve the fixture.", tests.Success)
+
+		max := 10.0
+		qs.Params = []query.Param{
+			{Name: "limit", Type: query.ParamInt, Max: &max},
+			{Name: "station_id"},
+		}
+
+		qsStrData, err := json.Marshal(&qs)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to marshal the fixture : %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to marshal the fixture.", tests.Success)
+
+		url := "/1.0/exec?limit=20"
+		r := tests.NewRequest("POST", url, bytes.NewBuffer(qsStrData))
+		w := httptest.NewRecorder()
+
+		a.ServeHTTP(w, r)
+
+		t.Logf("\tWhen calling url : %s", url)
+		{
+			if w.Code != 400 {
+				t.Fatalf("\t%s\tShould get a bad request : %v", tests.Failed, w.Code)
+			}
+			t.Logf("\t%s\tShould get a bad request.", tests.Success)
+
+			recv := tests.IndentJSON(w.Body.String())
+			resp := tests.IndentJSON(`{"error":"field validation failure","fields":[{"field_name":"limit","error":"Value is greater than the max of 10"},{"field_name":"station_id","error":"Missing value"}]}`)
+
+			if resp != recv {
+				t.Log(resp)
+				t.Log(recv)
+				t.Fatalf("\t%s\tShould get the invalid parameters.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the invalid parameters.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package tests implements users tests for the API layer.
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ardanlabs/kit/cfg"
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/ardanlabs/kit/web/app"
+	"github.com/coralproject/shelf/cmd/xeniad/handlers"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/regex"
+	"github.com/coralproject/shelf/internal/xenia/regex/rfix"
+)
+
+// rPrefix is the base name for everything.
+const rPrefix = "RTEST_O"
+
+// TestRegexForbidden tests a caller the ACL of a Regex does not name can't
+// change it or read it and its history.
+func TestRegexForbidden(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	dbName, err := cfg.String("MONGO_DB")
+	if err != nil {
+		t.Fatalf("\t%s\tShould have MongoDB configured : %v", tests.Failed, err)
+	}
+
+	db, err := db.NewMGO(tests.Context, dbName)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	rgx, err := rfix.Get("basic.json")
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to load the regex fixture : %v", tests.Failed, err)
+	}
+
+	rgx.ACL = &acl.ACL{Edit: []string{"role:editor"}}
+	if err := regex.Upsert(tests.Context, db, rgx); err != nil {
+		t.Fatalf("\t%s\tShould be able to add the regex : %v", tests.Failed, err)
+	}
+	defer rfix.Remove(db, rPrefix)
+
+	// handle calls the handler directly so the request has the claims of
+	// the caller without authentication being on.
+	handle := func(h app.Handler, method string, params map[string]string, body []byte) int {
+		w := httptest.NewRecorder()
+		c := app.Context{
+			ResponseWriter: w,
+			Request:        tests.NewRequest(method, "/1.0/regex", bytes.NewReader(body)),
+			Params:         params,
+			SessionID:      tests.Context,
+			Ctx: map[string]interface{}{
+				"DB":  db,
+				"jwt": map[string]interface{}{"sub": "user1", "roles": []interface{}{"guest"}},
+			},
+		}
+
+		if err := h(&c); err != nil {
+			c.Error(err)
+		}
+
+		return w.Code
+	}
+
+	body, err := json.Marshal(regex.Regex{Name: rgx.Name, Expr: "^.*$"})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to marshal the regex : %v", tests.Failed, err)
+	}
+
+	t.Log("Given the need to keep callers from changing a regex they can't edit.")
+	{
+		t.Log("\tWhen upserting the regex")
+		{
+			if code := handle(handlers.Regex.Upsert, "PUT", nil, body); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tShould not be allowed to upsert the regex : %d", tests.Failed, code)
+			}
+			t.Logf("\t%s\tShould not be allowed to upsert the regex.", tests.Success)
+		}
+
+		t.Log("\tWhen restoring a version of the regex")
+		{
+			params := map[string]string{"name": rgx.Name, "version": "1"}
+			if code := handle(handlers.Regex.Restore, "POST", params, nil); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tShould not be allowed to restore the regex : %d", tests.Failed, code)
+			}
+			t.Logf("\t%s\tShould not be allowed to restore the regex.", tests.Success)
+		}
+
+		t.Log("\tWhen deleting the regex")
+		{
+			params := map[string]string{"name": rgx.Name}
+			if code := handle(handlers.Regex.Delete, "DELETE", params, nil); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tShould not be allowed to delete the regex : %d", tests.Failed, code)
+			}
+			t.Logf("\t%s\tShould not be allowed to delete the regex.", tests.Success)
+		}
+
+		t.Log("\tWhen retrieving the regex")
+		{
+			got, err := regex.GetByName(tests.Context, db, rgx.Name)
+			if err != nil || got.Expr != rgx.Expr {
+				t.Fatalf("\t%s\tShould get back the unchanged regex : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get back the unchanged regex.", tests.Success)
+		}
+	}
+
+	t.Log("Given the need to keep callers from reading a regex they can't edit.")
+	{
+		reads := []struct {
+			name    string
+			handler app.Handler
+			params  map[string]string
+		}{
+			{"retrieving", handlers.Regex.Retrieve, map[string]string{"name": rgx.Name}},
+			{"listing the history of", handlers.Regex.History, map[string]string{"name": rgx.Name}},
+			{"diffing the versions of", handlers.Regex.Diff, map[string]string{"name": rgx.Name, "from": "1", "to": "1"}},
+		}
+
+		for _, rd := range reads {
+			t.Logf("\tWhen %s the regex", rd.name)
+			{
+				if code := handle(rd.handler, "GET", rd.params, nil); code != http.StatusForbidden {
+					t.Fatalf("\t%s\tShould not be allowed to read the regex : %d", tests.Failed, code)
+				}
+				t.Logf("\t%s\tShould not be allowed to read the regex.", tests.Success)
+			}
+		}
+	}
+
+	t.Log("Given the need to keep callers from running custom sets.")
+	{
+		t.Log("\tWhen running a custom set")
+		{
+			if code := handle(handlers.Exec.Custom, "POST", nil, []byte(`{"name":"custom"}`)); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tShould not be allowed to run the custom set : %d", tests.Failed, code)
+			}
+			t.Logf("\t%s\tShould not be allowed to run the custom set.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package tenant provides support for serving several newsrooms from a single
+// service. Each tenant has its own database and the tenant of a request is
+// resolved from a header, a JWT claim or a prefix of the path.
+//
+// The tenants are configured through the environment of the service:
+//
+//	<NAMESPACE>_TENANTS      nyt:nyt_db,wapo:wapo_db
+//	<NAMESPACE>_TENANT_FROM  header (default), claim or path
+//	<NAMESPACE>_TENANT_KEY   name of the header or claim holding the tenant
+//	<NAMESPACE>_TENANT_CLAIM name of the claim holding the tenants of the caller
+//
+// When authentication is on, a tenant read from a header or the path must also
+// be named by the claim of the caller, so a token of one tenant can not be
+// used against the database of another.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ardanlabs/kit/cfg"
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+)
+
+// Config environmental variables.
+const (
+	cfgTenants = "TENANTS"
+	cfgFrom    = "TENANT_FROM"
+	cfgKey     = "TENANT_KEY"
+	cfgClaim   = "TENANT_CLAIM"
+)
+
+// Set of ways the tenant of a request can be resolved.
+const (
+	FromHeader = "header"
+	FromClaim  = "claim"
+	FromPath   = "path"
+)
+
+// Set of default names of the header and claim holding the tenant.
+const (
+	DefaultHeader = "X-Tenant"
+	DefaultClaim  = "tenant"
+)
+
+// Set of error variables.
+var (
+	ErrNotFound = errors.New("Tenant Not found")
+	ErrMissing  = errors.New("Tenant not provided")
+	ErrDenied   = errors.New("Tenant not allowed for the caller")
+)
+
+// Config describes the tenants of a service and how they are resolved.
+type Config struct {
+	From  string            // Where the tenant is found: header, claim or path.
+	Key   string            // Name of the header or claim holding the tenant.
+	Claim string            // Name of the claim holding the tenants of the caller.
+	DBs   map[string]string // Name of the database of each tenant.
+}
+
+// Load reads the tenant configuration from the environment. A nil Config is
+// returned when the service has no tenants configured.
+func Load() (*Config, error) {
+	tenants, err := cfg.String(cfgTenants)
+	if err != nil {
+		return nil, nil
+	}
+
+	dbs, err := Parse(tenants)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := cfg.String(cfgFrom)
+	if err != nil {
+		from = FromHeader
+	}
+
+	key, err := cfg.String(cfgKey)
+	if err != nil {
+		key = DefaultHeader
+		if from == FromClaim {
+			key = DefaultClaim
+		}
+	}
+
+	claim, err := cfg.String(cfgClaim)
+	if err != nil {
+		claim = DefaultClaim
+	}
+
+	switch from {
+	case FromHeader, FromClaim, FromPath:
+	default:
+		return nil, fmt.Errorf("Invalid %s %q, expecting header, claim or path", cfgFrom, from)
+	}
+
+	return &Config{From: from, Key: key, Claim: claim, DBs: dbs}, nil
+}
+
+// Parse reads a comma separated list of tenant:database pairs.
+func Parse(tenants string) (map[string]string, error) {
+	dbs := make(map[string]string)
+
+	for _, pair := range strings.Split(tenants, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid tenant %q, expecting tenant:database", pair)
+		}
+
+		dbs[parts[0]] = parts[1]
+	}
+
+	if len(dbs) == 0 {
+		return nil, errors.New("No tenants provided")
+	}
+
+	return dbs, nil
+}
+
+//==============================================================================
+
+// RegMasterSessions registers a master session for the database of each
+// tenant. The sessions share the settings of the configuration and, like the
+// session of the service, are named after their database.
+func RegMasterSessions(context interface{}, conf *Config, mgoCfg mongo.Config) error {
+	registered := map[string]bool{mgoCfg.DB: true}
+
+	for name, dbName := range conf.DBs {
+
+		// Tenants can share a database, including the one of the service.
+		if registered[dbName] {
+			continue
+		}
+		registered[dbName] = true
+
+		tenantCfg := mgoCfg
+		tenantCfg.DB = dbName
+
+		log.Dev(context, "RegMasterSessions", "Tenant[%s] DB[%s]", name, dbName)
+		if err := db.RegMasterSession(context, dbName, tenantCfg); err != nil {
+			return fmt.Errorf("Tenant %q : %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Resolve returns the name of the tenant of the request and the name of its
+// database. The claims are those of the validated JWT of the request and are
+// nil when authentication is off. ErrMissing is returned when the request does
+// not name a tenant and ErrDenied when the claims do not allow it.
+func (conf *Config) Resolve(r *http.Request, claims map[string]interface{}) (string, string, error) {
+	var name string
+
+	switch conf.From {
+	case FromClaim:
+		if v, ok := claims[conf.Key].(string); ok {
+			name = v
+		}
+
+	default:
+
+		// The tenant of a path prefix is moved into the header by the handler
+		// returned from StripPrefix.
+		name = r.Header.Get(conf.Key)
+	}
+
+	if name == "" {
+		return "", "", ErrMissing
+	}
+
+	dbName, exists := conf.DBs[name]
+	if !exists {
+		return "", "", ErrNotFound
+	}
+
+	// The client picks the tenant of a header or path so the caller must be
+	// allowed to use it.
+	if conf.From != FromClaim && claims != nil && !conf.allowed(claims, name) {
+		return "", "", ErrDenied
+	}
+
+	return name, dbName, nil
+}
+
+// allowed reports if the claim of the caller names the tenant. The claim can
+// hold a single tenant or a list of them.
+func (conf *Config) allowed(claims map[string]interface{}, name string) bool {
+	key := conf.Claim
+	if key == "" {
+		key = DefaultClaim
+	}
+
+	switch v := claims[key].(type) {
+	case string:
+		return v == name
+
+	case []interface{}:
+		for _, t := range v {
+			if t == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// StripPrefix returns a handler that removes the tenant from the front of
+// the path, like /nyt/1.0/query, and provides it to Resolve through the
+// header. Any tenant header sent by the client is removed so it can not
+// select a database the path does not name.
+func StripPrefix(conf *Config, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(conf.Key)
+
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		idx := strings.Index(path, "/")
+		if idx == -1 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if name := path[:idx]; conf.DBs[name] != "" {
+			r.Header.Set(conf.Key, name)
+			r.URL.Path = path[idx:]
+
+			// The router matches routes against the request uri when it is set.
+			r.RequestURI = strings.TrimPrefix(r.RequestURI, "/"+name)
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CacheKey scopes the key of a cached value to the database of the tenant
+// so tenants sharing a service never see each others values.
+func CacheKey(db *db.DB, key string) string {
+	c, err := db.CollectionMGO("CacheKey", "")
+	if err != nil {
+		return key
+	}
+
+	return c.Database.Name + "/" + key
+}
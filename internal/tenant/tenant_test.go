@@ -0,0 +1,190 @@
+package tenant_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/tenant"
+)
+
+func init() {
+	tests.Init("XENIA")
+}
+
+// TestParse tests reading the list of tenants.
+func TestParse(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to read the list of tenants.")
+	{
+		t.Log("\tWhen the list is valid")
+		{
+			dbs, err := tenant.Parse("nyt:nyt_db, wapo:wapo_db,")
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to read the tenants : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to read the tenants.", tests.Success)
+
+			exp := map[string]string{"nyt": "nyt_db", "wapo": "wapo_db"}
+			if !reflect.DeepEqual(dbs, exp) {
+				t.Fatalf("\t%s\tShould get back the database of each tenant : %v", tests.Failed, dbs)
+			}
+			t.Logf("\t%s\tShould get back the database of each tenant.", tests.Success)
+		}
+
+		t.Log("\tWhen the list is invalid")
+		{
+			for _, tenants := range []string{"", "nyt", "nyt:", ":nyt_db", "nyt:nyt_db:extra"} {
+				if _, err := tenant.Parse(tenants); err == nil {
+					t.Fatalf("\t%s\tShould not be able to read the tenants %q.", tests.Failed, tenants)
+				}
+				t.Logf("\t%s\tShould not be able to read the tenants %q.", tests.Success, tenants)
+			}
+		}
+	}
+}
+
+// TestResolve tests resolving the tenant of a request.
+func TestResolve(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	dbs := map[string]string{"nyt": "nyt_db", "wapo": "wapo_db"}
+
+	t.Log("Given the need to resolve the tenant of a request.")
+	{
+		t.Log("\tWhen the tenant is in a header")
+		{
+			conf := tenant.Config{From: tenant.FromHeader, Key: tenant.DefaultHeader, DBs: dbs}
+
+			r, _ := http.NewRequest("GET", "/1.0/query", nil)
+			r.Header.Set(tenant.DefaultHeader, "nyt")
+
+			name, dbName, err := conf.Resolve(r, nil)
+			if err != nil || name != "nyt" || dbName != "nyt_db" {
+				t.Fatalf("\t%s\tShould resolve the nyt tenant : %s %s %v", tests.Failed, name, dbName, err)
+			}
+			t.Logf("\t%s\tShould resolve the nyt tenant.", tests.Success)
+
+			r.Header.Set(tenant.DefaultHeader, "unknown")
+			if _, _, err := conf.Resolve(r, nil); err != tenant.ErrNotFound {
+				t.Fatalf("\t%s\tShould not find an unknown tenant : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not find an unknown tenant.", tests.Success)
+
+			r.Header.Del(tenant.DefaultHeader)
+			if _, _, err := conf.Resolve(r, nil); err != tenant.ErrMissing {
+				t.Fatalf("\t%s\tShould require a tenant : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould require a tenant.", tests.Success)
+		}
+
+		t.Log("\tWhen the tenant is in a claim")
+		{
+			conf := tenant.Config{From: tenant.FromClaim, Key: tenant.DefaultClaim, DBs: dbs}
+
+			// A header must not be able to select the tenant.
+			r, _ := http.NewRequest("GET", "/1.0/query", nil)
+			r.Header.Set(tenant.DefaultClaim, "nyt")
+
+			claims := map[string]interface{}{"sub": "user", "tenant": "wapo"}
+
+			name, dbName, err := conf.Resolve(r, claims)
+			if err != nil || name != "wapo" || dbName != "wapo_db" {
+				t.Fatalf("\t%s\tShould resolve the wapo tenant : %s %s %v", tests.Failed, name, dbName, err)
+			}
+			t.Logf("\t%s\tShould resolve the wapo tenant.", tests.Success)
+
+			if _, _, err := conf.Resolve(r, nil); err != tenant.ErrMissing {
+				t.Fatalf("\t%s\tShould require a tenant without claims : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould require a tenant without claims.", tests.Success)
+		}
+
+		t.Log("\tWhen the tenant is in a header with authentication on")
+		{
+			conf := tenant.Config{From: tenant.FromHeader, Key: tenant.DefaultHeader, Claim: tenant.DefaultClaim, DBs: dbs}
+
+			r, _ := http.NewRequest("GET", "/1.0/query", nil)
+			r.Header.Set(tenant.DefaultHeader, "nyt")
+
+			claims := map[string]interface{}{"sub": "user", "tenant": "nyt"}
+			if name, _, err := conf.Resolve(r, claims); err != nil || name != "nyt" {
+				t.Fatalf("\t%s\tShould resolve the tenant of the caller : %s %v", tests.Failed, name, err)
+			}
+			t.Logf("\t%s\tShould resolve the tenant of the caller.", tests.Success)
+
+			claims = map[string]interface{}{"sub": "user", "tenant": []interface{}{"wapo", "nyt"}}
+			if name, _, err := conf.Resolve(r, claims); err != nil || name != "nyt" {
+				t.Fatalf("\t%s\tShould resolve one of the tenants of the caller : %s %v", tests.Failed, name, err)
+			}
+			t.Logf("\t%s\tShould resolve one of the tenants of the caller.", tests.Success)
+
+			for _, claims := range []map[string]interface{}{{"sub": "user", "tenant": "wapo"}, {"sub": "user"}} {
+				if _, _, err := conf.Resolve(r, claims); err != tenant.ErrDenied {
+					t.Fatalf("\t%s\tShould deny a tenant the caller is not allowed %v : %v", tests.Failed, claims, err)
+				}
+				t.Logf("\t%s\tShould deny a tenant the caller is not allowed %v.", tests.Success, claims)
+			}
+		}
+	}
+}
+
+// TestStripPrefix tests resolving the tenant from a prefix of the path.
+func TestStripPrefix(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	conf := tenant.Config{
+		From: tenant.FromPath,
+		Key:  tenant.DefaultHeader,
+		DBs:  map[string]string{"nyt": "nyt_db"},
+	}
+
+	var path, name string
+	h := tenant.StripPrefix(&conf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		name, _, _ = conf.Resolve(r, nil)
+	}))
+
+	t.Log("Given the need to resolve the tenant from a prefix of the path.")
+	{
+		table := []struct {
+			url    string
+			header string
+			path   string
+			name   string
+		}{
+			{"/nyt/1.0/query/basic", "", "/1.0/query/basic", "nyt"},
+			{"/nyt/1.0/query/basic", "wapo", "/1.0/query/basic", "nyt"},
+			{"/1.0/query/basic", "nyt", "/1.0/query/basic", ""},
+			{"/wapo/1.0/query/basic", "", "/wapo/1.0/query/basic", ""},
+		}
+
+		for _, tt := range table {
+			t.Logf("\tWhen requesting %q with the tenant header %q", tt.url, tt.header)
+			{
+				r, _ := http.NewRequest("GET", tt.url, nil)
+				if tt.header != "" {
+					r.Header.Set(tenant.DefaultHeader, tt.header)
+				}
+
+				h.ServeHTTP(httptest.NewRecorder(), r)
+
+				if path != tt.path {
+					t.Fatalf("\t%s\tShould route the path %q : %q", tests.Failed, tt.path, path)
+				}
+				t.Logf("\t%s\tShould route the path %q.", tests.Success, tt.path)
+
+				if name != tt.name {
+					t.Fatalf("\t%s\tShould resolve the tenant %q : %q", tests.Failed, tt.name, name)
+				}
+				t.Logf("\t%s\tShould resolve the tenant %q.", tests.Success, tt.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package token provides support for reading the claims of the JWT that
+// authenticates a request. Anvil only provides the standard claims once the
+// token is validated, the services need every claim to resolve the tenant of
+// a request and check the ACLs of the caller.
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// ErrMalformed is returned when the request does not hold a well formed JWT.
+var ErrMalformed = errors.New("Token is malformed")
+
+// Claims returns every claim of the JWT provided with the request. The JWT is
+// found the same way Anvil finds it and must already be validated.
+func Claims(r *http.Request) (map[string]interface{}, error) {
+	token := r.Form.Get("access_token")
+	if ah := r.Header.Get("Authorization"); len(ah) > 6 && strings.ToUpper(ah[0:7]) == "BEARER " {
+		token = ah[7:]
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	data, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
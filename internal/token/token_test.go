@@ -0,0 +1,67 @@
+package token_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/token"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func init() {
+	tests.Init("XENIA")
+}
+
+// TestClaims tests reading the claims of the JWT of a request.
+func TestClaims(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	tok := jwt.New(jwt.SigningMethodHS256)
+	tok.Claims["sub"] = "user1"
+	tok.Claims["tenant"] = "nyt"
+
+	signed, err := tok.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Signing token : %v", err)
+	}
+
+	t.Log("Given the need to read the claims of the JWT of a request.")
+	{
+		t.Log("\tWhen the token is in the Authorization header")
+		{
+			r, _ := http.NewRequest("GET", "/1.0/query", nil)
+			r.Header.Set("Authorization", "Bearer "+signed)
+
+			claims, err := token.Claims(r)
+			if err != nil || claims["sub"] != "user1" || claims["tenant"] != "nyt" {
+				t.Fatalf("\t%s\tShould read every claim : %v %v", tests.Failed, claims, err)
+			}
+			t.Logf("\t%s\tShould read every claim.", tests.Success)
+		}
+
+		t.Log("\tWhen the token is in the query string")
+		{
+			r, _ := http.NewRequest("GET", "/1.0/query?access_token="+signed, nil)
+			r.ParseForm()
+
+			claims, err := token.Claims(r)
+			if err != nil || claims["sub"] != "user1" {
+				t.Fatalf("\t%s\tShould read every claim : %v %v", tests.Failed, claims, err)
+			}
+			t.Logf("\t%s\tShould read every claim.", tests.Success)
+		}
+
+		t.Log("\tWhen the token is malformed")
+		{
+			r, _ := http.NewRequest("GET", "/1.0/query", nil)
+			r.Header.Set("Authorization", "Bearer abc")
+
+			if _, err := token.Claims(r); err != token.ErrMalformed {
+				t.Fatalf("\t%s\tShould report the malformed token : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould report the malformed token.", tests.Success)
+		}
+	}
+}
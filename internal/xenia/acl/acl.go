@@ -0,0 +1,196 @@
+// Package acl provides support for controlling who may execute and who may
+// edit the Sets, Scripts, Regexes and Masks. The caller of a request is
+// described by the claims of its JWT: the subject, the scopes and the roles.
+package acl
+
+import (
+	"context"
+	"strings"
+)
+
+// Set of claims the caller is described by.
+const (
+	ClaimSubject = "sub"
+	ClaimScope   = "scope"
+	ClaimRoles   = "roles"
+	ClaimAdmin   = "admin"
+)
+
+// RoleAdmin is the role of the callers administering the service, like
+// editing the policies.
+const RoleAdmin = "admin"
+
+// Set of prefixes naming the kind of an entry of an ACL.
+const (
+	KindSubject = "sub:"
+	KindScope   = "scope:"
+	KindRole    = "role:"
+)
+
+// ACL lists who may execute and who may edit a document. Each entry names
+// a subject, a scope or a role of the caller with its kind as a prefix, like
+// "sub:user1", "scope:query:read" or "role:editor". An entry without a kind
+// names no caller. An empty list allows every caller so documents saved
+// without an ACL remain open.
+type ACL struct {
+	Execute []string `bson:"execute,omitempty" json:"execute,omitempty"`
+	Edit    []string `bson:"edit,omitempty" json:"edit,omitempty"`
+}
+
+// CanExecute reports if the caller may execute the document. The editors of
+// a document may always execute it. A nil ACL or caller allows everything.
+func (acl *ACL) CanExecute(caller *Caller) bool {
+	if acl == nil || caller == nil {
+		return true
+	}
+
+	return caller.in(acl.Execute) || acl.CanEdit(caller)
+}
+
+// CanEdit reports if the caller may change or delete the document. A nil ACL
+// or caller allows everything.
+func (acl *ACL) CanEdit(caller *Caller) bool {
+	if acl == nil || caller == nil {
+		return true
+	}
+
+	return caller.in(acl.Edit)
+}
+
+//==============================================================================
+
+// Caller describes who is making a request.
+type Caller struct {
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+
+	Claims map[string]interface{} `json:"-"` // Every claim of the JWT.
+}
+
+// FromClaims returns the caller described by the claims of a JWT. The scope
+// claim is a space separated list and the roles claim is either a list or a
+// space separated list. A nil Caller is returned when there are no claims.
+func FromClaims(claims map[string]interface{}) *Caller {
+	if claims == nil {
+		return nil
+	}
+
+	caller := Caller{Claims: claims}
+
+	if v, ok := claims[ClaimSubject].(string); ok {
+		caller.Subject = v
+	}
+
+	if v, ok := claims[ClaimScope].(string); ok {
+		caller.Scopes = strings.Fields(v)
+	}
+
+	switch v := claims[ClaimRoles].(type) {
+	case string:
+		caller.Roles = strings.Fields(v)
+
+	case []interface{}:
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				caller.Roles = append(caller.Roles, s)
+			}
+		}
+	}
+
+	return &caller
+}
+
+// HasRole reports if the caller has the role. A nil Caller has no roles.
+func (caller *Caller) HasRole(role string) bool {
+	if caller == nil {
+		return false
+	}
+
+	return contains(caller.Roles, role)
+}
+
+// IsAdmin reports if the caller administers the service, either with the
+// admin role or with an admin claim set to true. A nil Caller is not an
+// admin.
+func (caller *Caller) IsAdmin() bool {
+	if caller == nil {
+		return false
+	}
+
+	if admin, ok := caller.Claims[ClaimAdmin].(bool); ok && admin {
+		return true
+	}
+
+	return caller.HasRole(RoleAdmin)
+}
+
+// in reports if the caller is named by the entries. An empty list names
+// every caller. Each kind of entry is only matched against the same kind of
+// the caller so a role can't be mistaken for a subject.
+func (caller *Caller) in(entries []string) bool {
+	if len(entries) == 0 {
+		return true
+	}
+
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry, KindSubject):
+			if caller.Subject != "" && entry[len(KindSubject):] == caller.Subject {
+				return true
+			}
+
+		case strings.HasPrefix(entry, KindScope):
+			if contains(caller.Scopes, entry[len(KindScope):]) {
+				return true
+			}
+
+		case strings.HasPrefix(entry, KindRole):
+			if contains(caller.Roles, entry[len(KindRole):]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// contains reports if the value is in the list.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+//==============================================================================
+
+// key is the type of the key the caller is stored under in a context.
+type key int
+
+// callerKey is the key the caller is stored under in a context.
+const callerKey key = 0
+
+// NewContext returns a context carrying the caller so the sets included
+// while executing a set can be checked.
+func NewContext(ctx context.Context, caller *Caller) context.Context {
+	if caller == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// FromContext returns the caller carried by the context, nil if there is
+// none.
+func FromContext(ctx context.Context) *Caller {
+	if ctx == nil {
+		return nil
+	}
+
+	caller, _ := ctx.Value(callerKey).(*Caller)
+	return caller
+}
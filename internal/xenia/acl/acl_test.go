@@ -0,0 +1,155 @@
+package acl_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+)
+
+func init() {
+	tests.Init("XENIA")
+}
+
+// TestFromClaims tests describing the caller from the claims of a JWT.
+func TestFromClaims(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to describe the caller from the claims of a JWT.")
+	{
+		t.Log("\tWhen the claims have a subject, scopes and roles")
+		{
+			claims := map[string]interface{}{
+				"sub":   "user1",
+				"scope": "openid query:read",
+				"roles": []interface{}{"editor", "reporter"},
+			}
+
+			exp := acl.Caller{
+				Subject: "user1",
+				Scopes:  []string{"openid", "query:read"},
+				Roles:   []string{"editor", "reporter"},
+				Claims:  claims,
+			}
+
+			if caller := acl.FromClaims(claims); caller == nil || !reflect.DeepEqual(*caller, exp) {
+				t.Fatalf("\t%s\tShould get back the caller : %+v", tests.Failed, caller)
+			}
+			t.Logf("\t%s\tShould get back the caller.", tests.Success)
+		}
+
+		t.Log("\tWhen there are no claims")
+		{
+			if caller := acl.FromClaims(nil); caller != nil {
+				t.Fatalf("\t%s\tShould not get back a caller : %+v", tests.Failed, caller)
+			}
+			t.Logf("\t%s\tShould not get back a caller.", tests.Success)
+		}
+	}
+}
+
+// TestACL tests checking who may execute and edit a document.
+func TestACL(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	doc := acl.ACL{
+		Execute: []string{"role:reporter", "scope:query:read"},
+		Edit:    []string{"role:editor", "sub:user9"},
+	}
+
+	table := []struct {
+		name    string
+		acl     *acl.ACL
+		caller  *acl.Caller
+		execute bool
+		edit    bool
+	}{
+		{"no ACL", nil, &acl.Caller{Subject: "user1"}, true, true},
+		{"no caller", &doc, nil, true, true},
+		{"empty ACL", &acl.ACL{}, &acl.Caller{Subject: "user1"}, true, true},
+		{"unlisted caller", &doc, &acl.Caller{Subject: "user1", Roles: []string{"guest"}}, false, false},
+		{"executing role", &doc, &acl.Caller{Subject: "user1", Roles: []string{"reporter"}}, true, false},
+		{"executing scope", &doc, &acl.Caller{Subject: "user1", Scopes: []string{"query:read"}}, true, false},
+		{"editing role", &doc, &acl.Caller{Subject: "user1", Roles: []string{"editor"}}, true, true},
+		{"editing subject", &doc, &acl.Caller{Subject: "user9"}, true, true},
+		{"role named like the subject", &doc, &acl.Caller{Subject: "user1", Roles: []string{"user9"}}, false, false},
+		{"subject named like the role", &doc, &acl.Caller{Subject: "editor"}, false, false},
+		{"scope named like the role", &doc, &acl.Caller{Subject: "user1", Scopes: []string{"reporter"}}, false, false},
+		{"entry without a kind", &acl.ACL{Edit: []string{"user9"}}, &acl.Caller{Subject: "user9"}, true, false},
+	}
+
+	t.Log("Given the need to check who may execute and edit a document.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen checking the %s", tt.name)
+			{
+				if got := tt.acl.CanExecute(tt.caller); got != tt.execute {
+					t.Fatalf("\t%s\tShould get %v for executing : %v", tests.Failed, tt.execute, got)
+				}
+				t.Logf("\t%s\tShould get %v for executing.", tests.Success, tt.execute)
+
+				if got := tt.acl.CanEdit(tt.caller); got != tt.edit {
+					t.Fatalf("\t%s\tShould get %v for editing : %v", tests.Failed, tt.edit, got)
+				}
+				t.Logf("\t%s\tShould get %v for editing.", tests.Success, tt.edit)
+			}
+		}
+	}
+}
+
+// TestIsAdmin tests checking if the caller administers the service.
+func TestIsAdmin(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	table := []struct {
+		name   string
+		caller *acl.Caller
+		admin  bool
+	}{
+		{"no caller", nil, false},
+		{"caller", &acl.Caller{Subject: "user1", Roles: []string{"editor"}}, false},
+		{"admin role", &acl.Caller{Subject: "user1", Roles: []string{"admin"}}, true},
+		{"admin claim", &acl.Caller{Subject: "user1", Claims: map[string]interface{}{"admin": true}}, true},
+		{"false admin claim", &acl.Caller{Subject: "user1", Claims: map[string]interface{}{"admin": false}}, false},
+		{"admin subject", &acl.Caller{Subject: "admin"}, false},
+	}
+
+	t.Log("Given the need to check if the caller administers the service.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen checking the %s", tt.name)
+			{
+				if got := tt.caller.IsAdmin(); got != tt.admin {
+					t.Fatalf("\t%s\tShould get %v : %v", tests.Failed, tt.admin, got)
+				}
+				t.Logf("\t%s\tShould get %v.", tests.Success, tt.admin)
+			}
+		}
+	}
+}
+
+// TestContext tests carrying the caller in a context.
+func TestContext(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to carry the caller in a context.")
+	{
+		caller := acl.Caller{Subject: "user1"}
+
+		if got := acl.FromContext(acl.NewContext(context.Background(), &caller)); got != &caller {
+			t.Fatalf("\t%s\tShould get back the caller : %+v", tests.Failed, got)
+		}
+		t.Logf("\t%s\tShould get back the caller.", tests.Success)
+
+		if got := acl.FromContext(acl.NewContext(context.Background(), nil)); got != nil {
+			t.Fatalf("\t%s\tShould not get back a caller : %+v", tests.Failed, got)
+		}
+		t.Logf("\t%s\tShould not get back a caller.", tests.Success)
+	}
+}
@@ -0,0 +1,135 @@
+package xenia
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// auditRate is the fraction of the executions of sets recorded in the audit
+// log. The audit log is off when it is zero.
+var auditRate float64
+
+// UseAudit records the executions of sets in the audit log. The rate is the
+// fraction of the executions that are recorded, 1 records every execution.
+// This should be called during initialization before any sets are executed.
+func UseAudit(rate float64) {
+	auditRate = rate
+}
+
+// sampleAudit returns the audit record for the execution of the set when
+// the execution is sampled, nil otherwise.
+func sampleAudit(ctx context.Context, context interface{}, set *query.Set) *audit.Record {
+	if auditRate <= 0 || (auditRate < 1 && rand.Float64() >= auditRate) {
+		return nil
+	}
+
+	rec := audit.Record{
+		Date:      time.Now().UTC(),
+		SessionID: fmt.Sprint(context),
+		Set:       set.Name,
+	}
+
+	if caller := acl.FromContext(ctx); caller != nil {
+		rec.Subject = caller.Subject
+	}
+
+	return &rec
+}
+
+// auditQuery returns the audit record of the outcome of a query.
+func auditQuery(name string, o outcome) audit.Query {
+	aq := audit.Query{
+		Name:     name,
+		Duration: millis(o.duration),
+		Docs:     len(o.result.Docs),
+		Skipped:  o.result.Skipped,
+	}
+
+	if o.err != nil {
+		aq.Error = o.err.Error()
+	}
+
+	return aq
+}
+
+// writeAudit completes the audit record with the result of the execution and
+// writes it to the audit log.
+func writeAudit(context interface{}, db *db.DB, set *query.Set, vars map[string]string, rec *audit.Record, r *query.Result) {
+	switch v := r.Results.(type) {
+	case bson.M:
+		if msg, ok := v["error"].(string); ok {
+			rec.Error = msg
+		}
+
+	case []docs:
+		for _, d := range v {
+			rec.Docs += len(d.Docs)
+		}
+
+	// Cached results are held as JSON.
+	case json.RawMessage:
+		var cached []docs
+		if err := json.Unmarshal(v, &cached); err == nil {
+			for _, d := range cached {
+				rec.Docs += len(d.Docs)
+			}
+		}
+	}
+
+	addAudit(context, db, set, vars, rec)
+}
+
+// addAudit completes the audit record with the duration and variables of the
+// execution and writes it to the audit log. Failing to write the record does
+// not fail the execution of the set.
+func addAudit(context interface{}, db *db.DB, set *query.Set, vars map[string]string, rec *audit.Record) {
+	rec.Duration = millis(time.Since(rec.Date))
+	rec.Vars = redactVars(set, vars)
+
+	if err := audit.Add(context, db, *rec); err != nil {
+		log.Error(context, "addAudit", err, "Writing audit record")
+	}
+}
+
+// redactVars returns the variables of the declared parameters of the set with
+// the values of the masked parameters redacted. Any other variable is left out
+// of the audit log.
+func redactVars(set *query.Set, vars map[string]string) map[string]string {
+	if len(vars) == 0 {
+		return nil
+	}
+
+	var redacted map[string]string
+	for _, p := range set.Params {
+		v, exists := vars[p.Name]
+		if !exists {
+			continue
+		}
+
+		if redacted == nil {
+			redacted = make(map[string]string)
+		}
+
+		if p.Masked {
+			v = audit.Redacted
+		}
+		redacted[p.Name] = v
+	}
+
+	return redacted
+}
+
+// millis returns the duration in milliseconds.
+func millis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
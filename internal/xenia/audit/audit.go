@@ -0,0 +1,134 @@
+// Package audit provides the service layer for the audit log of the sets
+// executed. The log is kept in a capped collection so the oldest records are
+// dropped once the collection reaches its size.
+package audit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Collection contains the name of the Mongo collection.
+const Collection = "query_audit"
+
+// DefaultLimit is the number of records retrieved when no limit is provided.
+const DefaultLimit = 100
+
+// Set of error variables.
+var (
+	ErrNotFound = errors.New("Audit records Not found")
+)
+
+// Size is the number of bytes the capped collection is created with. This
+// should be set during initialization before any records are added.
+var Size = 100 << 20
+
+// codeNamespaceExists is the code of the error Mongo returns when creating a
+// collection that already exists.
+const codeNamespaceExists = 48
+
+// =============================================================================
+
+// created holds the databases the capped collection is known to exist in.
+var created = struct {
+	sync.Mutex
+	dbs map[string]bool
+}{dbs: make(map[string]bool)}
+
+// create makes sure the capped collection exists in the database of the
+// collection. The collection is only created once per database.
+func create(context interface{}, c *mgo.Collection) error {
+	created.Lock()
+	defer created.Unlock()
+
+	if created.dbs[c.Database.Name] {
+		return nil
+	}
+
+	log.Dev(context, "create", "MGO : db.createCollection(%q, {capped: true, size: %d})", c.Name, Size)
+	err := c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: Size})
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == codeNamespaceExists {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	created.dbs[c.Database.Name] = true
+	return nil
+}
+
+// =============================================================================
+
+// Add writes the record to the audit log.
+func Add(context interface{}, db *db.DB, rec Record) error {
+	log.Dev(context, "Add", "Started : Set[%s] Subject[%s]", rec.Set, rec.Subject)
+
+	if rec.ID == "" {
+		rec.ID = bson.NewObjectId()
+	}
+
+	if rec.Date.IsZero() {
+		rec.Date = time.Now().UTC()
+	}
+
+	f := func(c *mgo.Collection) error {
+		if err := create(context, c); err != nil {
+			return err
+		}
+
+		log.Dev(context, "Add", "MGO : db.%s.insert(%s)", c.Name, mongo.Query(rec))
+		return c.Insert(rec)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		log.Error(context, "Add", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Add", "Completed")
+	return nil
+}
+
+// Get retrieves the records of the audit log matching the filter, newest
+// first.
+func Get(context interface{}, db *db.DB, filter Filter) ([]Record, error) {
+	log.Dev(context, "Get", "Started : Filter[%+v]", filter)
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	var recs []Record
+	f := func(c *mgo.Collection) error {
+		q := filter.query()
+		log.Dev(context, "Get", "MGO : db.%s.find(%s).sort({$natural: -1}).limit(%d)", c.Name, mongo.Query(q), limit)
+		return c.Find(q).Sort("-$natural").Limit(limit).All(&recs)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "Get", err, "Completed")
+		return nil, err
+	}
+
+	if recs == nil {
+		log.Error(context, "Get", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	log.Dev(context, "Get", "Completed : Records[%d]", len(recs))
+	return recs, nil
+}
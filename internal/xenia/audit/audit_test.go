@@ -0,0 +1,98 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/kit/cfg"
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func init() {
+	// Initialize the configuration and logging systems. Plus anything
+	// else the web app layer needs.
+	tests.Init("XENIA")
+
+	// Initialize MongoDB using the `tests.TestSession` as the name of the
+	// master session.
+	cfg := mongo.Config{
+		Host:     cfg.MustString("MONGO_HOST"),
+		AuthDB:   cfg.MustString("MONGO_AUTHDB"),
+		DB:       cfg.MustString("MONGO_DB"),
+		User:     cfg.MustString("MONGO_USER"),
+		Password: cfg.MustString("MONGO_PASS"),
+	}
+	tests.InitMongo(cfg)
+}
+
+//==============================================================================
+
+// TestAddRecords tests if we can write records to the audit log and read
+// them back.
+func TestAddRecords(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	// Records can't be removed from a capped collection so each run uses
+	// a set name of its own.
+	set := "QTEST_audit_" + bson.NewObjectId().Hex()
+
+	t.Log("Given the need to write records to the audit log.")
+	{
+		t.Log("\tWhen writing records for a set")
+		{
+			for _, subject := range []string{"user1", "user2", "user1"} {
+				rec := audit.Record{
+					SessionID: "session",
+					Subject:   subject,
+					Set:       set,
+					Vars:      map[string]string{"station_id": "42021"},
+					Queries:   []audit.Query{{Name: "Stations", Duration: 5, Docs: 1}},
+					Docs:      1,
+				}
+
+				if err := audit.Add(tests.Context, db, rec); err != nil {
+					t.Fatalf("\t%s\tShould be able to write a record : %v", tests.Failed, err)
+				}
+			}
+			t.Logf("\t%s\tShould be able to write the records.", tests.Success)
+
+			recs, err := audit.Get(tests.Context, db, audit.Filter{Set: set, Subject: "user1"})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to read the records : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to read the records.", tests.Success)
+
+			if len(recs) != 2 {
+				t.Fatalf("\t%s\tShould get back the records of the subject : %d", tests.Failed, len(recs))
+			}
+			t.Logf("\t%s\tShould get back the records of the subject.", tests.Success)
+
+			if recs[0].Date.Before(recs[1].Date) {
+				t.Fatalf("\t%s\tShould get back the newest record first.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back the newest record first.", tests.Success)
+
+			recs, err = audit.Get(tests.Context, db, audit.Filter{Set: set, Limit: 1})
+			if err != nil || len(recs) != 1 {
+				t.Fatalf("\t%s\tShould get back a single record : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get back a single record.", tests.Success)
+
+			if _, err := audit.Get(tests.Context, db, audit.Filter{Set: set, From: time.Now().Add(time.Hour)}); err != audit.ErrNotFound {
+				t.Fatalf("\t%s\tShould not get back records from the future : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not get back records from the future.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Redacted replaces the value of a masked variable in a record.
+const Redacted = "******"
+
+// Record contains the audit record of a single execution of a set.
+type Record struct {
+	ID        bson.ObjectId     `bson:"_id,omitempty" json:"id"`                    // Unique id of the record.
+	Date      time.Time         `bson:"date" json:"date"`                           // When the execution started.
+	SessionID string            `bson:"session_id" json:"session_id"`               // Session of the request executing the set.
+	Subject   string            `bson:"subject,omitempty" json:"subject,omitempty"` // Subject of the claims of the caller.
+	Set       string            `bson:"set" json:"set"`                             // Name of the set executed.
+	Vars      map[string]string `bson:"vars,omitempty" json:"vars,omitempty"`       // Variables of the execution, masked ones redacted.
+	Duration  int64             `bson:"duration_ms" json:"duration_ms"`             // Milliseconds the execution took.
+	Docs      int               `bson:"docs" json:"docs"`                           // Number of documents returned by the queries.
+	Cached    bool              `bson:"cached,omitempty" json:"cached,omitempty"`   // The results came from the cache.
+	Queries   []Query           `bson:"queries,omitempty" json:"queries,omitempty"` // Outcome of each query executed.
+	Error     string            `bson:"error,omitempty" json:"error,omitempty"`     // Error that failed the execution.
+}
+
+// Query contains the outcome of a single query within a record.
+type Query struct {
+	Name     string `bson:"name" json:"name"`                           // Name of the query.
+	Duration int64  `bson:"duration_ms" json:"duration_ms"`             // Milliseconds the query took.
+	Docs     int    `bson:"docs" json:"docs"`                           // Number of documents the query returned.
+	Skipped  bool   `bson:"skipped,omitempty" json:"skipped,omitempty"` // The query was skipped by its condition.
+	Error    string `bson:"error,omitempty" json:"error,omitempty"`     // Error that failed the query.
+}
+
+// Filter narrows the records retrieved from the audit log. Empty fields
+// match every record.
+type Filter struct {
+	Set       string    // Name of the set executed.
+	Subject   string    // Subject of the caller.
+	SessionID string    // Session of the request.
+	From      time.Time // Oldest execution to retrieve.
+	To        time.Time // Newest execution to retrieve.
+	Limit     int       // Most records to retrieve, DefaultLimit when zero.
+}
+
+// query returns the Mongo query for the filter.
+func (f Filter) query() bson.M {
+	q := bson.M{}
+
+	if f.Set != "" {
+		q["set"] = f.Set
+	}
+
+	if f.Subject != "" {
+		q["subject"] = f.Subject
+	}
+
+	if f.SessionID != "" {
+		q["session_id"] = f.SessionID
+	}
+
+	if !f.From.IsZero() || !f.To.IsZero() {
+		date := bson.M{}
+		if !f.From.IsZero() {
+			date["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			date["$lte"] = f.To
+		}
+		q["date"] = date
+	}
+
+	return q
+}
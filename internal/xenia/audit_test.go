@@ -0,0 +1,84 @@
+package xenia
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestAuditRecord tests building the audit record of an execution.
+func TestAuditRecord(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	set := query.Set{
+		Name:   "Audit",
+		Params: []query.Param{{Name: "station_id"}, {Name: "email", Masked: true}, {Name: "token", Masked: true}},
+	}
+
+	t.Log("Given the need to record an execution in the audit log.")
+	{
+		t.Log("\tWhen the execution is sampled")
+		{
+			defer UseAudit(auditRate)
+
+			UseAudit(0)
+			if rec := sampleAudit(context.Background(), tests.Context, &set); rec != nil {
+				t.Fatalf("\t%s\tShould not record executions with the audit log off : %+v", tests.Failed, rec)
+			}
+			t.Logf("\t%s\tShould not record executions with the audit log off.", tests.Success)
+
+			UseAudit(1)
+			ctx := acl.NewContext(context.Background(), &acl.Caller{Subject: "user1"})
+			rec := sampleAudit(ctx, tests.Context, &set)
+			if rec == nil || rec.Set != "Audit" || rec.Subject != "user1" {
+				t.Fatalf("\t%s\tShould record the set and the subject : %+v", tests.Failed, rec)
+			}
+			t.Logf("\t%s\tShould record the set and the subject.", tests.Success)
+		}
+
+		t.Log("\tWhen the set has masked parameters")
+		{
+			vars := map[string]string{"station_id": "42021", "email": "bill@example.com", "access_token": "secret"}
+			exp := map[string]string{"station_id": "42021", "email": audit.Redacted}
+
+			if got := redactVars(&set, vars); !reflect.DeepEqual(got, exp) {
+				t.Fatalf("\t%s\tShould redact the masked variables : %v", tests.Failed, got)
+			}
+			t.Logf("\t%s\tShould redact the masked variables.", tests.Success)
+
+			if _, exists := redactVars(&set, vars)["access_token"]; exists {
+				t.Fatalf("\t%s\tShould leave out the undeclared variables.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould leave out the undeclared variables.", tests.Success)
+
+			if vars["email"] != "bill@example.com" {
+				t.Fatalf("\t%s\tShould not change the variables : %v", tests.Failed, vars)
+			}
+			t.Logf("\t%s\tShould not change the variables.", tests.Success)
+		}
+
+		t.Log("\tWhen a query has run")
+		{
+			o := outcome{
+				result:   docs{Name: "Stations", Docs: []bson.M{{"station_id": "42021"}, {"station_id": "42022"}}},
+				err:      errors.New("Timedout executing commands"),
+				duration: 1500 * time.Millisecond,
+			}
+
+			exp := audit.Query{Name: "Stations", Duration: 1500, Docs: 2, Error: "Timedout executing commands"}
+			if got := auditQuery("Stations", o); !reflect.DeepEqual(got, exp) {
+				t.Fatalf("\t%s\tShould record the outcome of the query : %+v", tests.Failed, got)
+			}
+			t.Logf("\t%s\tShould record the outcome of the query.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package cache provides support for caching the results of executing
+// Sets. The results can be cached in memory or inside a Mongo collection
+// when several services need to share the same results.
+package cache
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+)
+
+// Set of error variables.
+var (
+	ErrNotFound = errors.New("Result Not found")
+)
+
+// Cache is the behavior required to store and retrieve the results of
+// executing Sets. The results are stored as their JSON encoding.
+type Cache interface {
+	Get(context interface{}, db *db.DB, key string) ([]byte, error)
+	Set(context interface{}, db *db.DB, set string, key string, data []byte, ttl time.Duration) error
+	Purge(context interface{}, db *db.DB, set string) error
+}
+
+// Key returns the key for caching the result of executing the set with the
+// specified variables. If names is empty, all the variables are used.
+func Key(set string, vars map[string]string, names []string) string {
+	v := make(url.Values)
+
+	if len(names) == 0 {
+		for name, value := range vars {
+			v.Set(name, value)
+		}
+	} else {
+		for _, name := range names {
+			v.Set(name, vars[name])
+		}
+	}
+
+	// Encode sorts the variables by name so the key is consistent.
+	return set + "?" + v.Encode()
+}
@@ -0,0 +1,157 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/kit/cfg"
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/cache"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// prefix is what we are looking to delete after the test.
+const prefix = "CTEST_O"
+
+func init() {
+	// Initialize the configuration and logging systems. Plus anything
+	// else the web app layer needs.
+	tests.Init("XENIA")
+
+	// Initialize MongoDB using the `tests.TestSession` as the name of the
+	// master session.
+	cfg := mongo.Config{
+		Host:     cfg.MustString("MONGO_HOST"),
+		AuthDB:   cfg.MustString("MONGO_AUTHDB"),
+		DB:       cfg.MustString("MONGO_DB"),
+		User:     cfg.MustString("MONGO_USER"),
+		Password: cfg.MustString("MONGO_PASS"),
+	}
+	tests.InitMongo(cfg)
+}
+
+//==============================================================================
+
+// TestKey tests the keys generated for the different variables.
+func TestKey(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	keys := []struct {
+		vars  map[string]string
+		names []string
+		key   string
+	}{
+		{nil, nil, "set?"},
+		{map[string]string{"b": "2", "a": "1"}, nil, "set?a=1&b=2"},
+		{map[string]string{"b": "2", "a": "1"}, []string{"b"}, "set?b=2"},
+		{map[string]string{"a": "1"}, []string{"a", "c"}, "set?a=1&c="},
+		{map[string]string{"a": "x&y"}, nil, "set?a=x%26y"},
+	}
+
+	t.Log("Given the need to generate cache keys.")
+	{
+		for _, k := range keys {
+			t.Logf("\tWhen using %v with %v", k.vars, k.names)
+			{
+				if key := cache.Key("set", k.vars, k.names); key != k.key {
+					t.Errorf("\t%s\tShould get back the expected key %q : %q", tests.Failed, k.key, key)
+					continue
+				}
+				t.Logf("\t%s\tShould get back the expected key.", tests.Success)
+			}
+		}
+	}
+}
+
+// TestCache tests storing, retrieving and purging results.
+func TestCache(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	defer func() {
+		f := func(c *mgo.Collection) error {
+			_, err := c.RemoveAll(bson.M{"set": bson.RegEx{Pattern: prefix}})
+			return err
+		}
+
+		if err := db.ExecuteMGO(tests.Context, cache.Collection, f); err != nil {
+			t.Fatalf("\t%s\tShould be able to remove the cached results : %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to remove the cached results.", tests.Success)
+	}()
+
+	caches := []struct {
+		name  string
+		cache cache.Cache
+	}{
+		{"Memory", cache.NewMemory()},
+		{"Mongo", cache.NewMongo()},
+	}
+
+	set := prefix + "_set"
+	key1 := cache.Key(set, map[string]string{"a": "1"}, nil)
+	key2 := cache.Key(set, map[string]string{"a": "2"}, nil)
+	key3 := cache.Key(set, map[string]string{"a": "3"}, nil)
+
+	t.Log("Given the need to cache results.")
+	{
+		for _, c := range caches {
+			t.Logf("\tWhen using the %s cache", c.name)
+			{
+				if _, err := c.cache.Get(tests.Context, db, key1); err != cache.ErrNotFound {
+					t.Fatalf("\t%s\tShould not find a result before it is cached : %v", tests.Failed, err)
+				}
+				t.Logf("\t%s\tShould not find a result before it is cached.", tests.Success)
+
+				if err := c.cache.Set(tests.Context, db, set, key1, []byte(`[1]`), time.Minute); err != nil {
+					t.Fatalf("\t%s\tShould be able to cache a result : %v", tests.Failed, err)
+				}
+				if err := c.cache.Set(tests.Context, db, set, key2, []byte(`[2]`), time.Minute); err != nil {
+					t.Fatalf("\t%s\tShould be able to cache a result : %v", tests.Failed, err)
+				}
+				if err := c.cache.Set(tests.Context, db, set, key3, []byte(`[3]`), time.Millisecond); err != nil {
+					t.Fatalf("\t%s\tShould be able to cache a result : %v", tests.Failed, err)
+				}
+				t.Logf("\t%s\tShould be able to cache results.", tests.Success)
+
+				data, err := c.cache.Get(tests.Context, db, key2)
+				if err != nil {
+					t.Fatalf("\t%s\tShould be able to retrieve a cached result : %v", tests.Failed, err)
+				}
+				t.Logf("\t%s\tShould be able to retrieve a cached result.", tests.Success)
+
+				if string(data) != `[2]` {
+					t.Fatalf("\t%s\tShould get back the cached result for the key : %s", tests.Failed, data)
+				}
+				t.Logf("\t%s\tShould get back the cached result for the key.", tests.Success)
+
+				time.Sleep(10 * time.Millisecond)
+
+				if _, err := c.cache.Get(tests.Context, db, key3); err != cache.ErrNotFound {
+					t.Fatalf("\t%s\tShould not find a result once it expires : %v", tests.Failed, err)
+				}
+				t.Logf("\t%s\tShould not find a result once it expires.", tests.Success)
+
+				if err := c.cache.Purge(tests.Context, db, set); err != nil {
+					t.Fatalf("\t%s\tShould be able to purge the results : %v", tests.Failed, err)
+				}
+				t.Logf("\t%s\tShould be able to purge the results.", tests.Success)
+
+				if _, err := c.cache.Get(tests.Context, db, key1); err != cache.ErrNotFound {
+					t.Fatalf("\t%s\tShould not find a result once it is purged : %v", tests.Failed, err)
+				}
+				t.Logf("\t%s\tShould not find a result once it is purged.", tests.Success)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/tenant"
+	gc "github.com/patrickmn/go-cache"
+)
+
+// cleanup is how often expired results are removed from memory.
+const cleanup = time.Minute
+
+// Memory provides an in-process cache of results. The results of each tenant
+// are kept apart by scoping the keys to the database.
+type Memory struct {
+	cache *gc.Cache
+
+	mu   sync.Mutex
+	sets map[string]map[string]struct{}
+}
+
+// NewMemory creates an in-process cache for results.
+func NewMemory() *Memory {
+	m := Memory{
+		cache: gc.New(gc.NoExpiration, cleanup),
+		sets:  make(map[string]map[string]struct{}),
+	}
+
+	// Remove the keys from the set index when results expire.
+	m.cache.OnEvicted(func(key string, _ interface{}) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		set := setFromKey(key)
+		delete(m.sets[set], key)
+		if len(m.sets[set]) == 0 {
+			delete(m.sets, set)
+		}
+	})
+
+	return &m
+}
+
+// Get retrieves the result stored under the key.
+func (m *Memory) Get(context interface{}, db *db.DB, key string) ([]byte, error) {
+	key = tenant.CacheKey(db, key)
+
+	v, found := m.cache.Get(key)
+	if !found {
+		log.Dev(context, "Memory.Get", "Completed : MISS : Key[%s]", key)
+		return nil, ErrNotFound
+	}
+
+	log.Dev(context, "Memory.Get", "Completed : HIT : Key[%s]", key)
+	return v.([]byte), nil
+}
+
+// Set stores the result under the key for the duration of the ttl.
+func (m *Memory) Set(context interface{}, db *db.DB, set string, key string, data []byte, ttl time.Duration) error {
+	set = tenant.CacheKey(db, set)
+	key = tenant.CacheKey(db, key)
+
+	m.mu.Lock()
+	{
+		if m.sets[set] == nil {
+			m.sets[set] = make(map[string]struct{})
+		}
+		m.sets[set][key] = struct{}{}
+	}
+	m.mu.Unlock()
+
+	m.cache.Set(key, data, ttl)
+
+	log.Dev(context, "Memory.Set", "Completed : Key[%s] TTL[%v]", key, ttl)
+	return nil
+}
+
+// Purge removes all the results stored for the set.
+func (m *Memory) Purge(context interface{}, db *db.DB, set string) error {
+	set = tenant.CacheKey(db, set)
+
+	var keys []string
+
+	m.mu.Lock()
+	{
+		for key := range m.sets[set] {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.Unlock()
+
+	// Deleting the results will update the set index.
+	for _, key := range keys {
+		m.cache.Delete(key)
+	}
+
+	log.Dev(context, "Memory.Purge", "Completed : Set[%s] Results[%d]", set, len(keys))
+	return nil
+}
+
+// setFromKey extracts the name of the set from the key.
+func setFromKey(key string) string {
+	if idx := strings.LastIndexByte(key, '?'); idx != -1 {
+		return key[:idx]
+	}
+
+	return key
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Collection contains the name of the Mongo collection for cached results.
+const Collection = "query_sets_cache"
+
+// result is the document stored in Mongo for a cached result.
+type result struct {
+	Key     string    `bson:"key"`
+	Set     string    `bson:"set"`
+	Data    []byte    `bson:"data"`
+	Expires time.Time `bson:"expires"`
+}
+
+// Mongo provides a cache of results stored in a Mongo collection so the
+// results can be shared between services.
+type Mongo struct {
+	mu  sync.Mutex
+	dbs map[string]bool // Databases the indexes are known to exist in.
+}
+
+// NewMongo creates a cache for results stored in Mongo.
+func NewMongo() *Mongo {
+	return &Mongo{}
+}
+
+// Get retrieves the result stored under the key.
+func (m *Mongo) Get(context interface{}, db *db.DB, key string) ([]byte, error) {
+	var r result
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"key": key, "expires": bson.M{"$gt": time.Now().UTC()}}
+		log.Dev(context, "Mongo.Get", "MGO : db.%s.findOne(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).One(&r)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		if err == mgo.ErrNotFound {
+			log.Dev(context, "Mongo.Get", "Completed : MISS : Key[%s]", key)
+			return nil, ErrNotFound
+		}
+
+		log.Error(context, "Mongo.Get", err, "Completed")
+		return nil, err
+	}
+
+	log.Dev(context, "Mongo.Get", "Completed : HIT : Key[%s]", key)
+	return r.Data, nil
+}
+
+// Set stores the result under the key for the duration of the ttl.
+func (m *Mongo) Set(context interface{}, db *db.DB, set string, key string, data []byte, ttl time.Duration) error {
+	m.ensureIndexes(context, db)
+
+	r := result{
+		Key:     key,
+		Set:     set,
+		Data:    data,
+		Expires: time.Now().Add(ttl).UTC(),
+	}
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"key": key}
+		log.Dev(context, "Mongo.Set", "MGO : db.%s.upsert(%s, {...})", c.Name, mongo.Query(q))
+		_, err := c.Upsert(q, &r)
+		return err
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		log.Error(context, "Mongo.Set", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Mongo.Set", "Completed : Key[%s] TTL[%v]", key, ttl)
+	return nil
+}
+
+// Purge removes all the results stored for the set.
+func (m *Mongo) Purge(context interface{}, db *db.DB, set string) error {
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"set": set}
+		log.Dev(context, "Mongo.Purge", "MGO : db.%s.remove(%s)", c.Name, mongo.Query(q))
+		_, err := c.RemoveAll(q)
+		return err
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		log.Error(context, "Mongo.Purge", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Mongo.Purge", "Completed : Set[%s]", set)
+	return nil
+}
+
+// ensureIndexes creates the indexes for looking up results by key and for
+// Mongo to remove the results once they expire. The indexes are created
+// once for each database the results are stored in.
+func (m *Mongo) ensureIndexes(context interface{}, db *db.DB) {
+	f := func(c *mgo.Collection) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.dbs[c.Database.Name] {
+			return nil
+		}
+
+		idxs := []mgo.Index{
+			{Key: []string{"key"}, Unique: true},
+			{Key: []string{"set"}},
+			{Key: []string{"expires"}, ExpireAfter: time.Second},
+		}
+
+		for _, idx := range idxs {
+			log.Dev(context, "ensureIndexes", "MGO : db.%s.ensureindex(%s)", c.Name, mongo.Query(idx))
+			if err := c.EnsureIndex(idx); err != nil {
+				return err
+			}
+		}
+
+		if m.dbs == nil {
+			m.dbs = make(map[string]bool)
+		}
+		m.dbs[c.Database.Name] = true
+
+		return nil
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		log.Error(context, "ensureIndexes", err, "Completed")
+	}
+}
@@ -0,0 +1,100 @@
+package xenia
+
+import (
+	"context"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// noCancel is used when the execution of a set can't be cancelled.
+var noCancel = context.Background()
+
+// clientAddr returns the address the server sees for the connection the
+// session is using. The operations started by the session can be found
+// on the server by this address.
+func clientAddr(context interface{}, ses *mgo.Session) string {
+	var res struct {
+		You string `bson:"you"`
+	}
+
+	if err := ses.Run("whatsmyuri", &res); err != nil {
+		log.Error(context, "clientAddr", err, "Getting client address")
+		return ""
+	}
+
+	return res.You
+}
+
+// killOps kills the operations running on the server for the client whose
+// address is sent on the channel. The operations are killed in the
+// background since the function may still be waiting to start them.
+func killOps(context interface{}, db *db.DB, client <-chan string) {
+
+	// We need a session of our own since the DB value will be closed
+	// once the set completes.
+	var ses *mgo.Session
+	db.ExecuteMGO(context, "", func(c *mgo.Collection) error {
+		ses = c.Database.Session.Copy()
+		return nil
+	})
+
+	if ses == nil {
+		return
+	}
+
+	go func() {
+		defer ses.Close()
+
+		addr := <-client
+		if addr == "" {
+			return
+		}
+
+		admin := ses.DB("admin")
+
+		var res struct {
+			InProg []struct {
+				OpID interface{} `bson:"opid"`
+			} `bson:"inprog"`
+		}
+
+		if err := admin.Run(bson.D{{Name: "currentOp", Value: 1}, {Name: "client", Value: addr}}, &res); err != nil {
+			log.Error(context, "killOps", err, "Finding operations : Client[%s]", addr)
+			return
+		}
+
+		for _, op := range res.InProg {
+			log.Dev(context, "killOps", "Killing operation : Client[%s] OpID[%v]", addr, op.OpID)
+
+			if err := admin.Run(bson.D{{Name: "killOp", Value: 1}, {Name: "op", Value: op.OpID}}, nil); err != nil {
+				log.Error(context, "killOps", err, "Killing operation : OpID[%v]", op.OpID)
+			}
+		}
+	}()
+}
+
+// aggregate executes the pipeline like mgo.Pipe.Iter but limits how long
+// the server can run the pipeline with maxTimeMS.
+func aggregate(c *mgo.Collection, pipeline []bson.M, maxTime time.Duration) *mgo.Iter {
+	cmd := bson.D{
+		{Name: "aggregate", Value: c.Name},
+		{Name: "pipeline", Value: pipeline},
+		{Name: "cursor", Value: bson.M{}},
+		{Name: "maxTimeMS", Value: int64(maxTime / time.Millisecond)},
+	}
+
+	var res struct {
+		Cursor struct {
+			FirstBatch []bson.Raw `bson:"firstBatch"`
+			ID         int64      `bson:"id"`
+		} `bson:"cursor"`
+	}
+
+	err := c.Database.Run(cmd, &res)
+
+	return c.NewIter(nil, res.Cursor.FirstBatch, res.Cursor.ID, err)
+}
@@ -0,0 +1,111 @@
+package xenia_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+)
+
+// TestExecCancel tests cancelling the execution of a set.
+func TestExecCancel(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	t.Log("Given the need to load the test data.")
+	{
+		loadTestData(t, db)
+	}
+
+	defer func() {
+		t.Log("Given the need to unload the test data.")
+		{
+			unloadTestData(t, db)
+		}
+	}()
+
+	set := query.Set{
+		Name:    "Cancel",
+		Enabled: true,
+		Queries: []query.Query{
+			{
+				Name:       "Cancel",
+				Type:       "pipeline",
+				Collection: tstdata.CollectionExecTest,
+				Return:     true,
+				Commands: []map[string]interface{}{
+					{"$match": map[string]interface{}{"$where": "sleep(1000) || true"}},
+				},
+			},
+		},
+	}
+
+	t.Log("Given the need to cancel the execution of a set.")
+	{
+		t.Logf("\tWhen using Execute Set %s", set.Name)
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			result := xenia.ExecContext(ctx, tests.Context, db, &set, nil, false)
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to marshal the result : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to marshal the result.", tests.Success)
+
+			if !strings.Contains(string(data), `"error":"Cancelled executing commands"`) {
+				t.Log("Got:", string(data))
+				t.Fatalf("\t%s\tShould get the cancelled error.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the cancelled error.", tests.Success)
+		}
+
+		t.Log("\tWhen a query of the wave fails")
+		{
+			wave := query.Set{
+				Name:    "Cancel Wave",
+				Enabled: true,
+				Queries: []query.Query{
+					set.Queries[0],
+					{
+						Name:       "Cancel Invalid",
+						Type:       "find",
+						Collection: tstdata.CollectionExecTest,
+						Return:     true,
+						Commands: []map[string]interface{}{
+							{"fields": 1},
+						},
+					},
+				},
+			}
+
+			result := xenia.ExecContext(context.Background(), tests.Context, db, &wave, nil, false)
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to marshal the result : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to marshal the result.", tests.Success)
+
+			if !strings.Contains(string(data), `"error":"Invalid find option \"fields\""`) {
+				t.Log("Got:", string(data))
+				t.Fatalf("\t%s\tShould get the error of the failed query.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the error of the failed query.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package xenia
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// execCount executes the specified count query. The result is a single
+// document with the number of documents that matched the filter.
+func execCount(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
+
+	// {"filter": {"station_id": "#string:station_id"}}
+	// Result: [{"count": 1}]
+
+	// If the last command is a $save, capture its value and remove
+	// it from the commands.
+	commands, save := extractSave(q)
+
+	// A count query is made up of a single command document.
+	if len(commands) != 1 {
+		return docs{}, commands, errors.New("Invalid count script, expecting a single command")
+	}
+
+	// Do we have variables to be substitued.
+	if vars != nil {
+		if err := processVariables(context, commands[0], vars, opts.types, opts.claims(), data); err != nil {
+			return docs{}, commands, err
+		}
+	}
+
+	var filter map[string]interface{}
+	for key, value := range commands[0] {
+		switch key {
+		case "filter":
+			doc, err := cmdDoc(value)
+			if err != nil {
+				log.Error(context, "execCount", err, "Checking filter")
+				return docs{}, commands, err
+			}
+			filter = doc
+
+		default:
+			err := fmt.Errorf("Invalid count option %q", key)
+			log.Error(context, "execCount", err, "Checking options")
+			return docs{}, commands, err
+		}
+	}
+
+	// Apply the policies of the collection for the caller.
+	filter, err := applyFilterPolicies(context, db, q.Collection, commands[0], filter, opts)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Do we want the final commands without executing them.
+	if opts.dryRun {
+		return dryRun(q, commands, save, data), commands, nil
+	}
+
+	// Do we want the explain output.
+	if opts.explain {
+		m, err := explainFilter(context, db, q, filter)
+		if err != nil {
+			return docs{}, commands, err
+		}
+
+		return docs{Name: q.Name, Docs: []bson.M{m}}, commands, nil
+	}
+
+	// Build the count function for the execution.
+	var count int
+	f := func(c *mgo.Collection) error {
+		log.Dev(context, "execCount", "MGO Started\ndb.%s.count(%s)", c.Name, mongo.Query(filter))
+
+		var err error
+		count, err = c.Find(filter).Count()
+		return err
+	}
+
+	// Execute the count.
+	if err := execTimeout(context, opts.ctx, db, q, f); err != nil {
+		return docs{}, commands, err
+	}
+
+	log.Dev(context, "execCount", "Completed")
+
+	// Check the result against the limits of the set.
+	results := []bson.M{{"count": count}}
+	if err := opts.limits.checkDocs(q, results); err != nil {
+		return docs{}, commands, err
+	}
+
+	// Perform any masking and saving that is required.
+	results, err = processResults(context, db, q, save, results, data, true)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Emit the results when they are being streamed.
+	if err := emitResults(opts.emit, results); err != nil {
+		return docs{}, commands, err
+	}
+
+	return docs{Name: q.Name, Docs: results}, commands, nil
+}
+
+// explainFilter returns the explain output for finding documents with the
+// specified filter. This is used by query types that Mongo can't explain
+// directly.
+func explainFilter(context interface{}, db *db.DB, q *query.Query, filter map[string]interface{}) (bson.M, error) {
+	var m bson.M
+	f := func(c *mgo.Collection) error {
+		log.Dev(context, "explainFilter", "MGO Explain :\ndb.%s.find(%s)", c.Name, mongo.Query(filter))
+		return c.Find(filter).Explain(&m)
+	}
+
+	if err := db.ExecuteMGO(context, q.Collection, f); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
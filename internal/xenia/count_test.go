@@ -0,0 +1,206 @@
+package xenia_test
+
+import (
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+)
+
+// getCountExecSet returns the table for the testing.
+func getCountExecSet() []execSet {
+	return []execSet{
+		countBasic(),
+		countVars(),
+		countSaveVar(),
+		distinctBasic(),
+		distinctSaveIn(),
+		distinctMissingField(),
+	}
+}
+
+// countBasic performs a simple count query.
+func countBasic() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Count Basic",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Count Basic",
+					Type:       "count",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"filter": map[string]interface{}{"flag": true}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Count Basic","Docs":[{"count":28}]}]}`,
+		},
+	}
+}
+
+// countVars performs a count query with variables.
+func countVars() execSet {
+	return execSet{
+		fail: false,
+		vars: map[string]string{"station_id": "42021"},
+		set: &query.Set{
+			Name:    "Count Vars",
+			Enabled: true,
+			Params: []query.Param{
+				{Name: "station_id"},
+			},
+			Queries: []query.Query{
+				{
+					Name:       "Count Vars",
+					Type:       "count",
+					Collection: tstdata.CollectionExecTest,
+					Timeout:    "5s",
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"filter": map[string]interface{}{"station_id": "#string:station_id"}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Count Vars","Docs":[{"count":1}]}]}`,
+		},
+	}
+}
+
+// countSaveVar performs a count query where the result is saved and used
+// in a variable replacement.
+func countSaveVar() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Count Save Var",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Count",
+					Type:       "count",
+					Collection: tstdata.CollectionExecTest,
+					Return:     false,
+					Commands: []map[string]interface{}{
+						{"filter": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44008"}}}},
+						{"$save": map[string]interface{}{"$map": "total"}},
+					},
+				},
+				{
+					Name:       "Get Documents",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44005", "44008"}}}},
+						{"$sort": map[string]interface{}{"station_id": 1}},
+						{"$limit": "#data.0:total.count"},
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Get Documents","Docs":[{"name":"C14 - Pasco County Buoy, FL"},{"name":"GULF OF MAINE 78 NM EAST OF PORTSMOUTH,NH"}]}]}`,
+		},
+	}
+}
+
+// distinctBasic performs a simple distinct query on an embedded field.
+func distinctBasic() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Distinct Basic",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Distinct Basic",
+					Type:       "distinct",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{
+							"field":  "condition.wind_dir",
+							"filter": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44005", "44008"}}},
+						},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Distinct Basic","Docs":[{"wind_dir":"North"},{"wind_dir":"Northwest"}]}]}`,
+			`{"results":[{"Name":"Distinct Basic","Docs":[{"wind_dir":"Northwest"},{"wind_dir":"North"}]}]}`,
+		},
+	}
+}
+
+// distinctSaveIn performs a distinct query where the result is saved and
+// used in an $in statement.
+func distinctSaveIn() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Distinct Save In",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Get Ids",
+					Type:       "distinct",
+					Collection: tstdata.CollectionExecTest,
+					Return:     false,
+					Commands: []map[string]interface{}{
+						{
+							"field":  "station_id",
+							"filter": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44008"}}},
+						},
+						{"$save": map[string]interface{}{"$map": "list"}},
+					},
+				},
+				{
+					Name:       "Get Documents",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": "#data.*:list.station_id"}}},
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Get Documents","Docs":[{"name":"C14 - Pasco County Buoy, FL"},{"name":"NANTUCKET 54NM Southeast of Nantucket"}]}]}`,
+		},
+	}
+}
+
+// distinctMissingField performs a distinct query without a field.
+func distinctMissingField() execSet {
+	return execSet{
+		fail: true,
+		set: &query.Set{
+			Name:    "Distinct Missing Field",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Distinct Missing Field",
+					Type:       "distinct",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"filter": map[string]interface{}{"station_id": "42021"}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":{"commands":[{"filter":{"station_id":"42021"}}],"error":"Distinct field is missing"}}`,
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package xenia
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/kit/log"
+)
+
+// dateExpr evaluates a date expression. The expression starts with the date
+// to work from followed by terms that are applied from left to right:
+//
+//	now                 The current date/time.
+//	since               The date in the since variable.
+//	2013-01-16          A literal date.
+//	+30d -2h            Add or subtract an amount of time. The units are
+//	                    s, m, h, d, w, M (months) and y.
+//	@America/New_York   Use the time zone for the terms that follow.
+//	/d                  Truncate to the start of the unit. The units are
+//	                    m, h, d, w (weeks start on Monday), M and y.
+//
+// The start of this week in New York is "now @America/New_York /w" and the
+// since variable minus 30 days is "since -30d". The date is returned in UTC.
+func dateExpr(context interface{}, expr string, vars map[string]string, now time.Time) (time.Time, error) {
+	terms := strings.Fields(expr)
+	if len(terms) == 0 {
+		err := fmt.Errorf("Invalid date expression %q", expr)
+		log.Error(context, "dateExpr", err, "Parsing expression")
+		return time.Time{}, err
+	}
+
+	// Find the date we are working from.
+	t := now.UTC()
+	if base := terms[0]; base != "now" {
+		value, exists := vars[base]
+		if !exists {
+			value = base
+		}
+
+		var err error
+		if t, err = parseDate(value); err != nil {
+			log.Error(context, "dateExpr", err, "Parsing date")
+			return time.Time{}, err
+		}
+	}
+
+	// Apply the terms in order.
+	for _, term := range terms[1:] {
+		var err error
+
+		switch term[0] {
+		case '@':
+			var loc *time.Location
+			if loc, err = time.LoadLocation(term[1:]); err == nil {
+				t = t.In(loc)
+			}
+
+		case '/':
+			t, err = truncDate(t, term[1:])
+
+		case '+', '-':
+			t, err = addDate(t, term)
+
+		default:
+			err = fmt.Errorf("Invalid date expression term %q", term)
+		}
+
+		if err != nil {
+			log.Error(context, "dateExpr", err, "Applying term %q", term)
+			return time.Time{}, err
+		}
+	}
+
+	return t.UTC(), nil
+}
+
+// parseDate parses a date in any of the layouts dates can be provided in.
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Value %q is not a date", value)
+}
+
+// addDate adds the signed amount of time in the term to the date. Days and
+// larger units are added on the calendar of the date's time zone.
+func addDate(t time.Time, term string) (time.Time, error) {
+	l := len(term) - 1
+
+	n, err := strconv.Atoi(term[:l])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date amount %q", term)
+	}
+
+	switch term[l] {
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), nil
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 'h':
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 'd':
+		return t.AddDate(0, 0, n), nil
+	case 'w':
+		return t.AddDate(0, 0, 7*n), nil
+	case 'M':
+		return t.AddDate(0, n, 0), nil
+	case 'y':
+		return t.AddDate(n, 0, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid date unit in %q", term)
+}
+
+// truncDate truncates the date to the start of the unit in the date's time
+// zone.
+func truncDate(t time.Time, unit string) (time.Time, error) {
+	y, M, d := t.Date()
+	loc := t.Location()
+
+	switch unit {
+	case "m":
+		return time.Date(y, M, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+	case "h":
+		return time.Date(y, M, d, t.Hour(), 0, 0, 0, loc), nil
+	case "d":
+		return time.Date(y, M, d, 0, 0, 0, 0, loc), nil
+	case "w":
+		days := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, M, d-days, 0, 0, 0, 0, loc), nil
+	case "M":
+		return time.Date(y, M, 1, 0, 0, 0, 0, loc), nil
+	case "y":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid date unit %q", unit)
+}
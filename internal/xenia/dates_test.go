@@ -0,0 +1,70 @@
+package xenia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/kit/tests"
+)
+
+// TestDateExpr tests evaluating date expressions.
+func TestDateExpr(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	// A Thursday in New York standard time.
+	now := time.Date(2016, 3, 10, 15, 30, 20, 0, time.UTC)
+
+	vars := map[string]string{"since": "2016-03-31"}
+
+	exprs := []struct {
+		expr string
+		exp  string
+		fail bool
+	}{
+		{"now", "2016-03-10T15:30:20Z", false},
+		{"now /d", "2016-03-10T00:00:00Z", false},
+		{"now -2h /h", "2016-03-10T13:00:00Z", false},
+		{"now /w", "2016-03-07T00:00:00Z", false},
+		{"now @America/New_York /w", "2016-03-07T05:00:00Z", false},
+		{"now @America/New_York /d +1d", "2016-03-11T05:00:00Z", false},
+		{"since -30d", "2016-03-01T00:00:00Z", false},
+		{"2016-01-15 +1M /M", "2016-02-01T00:00:00Z", false},
+		{"2016-01-15T10:00:00.000Z +1y /y", "2017-01-01T00:00:00Z", false},
+		{"now +5q", "", true},
+		{"now @Nowhere/City", "", true},
+		{"now ~1d", "", true},
+		{"yesterday", "", true},
+		{"", "", true},
+	}
+
+	t.Log("Given the need to evaluate date expressions.")
+	{
+		for _, e := range exprs {
+			t.Logf("\tWhen using the expression %q", e.expr)
+			{
+				d, err := dateExpr(tests.Context, e.expr, vars, now)
+				if e.fail {
+					if err == nil {
+						t.Errorf("\t%s\tShould not be able to evaluate the expression : %v", tests.Failed, d)
+						continue
+					}
+					t.Logf("\t%s\tShould not be able to evaluate the expression.", tests.Success)
+					continue
+				}
+
+				if err != nil {
+					t.Errorf("\t%s\tShould be able to evaluate the expression : %v", tests.Failed, err)
+					continue
+				}
+				t.Logf("\t%s\tShould be able to evaluate the expression.", tests.Success)
+
+				if got := d.Format(time.RFC3339); got != e.exp {
+					t.Errorf("\t%s\tShould get back %s : %s", tests.Failed, e.exp, got)
+					continue
+				}
+				t.Logf("\t%s\tShould get back %s.", tests.Success, e.exp)
+			}
+		}
+	}
+}
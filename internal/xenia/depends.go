@@ -0,0 +1,193 @@
+package xenia
+
+import (
+	"strings"
+
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// queryWaves groups the queries of a set into waves that can be executed
+// one after the other. The queries within a wave have no dependencies on
+// each other and can be executed concurrently. The index of each query
+// in the set is returned, keeping the order of the queries in each wave.
+func queryWaves(queries []query.Query) [][]int {
+	levels := make([]int, len(queries))
+
+	var waves [][]int
+	for i := range queries {
+
+		// A query must run after every earlier query it depends on.
+		level := 0
+		for _, j := range queryDepends(queries, i) {
+			if levels[j]+1 > level {
+				level = levels[j] + 1
+			}
+		}
+		levels[i] = level
+
+		if level == len(waves) {
+			waves = append(waves, nil)
+		}
+		waves[level] = append(waves[level], i)
+	}
+
+	return waves
+}
+
+// queryDepends returns the indexes of the earlier queries in the set the
+// specified query depends on.
+func queryDepends(queries []query.Query, i int) []int {
+	q := &queries[i]
+
+	reads, readsAll := dataRefs(q)
+	saves := savedNames(q)
+	barrier := isBarrier(q)
+
+	var depends []int
+	for j := 0; j < i; j++ {
+		p := &queries[j]
+
+		// Queries that have side effects outside of the set must
+		// run in order with every other query.
+		if barrier || isBarrier(p) {
+			depends = append(depends, j)
+			continue
+		}
+
+		pReads, pReadsAll := dataRefs(p)
+		pSaves := savedNames(p)
+
+		switch {
+
+		// Do we read a result the earlier query saves.
+		case len(pSaves) > 0 && (readsAll || intersects(reads, pSaves)):
+			depends = append(depends, j)
+
+		// Do we save a result the earlier query saves or reads.
+		case len(saves) > 0 && (pReadsAll || intersects(saves, pSaves) || intersects(saves, pReads)):
+			depends = append(depends, j)
+		}
+	}
+
+	return depends
+}
+
+// savedNames returns the names of the results the query saves.
+func savedNames(q *query.Query) []string {
+	_, save := extractSave(q)
+
+	var names []string
+	if name, ok := save["$map"].(string); ok {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// dataRefs returns the names of the saved results the query reads. If the
+// query reads saved results in a way that can't be analysed, like from a
+// template, all is returned as true.
+func dataRefs(q *query.Query) (names []string, all bool) {
+	if q.When != nil && q.When.Data != "" {
+		names = append(names, q.When.Data)
+	}
+
+	for _, command := range q.Commands {
+		n, a := docDataRefs(command)
+		names = append(names, n...)
+		all = all || a
+	}
+
+	return names, all
+}
+
+// docDataRefs walks the document looking for references to saved results.
+func docDataRefs(doc map[string]interface{}) (names []string, all bool) {
+	for key, value := range doc {
+		n, a := valueDataRefs(key, value)
+		names = append(names, n...)
+		all = all || a
+	}
+
+	return names, all
+}
+
+// valueDataRefs looks for references to saved results within the value.
+func valueDataRefs(key string, value interface{}) (names []string, all bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return docDataRefs(v)
+
+	case bson.M:
+		return docDataRefs(v)
+
+	case []interface{}:
+		for _, sub := range v {
+			n, a := valueDataRefs(key, sub)
+			names = append(names, n...)
+			all = all || a
+		}
+		return names, all
+
+	case string:
+
+		// Templates can access the saved results in any way.
+		if key == "$template" {
+			return nil, strings.Contains(v, ".Data")
+		}
+
+		// {"field": "#data.0:list.station_id"}
+		for {
+			idx := strings.Index(v, "#data.")
+			if idx == -1 {
+				return names, false
+			}
+			v = v[idx+1:]
+
+			colon := strings.IndexByte(v, ':')
+			if colon == -1 {
+				return names, false
+			}
+
+			name := v[colon+1:]
+			if dot := strings.IndexByte(name, '.'); dot != -1 {
+				name = name[:dot]
+			}
+			names = append(names, name)
+		}
+	}
+
+	return nil, false
+}
+
+// isBarrier returns true when the query has side effects outside of the
+// set, like writing to a collection. Set queries are barriers since the set
+// they include can have side effects.
+func isBarrier(q *query.Query) bool {
+	if q.Type == query.TypeSet {
+		return true
+	}
+
+	for _, command := range q.Commands {
+		if _, exists := command["$out"]; exists {
+			return true
+		}
+	}
+
+	_, save := extractSave(q)
+	return isCollectionSave(save)
+}
+
+// intersects returns true if the two lists share a value.
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,160 @@
+package xenia
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
+)
+
+// TestQueryWaves tests the grouping of queries based on their dependencies.
+func TestQueryWaves(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	save := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$save": map[string]interface{}{"$map": name}}
+	}
+
+	match := map[string]interface{}{"$match": map[string]interface{}{"station_id": "42021"}}
+	matchIn := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": "#data.*:" + name + ".station_id"}}}
+	}
+
+	sets := []struct {
+		name    string
+		queries []query.Query
+		waves   [][]int
+	}{
+		{
+			"Independent",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match}},
+				{Commands: []map[string]interface{}{match}},
+				{Commands: []map[string]interface{}{match}},
+			},
+			[][]int{{0, 1, 2}},
+		},
+		{
+			"Save And Read",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match, save("list")}},
+				{Commands: []map[string]interface{}{match}},
+				{Commands: []map[string]interface{}{matchIn("list")}},
+			},
+			[][]int{{0, 1}, {2}},
+		},
+		{
+			"Chain",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match, save("a")}},
+				{Commands: []map[string]interface{}{matchIn("a"), save("b")}},
+				{Commands: []map[string]interface{}{matchIn("b")}},
+				{Commands: []map[string]interface{}{matchIn("a")}},
+			},
+			[][]int{{0}, {1, 3}, {2}},
+		},
+		{
+			"Save Overwrite",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match, save("list")}},
+				{Commands: []map[string]interface{}{match, save("list")}},
+			},
+			[][]int{{0}, {1}},
+		},
+		{
+			"Data Variable",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match, save("station")}},
+				{Commands: []map[string]interface{}{{"$match": map[string]interface{}{"station_id": "#data.0:station.station_id"}}}},
+			},
+			[][]int{{0}, {1}},
+		},
+		{
+			"Template",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match, save("list")}},
+				{Commands: []map[string]interface{}{{"$template": `{"$match": {"station_id": {{json (index .Data.list 0).station_id}}}}`}}},
+			},
+			[][]int{{0}, {1}},
+		},
+		{
+			"Out",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match}},
+				{Commands: []map[string]interface{}{match, {"$out": "other"}}},
+				{Commands: []map[string]interface{}{match}},
+			},
+			[][]int{{0}, {1}, {2}},
+		},
+		{
+			"When",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match, save("list")}},
+				{Commands: []map[string]interface{}{match}, When: &query.When{Data: "list"}},
+			},
+			[][]int{{0}, {1}},
+		},
+		{
+			"Save Collection",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match}},
+				{Commands: []map[string]interface{}{match, {"$save": map[string]interface{}{"$collection": "other"}}}},
+				{Commands: []map[string]interface{}{match}},
+			},
+			[][]int{{0}, {1}, {2}},
+		},
+		{
+			"Set",
+			[]query.Query{
+				{Commands: []map[string]interface{}{match}},
+				{Type: query.TypeSet, Commands: []map[string]interface{}{{"name": "other"}}},
+				{Commands: []map[string]interface{}{match}},
+			},
+			[][]int{{0}, {1}, {2}},
+		},
+	}
+
+	t.Log("Given the need to group queries by their dependencies.")
+	{
+		for _, set := range sets {
+			t.Logf("\tWhen using the %q queries", set.name)
+			{
+				waves := queryWaves(set.queries)
+				if !reflect.DeepEqual(waves, set.waves) {
+					t.Log("Exp:", set.waves)
+					t.Log("Got:", waves)
+					t.Errorf("\t%s\tShould get back the expected waves.", tests.Failed)
+					continue
+				}
+				t.Logf("\t%s\tShould get back the expected waves.", tests.Success)
+			}
+		}
+	}
+}
+
+// TestCopyDBs tests getting a session for each query of a wave.
+func TestCopyDBs(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to get a session for each query of a wave.")
+	{
+		t.Log("\tWhen the wave has a single query")
+		{
+			if dbs, err := copyDBs(tests.Context, nil, 1); dbs != nil || err != nil {
+				t.Fatalf("\t%s\tShould use the session of the set : %v %v", tests.Failed, dbs, err)
+			}
+			t.Logf("\t%s\tShould use the session of the set.", tests.Success)
+		}
+
+		t.Log("\tWhen the queries can't get sessions of their own")
+		{
+			if dbs, err := copyDBs(tests.Context, nil, 3); dbs != nil || err == nil {
+				t.Fatalf("\t%s\tShould report the queries must be executed one at a time : %v", tests.Failed, dbs)
+			}
+			t.Logf("\t%s\tShould report the queries must be executed one at a time.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package xenia
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// execDistinct executes the specified distinct query. Each distinct value is
+// returned as a document keyed by the last part of the field name so the
+// results can be masked and used by #data lookups like any other result.
+func execDistinct(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
+
+	// {"field": "condition.wind_dir", "filter": {"flag": true}}
+	// Result: [{"wind_dir": "North"}, {"wind_dir": "Northwest"}]
+
+	// If the last command is a $save, capture its value and remove
+	// it from the commands.
+	commands, save := extractSave(q)
+
+	// A distinct query is made up of a single command document.
+	if len(commands) != 1 {
+		return docs{}, commands, errors.New("Invalid distinct script, expecting a single command")
+	}
+
+	// Do we have variables to be substitued.
+	if vars != nil {
+		if err := processVariables(context, commands[0], vars, opts.types, opts.claims(), data); err != nil {
+			return docs{}, commands, err
+		}
+	}
+
+	var field string
+	var filter map[string]interface{}
+	for key, value := range commands[0] {
+		switch key {
+		case "field":
+			fld, ok := value.(string)
+			if !ok || fld == "" {
+				err := fmt.Errorf("Distinct field \"%v\" is a %T but must be a string", value, value)
+				log.Error(context, "execDistinct", err, "Checking field")
+				return docs{}, commands, err
+			}
+			field = fld
+
+		case "filter":
+			doc, err := cmdDoc(value)
+			if err != nil {
+				log.Error(context, "execDistinct", err, "Checking filter")
+				return docs{}, commands, err
+			}
+			filter = doc
+
+		default:
+			err := fmt.Errorf("Invalid distinct option %q", key)
+			log.Error(context, "execDistinct", err, "Checking options")
+			return docs{}, commands, err
+		}
+	}
+
+	if field == "" {
+		err := errors.New("Distinct field is missing")
+		log.Error(context, "execDistinct", err, "Checking field")
+		return docs{}, commands, err
+	}
+
+	// Apply the policies of the collection for the caller.
+	filter, err := applyFilterPolicies(context, db, q.Collection, commands[0], filter, opts)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Do we want the final commands without executing them.
+	if opts.dryRun {
+		return dryRun(q, commands, save, data), commands, nil
+	}
+
+	// Do we want the explain output.
+	if opts.explain {
+		m, err := explainFilter(context, db, q, filter)
+		if err != nil {
+			return docs{}, commands, err
+		}
+
+		return docs{Name: q.Name, Docs: []bson.M{m}}, commands, nil
+	}
+
+	// Build the distinct function for the execution.
+	var values []interface{}
+	f := func(c *mgo.Collection) error {
+		log.Dev(context, "execDistinct", "MGO Started\ndb.%s.distinct(%q, %s)", c.Name, field, mongo.Query(filter))
+		return c.Find(filter).Distinct(field, &values)
+	}
+
+	// Execute the distinct.
+	if err := execTimeout(context, opts.ctx, db, q, f); err != nil {
+		return docs{}, commands, err
+	}
+
+	log.Dev(context, "execDistinct", "Completed")
+
+	// Convert the values into documents.
+	var results []bson.M
+	if values != nil {
+		key := field
+		if idx := strings.LastIndexByte(field, '.'); idx != -1 {
+			key = field[idx+1:]
+		}
+
+		results = make([]bson.M, len(values))
+		for i, v := range values {
+			results[i] = bson.M{key: v}
+		}
+	}
+
+	// Check the results against the limits of the set.
+	if err := opts.limits.checkDocs(q, results); err != nil {
+		return docs{}, commands, err
+	}
+
+	// Perform any masking and saving that is required.
+	results, err = processResults(context, db, q, save, results, data, true)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Emit the results when they are being streamed.
+	if err := emitResults(opts.emit, results); err != nil {
+		return docs{}, commands, err
+	}
+
+	return docs{Name: q.Name, Docs: results}, commands, nil
+}
@@ -0,0 +1,62 @@
+package xenia
+
+import (
+	"strings"
+
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// placeholder stands in for a result saved with $map during a dry run since
+// no documents are read.
+type placeholder string
+
+// dryRun returns the document describing the final commands of the query
+// instead of executing them. A result the query saves with $map is replaced
+// with a placeholder for the queries that follow.
+func dryRun(q *query.Query, commands interface{}, save map[string]interface{}, data map[string]interface{}) docs {
+
+	// [{"name": "query name", "type": "pipeline", "collection": "name", "commands": [...], "save": {"$map": "list"}}]
+
+	doc := bson.M{
+		"name":       q.Name,
+		"type":       q.Type,
+		"collection": q.Collection,
+		"commands":   commands,
+	}
+
+	if save != nil {
+		doc["save"] = save
+
+		if name, ok := save["$map"].(string); ok {
+			data[name] = placeholder(name)
+		}
+	}
+
+	return docs{Name: q.Name, Docs: []bson.M{doc}}
+}
+
+// dryRunLookup returns the placeholder value for a lookup against a result
+// saved during a dry run. False is returned when the result is not a
+// placeholder.
+func dryRunLookup(dataOp, lookup string, results map[string]interface{}) (interface{}, bool) {
+
+	// Before: {"field" : {"$in": "#data.*:list.station_id"}}}	After: {"field" : {"$in": ["{#data.*:list.station_id}"]}}
+	// Before: {"field" : "#data.0:list.station_id"}				After: {"field" : "{#data.0:list.station_id}"}
+
+	key := lookup
+	if idx := strings.IndexByte(lookup, '.'); idx != -1 {
+		key = lookup[0:idx]
+	}
+
+	if _, ok := results[key].(placeholder); !ok {
+		return nil, false
+	}
+
+	value := "{#data." + dataOp + ":" + lookup + "}"
+	if dataOp == "*" {
+		return []interface{}{value}, true
+	}
+
+	return value, true
+}
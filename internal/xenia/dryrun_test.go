@@ -0,0 +1,106 @@
+package xenia
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestDryRun tests the final commands of a set are returned without
+// executing them.
+func TestDryRun(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	empty := false
+
+	set := query.Set{
+		Name:    "Dry Run",
+		Enabled: true,
+		DryRun:  true,
+		Params:  []query.Param{{Name: "station_id"}, {Name: "limit", Type: query.ParamInt}},
+		Queries: []query.Query{
+			{
+				Name:       "Stations",
+				Type:       "pipeline",
+				Collection: "test_xenia_data",
+				Commands: []map[string]interface{}{
+					{"$match": map[string]interface{}{"station_id": "#string:station_id"}},
+					{"$limit": "#string:limit"},
+					{"$save": map[string]interface{}{"$map": "list"}},
+				},
+			},
+			{
+				Name:       "Names",
+				Type:       "find",
+				Collection: "test_xenia_data",
+				When:       &query.When{Data: "list", Empty: &empty},
+				Commands: []map[string]interface{}{
+					{"filter": map[string]interface{}{
+						"station_id": map[string]interface{}{"$in": "#data.*:list.station_id"},
+						"name":       "#data.0:list.name",
+					}},
+				},
+				Return: true,
+			},
+		},
+	}
+
+	vars := map[string]string{"station_id": "42021", "limit": "5"}
+
+	t.Log("Given the need to see the final commands of a set.")
+	{
+		t.Log("\tWhen executing the set as a dry run")
+		{
+			result := Exec(tests.Context, nil, &set, vars)
+			if m, ok := result.Results.(bson.M); ok {
+				t.Fatalf("\t%s\tShould be able to execute the set : %v", tests.Failed, m["error"])
+			}
+			t.Logf("\t%s\tShould be able to execute the set.", tests.Success)
+
+			data, err := json.Marshal(result.Results)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to marshal the results : %v", tests.Failed, err)
+			}
+
+			exp := `[{"Name":"Names","Docs":[{"collection":"test_xenia_data","commands":[{"filter":{"name":"{#data.0:list.name}","station_id":{"$in":["{#data.*:list.station_id}"]}}}],"name":"Names","type":"find"}]}]`
+			if string(data) != exp {
+				t.Log(string(data))
+				t.Fatalf("\t%s\tShould get back the commands with placeholders for the saved results.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back the commands with placeholders for the saved results.", tests.Success)
+		}
+
+		t.Log("\tWhen returning the commands of a pipeline")
+		{
+			set.Queries[0].Return = true
+			set.Queries[0].Commands = []map[string]interface{}{
+				{"$match": map[string]interface{}{"station_id": "#string:station_id"}},
+				{"$limit": "#string:limit"},
+				{"$save": map[string]interface{}{"$map": "list"}},
+			}
+
+			result := Exec(tests.Context, nil, &set, vars)
+			res, ok := result.Results.([]docs)
+			if !ok || len(res) != 2 {
+				t.Fatalf("\t%s\tShould get back the commands of both queries : %v", tests.Failed, result.Results)
+			}
+			t.Logf("\t%s\tShould get back the commands of both queries.", tests.Success)
+
+			data, err := json.Marshal(res[0].Docs)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to marshal the commands : %v", tests.Failed, err)
+			}
+
+			exp := `[{"collection":"test_xenia_data","commands":[{"$match":{"station_id":"42021"}},{"$limit":5}],"name":"Stations","save":{"$map":"list"},"type":"pipeline"}]`
+			if string(data) != exp {
+				t.Log(string(data))
+				t.Fatalf("\t%s\tShould get back the substituted commands and the save.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back the substituted commands and the save.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// CSV writes the tables as CSV. The columns are the union of the columns of
+// the tables and when there is more than one table, a query column is added
+// first with the name of the query each row belongs to. The query column is
+// prefixed with underscores when the documents have a query field. Values
+// that spreadsheets would run as formulas are escaped with a quote.
+func CSV(w io.Writer, tables []Table) error {
+	fields := make(map[string]bool)
+	for _, t := range tables {
+		for _, column := range t.Columns {
+			fields[column] = true
+		}
+	}
+
+	var columns []string
+	for field := range fields {
+		columns = append(columns, field)
+	}
+	sort.Strings(columns)
+
+	multi := len(tables) > 1
+	if multi {
+		columns = append([]string{queryColumn(fields)}, columns...)
+	}
+
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[column] = i
+	}
+
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(escapeFormulas(append([]string{}, columns...))); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		for _, row := range t.Rows {
+			record := make([]string, len(columns))
+			if multi {
+				record[0] = t.Name
+			}
+
+			for i, column := range t.Columns {
+				record[index[column]] = format(row[i])
+			}
+
+			if err := cw.Write(escapeFormulas(record)); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// queryColumn returns the name of the query column that does not collide
+// with the columns of the documents.
+func queryColumn(fields map[string]bool) string {
+	name := "query"
+	for fields[name] {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// escapeFormulas escapes the values of the record that start like a formula
+// by prefixing them with a quote. Numbers are left as they are.
+func escapeFormulas(record []string) []string {
+	for i, value := range record {
+		if value == "" {
+			continue
+		}
+
+		switch value[0] {
+		case '=', '+', '-', '@', '\t', '\r':
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				record[i] = "'" + value
+			}
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,141 @@
+// Package export provides support for converting the results of executing
+// Sets into tabular formats like CSV and XLSX. Each query that returns
+// results becomes a table where nested documents are flattened into dotted
+// column names and arrays are joined into a single value.
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotResults is returned when the data is not the results of a Set,
+// such as when the Set failed to execute.
+var ErrNotResults = errors.New("Data does not contain results")
+
+// Docs represents the documents returned by a query of a Set.
+type Docs struct {
+	Name string
+	Docs []map[string]interface{}
+}
+
+// Table represents the documents of a query flattened into rows of values.
+// The values are strings, float64, bool or nil.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Decode decodes the JSON encoding of the results of executing a Set.
+func Decode(data []byte) ([]Docs, error) {
+	var res struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	var docs []Docs
+	if err := json.Unmarshal(res.Results, &docs); err != nil {
+		return nil, ErrNotResults
+	}
+
+	return docs, nil
+}
+
+// Tables flattens the documents of each query into a table. The columns are
+// the union of the fields of the documents ordered by name.
+func Tables(docs []Docs) []Table {
+	tables := make([]Table, len(docs))
+
+	for i, d := range docs {
+		rows := make([]map[string]interface{}, len(d.Docs))
+		fields := make(map[string]bool)
+
+		for j, doc := range d.Docs {
+			rows[j] = make(map[string]interface{})
+			flatten("", doc, rows[j])
+
+			for field := range rows[j] {
+				fields[field] = true
+			}
+		}
+
+		t := Table{Name: d.Name}
+
+		for field := range fields {
+			t.Columns = append(t.Columns, field)
+		}
+		sort.Strings(t.Columns)
+
+		for _, row := range rows {
+			values := make([]interface{}, len(t.Columns))
+			for k, column := range t.Columns {
+				values[k] = row[column]
+			}
+			t.Rows = append(t.Rows, values)
+		}
+
+		tables[i] = t
+	}
+
+	return tables
+}
+
+// flatten adds the fields of the document to the row using dotted names for
+// the fields of embedded documents.
+func flatten(prefix string, doc map[string]interface{}, row map[string]interface{}) {
+	for key, value := range doc {
+		name := prefix + key
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(name+".", v, row)
+
+		case []interface{}:
+			row[name] = join(v)
+
+		default:
+			row[name] = v
+		}
+	}
+}
+
+// join converts the values of an array into a single value. Documents and
+// arrays within the array are written as JSON.
+func join(values []interface{}) string {
+	strs := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			data, _ := json.Marshal(v)
+			strs[i] = string(data)
+
+		default:
+			strs[i] = format(v)
+		}
+	}
+
+	return strings.Join(strs, ", ")
+}
+
+// format converts a value into its string form.
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -0,0 +1,176 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/export"
+)
+
+// results is the JSON encoding of the results of executing a set.
+const results = `{"results":[
+	{"Name":"Stations","Docs":[
+		{"name":"C14","station_id":"42021","location":{"type":"Point","coordinates":[-82.9,28.5]},"active":true},
+		{"name":"NANTUCKET, \"54NM\"","station_id":"44008","count":12.5}
+	]},
+	{"Name":"Count","Docs":[{"count":2}]}
+]}`
+
+// TestCSV tests converting the results of a set into CSV.
+func TestCSV(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to convert results into CSV.")
+	{
+		docs, err := export.Decode([]byte(results))
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to decode the results : %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to decode the results.", tests.Success)
+
+		t.Log("\tWhen converting the results of a single query")
+		{
+			var b bytes.Buffer
+			if err := export.CSV(&b, export.Tables(docs[:1])); err != nil {
+				t.Fatalf("\t%s\tShould be able to write the CSV : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to write the CSV.", tests.Success)
+
+			exp := "active,count,location.coordinates,location.type,name,station_id\n" +
+				"true,,\"'-82.9, 28.5\",Point,C14,42021\n" +
+				",12.5,,,\"NANTUCKET, \"\"54NM\"\"\",44008\n"
+
+			if b.String() != exp {
+				t.Log("Exp:", exp)
+				t.Log("Got:", b.String())
+				t.Fatalf("\t%s\tShould get flattened columns and joined arrays.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get flattened columns and joined arrays.", tests.Success)
+		}
+
+		t.Log("\tWhen converting the results of several queries")
+		{
+			var b bytes.Buffer
+			if err := export.CSV(&b, export.Tables(docs)); err != nil {
+				t.Fatalf("\t%s\tShould be able to write the CSV : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to write the CSV.", tests.Success)
+
+			lines := strings.Split(b.String(), "\n")
+
+			if lines[0] != "query,active,count,location.coordinates,location.type,name,station_id" {
+				t.Log("Got:", lines[0])
+				t.Fatalf("\t%s\tShould get the query column first.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the query column first.", tests.Success)
+
+			if lines[3] != "Count,,2,,,," {
+				t.Log("Got:", lines[3])
+				t.Fatalf("\t%s\tShould get the rows of each query.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the rows of each query.", tests.Success)
+		}
+
+		t.Log("\tWhen the documents have a query field and formulas")
+		{
+			data := `{"results":[
+				{"Name":"Orders","Docs":[{"query":"=HYPERLINK(\"http://example.com\")","total":-5}]},
+				{"Name":"Users","Docs":[{"name":"@SUM(A1)"}]}
+			]}`
+
+			fdocs, err := export.Decode([]byte(data))
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to decode the results : %v", tests.Failed, err)
+			}
+
+			var b bytes.Buffer
+			if err := export.CSV(&b, export.Tables(fdocs)); err != nil {
+				t.Fatalf("\t%s\tShould be able to write the CSV : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to write the CSV.", tests.Success)
+
+			exp := "_query,name,query,total\n" +
+				"Orders,,\"'=HYPERLINK(\"\"http://example.com\"\")\",-5\n" +
+				"Users,'@SUM(A1),,\n"
+
+			if b.String() != exp {
+				t.Log("Exp:", exp)
+				t.Log("Got:", b.String())
+				t.Fatalf("\t%s\tShould get a separate query column and escaped formulas.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get a separate query column and escaped formulas.", tests.Success)
+		}
+
+		t.Log("\tWhen converting an error result")
+		{
+			if _, err := export.Decode([]byte(`{"results":{"error":"Set disabled"}}`)); err != export.ErrNotResults {
+				t.Fatalf("\t%s\tShould not be able to decode the results : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not be able to decode the results.", tests.Success)
+		}
+	}
+}
+
+// TestXLSX tests converting the results of a set into XLSX.
+func TestXLSX(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to convert results into XLSX.")
+	{
+		docs, err := export.Decode([]byte(results))
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to decode the results : %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to decode the results.", tests.Success)
+
+		t.Log("\tWhen converting the results of several queries")
+		{
+			var b bytes.Buffer
+			if err := export.XLSX(&b, export.Tables(docs)); err != nil {
+				t.Fatalf("\t%s\tShould be able to write the XLSX : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to write the XLSX.", tests.Success)
+
+			zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to read the workbook : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to read the workbook.", tests.Success)
+
+			files := make(map[string]string)
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("\t%s\tShould be able to open %s : %v", tests.Failed, f.Name, err)
+				}
+				data, _ := ioutil.ReadAll(rc)
+				rc.Close()
+				files[f.Name] = string(data)
+			}
+
+			if !strings.Contains(files["xl/workbook.xml"], `<sheet name="Stations" sheetId="1" r:id="rId1"/><sheet name="Count" sheetId="2" r:id="rId2"/>`) {
+				t.Log("Got:", files["xl/workbook.xml"])
+				t.Fatalf("\t%s\tShould get a worksheet per query.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get a worksheet per query.", tests.Success)
+
+			if !strings.Contains(files["xl/worksheets/sheet1.xml"], `<c r="E3" t="inlineStr"><is><t xml:space="preserve">NANTUCKET, &#34;54NM&#34;</t></is></c>`) {
+				t.Log("Got:", files["xl/worksheets/sheet1.xml"])
+				t.Fatalf("\t%s\tShould get escaped string cells.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get escaped string cells.", tests.Success)
+
+			if !strings.Contains(files["xl/worksheets/sheet2.xml"], `<c r="A2"><v>2</v></c>`) {
+				t.Log("Got:", files["xl/worksheets/sheet2.xml"])
+				t.Fatalf("\t%s\tShould get number cells.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get number cells.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XLSX writes the tables as an XLSX workbook with a worksheet per table.
+func XLSX(w io.Writer, tables []Table) error {
+	zw := zip.NewWriter(w)
+
+	names := sheetNames(tables)
+
+	var sheets, rels, types bytes.Buffer
+	for i, name := range names {
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+
+	files := []struct {
+		name string
+		data string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` + types.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`},
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(fw, f.data); err != nil {
+			return err
+		}
+	}
+
+	for i, t := range tables {
+		fw, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+
+		if err := writeSheet(fw, t); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeSheet writes the worksheet for the table. The first row contains the
+// column names.
+func writeSheet(w io.Writer, t Table) error {
+	var b bytes.Buffer
+
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	writeRow(&b, 1, stringValues(t.Columns))
+	for i, row := range t.Rows {
+		writeRow(&b, i+2, row)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// writeRow writes the cells of the row. Numbers and booleans keep their
+// type while everything else is written as an inline string.
+func writeRow(b *bytes.Buffer, r int, values []interface{}) {
+	fmt.Fprintf(b, `<row r="%d">`, r)
+
+	for i, value := range values {
+		ref := cellRef(i, r)
+
+		switch v := value.(type) {
+		case nil:
+			continue
+
+		case float64:
+			fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+
+		case bool:
+			n := 0
+			if v {
+				n = 1
+			}
+			fmt.Fprintf(b, `<c r="%s" t="b"><v>%d</v></c>`, ref, n)
+
+		default:
+			fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(format(v)))
+		}
+	}
+
+	b.WriteString(`</row>`)
+}
+
+// cellRef returns the reference of the cell like A1 or AB12 for the zero
+// based column and the row.
+func cellRef(col int, row int) string {
+	var name string
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+
+	return name + strconv.Itoa(row)
+}
+
+// sheetNames returns a unique and valid worksheet name for each table.
+// Worksheet names are limited to 31 characters and can't contain some
+// characters.
+func sheetNames(tables []Table) []string {
+	names := make([]string, len(tables))
+	used := make(map[string]bool)
+
+	for i, t := range tables {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, t.Name)
+
+		if name == "" {
+			name = "Sheet"
+		}
+
+		name = truncate(name, 31)
+
+		// Make the name unique by adding a number at the end.
+		base := name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := " " + strconv.Itoa(n)
+			name = truncate(base, 31-len(suffix)) + suffix
+		}
+
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+
+	return names
+}
+
+// truncate limits the string to the number of characters.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+
+	return s
+}
+
+// stringValues converts the strings into values.
+func stringValues(strs []string) []interface{} {
+	values := make([]interface{}, len(strs))
+	for i := range strs {
+		values[i] = strs[i]
+	}
+
+	return values
+}
+
+// escape escapes the text for use inside of XML.
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,233 @@
+package xenia
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// findCmd contains the options extracted from a find command document.
+type findCmd struct {
+	filter     map[string]interface{}
+	projection map[string]interface{}
+	sort       []string
+	skip       int
+	limit      int
+}
+
+// execFind executes the specified find query.
+func execFind(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
+
+	// {"filter": {"station_id": "#string:station_id"}, "projection": {"_id": 0, "name": 1}, "sort": ["-name"], "skip": 0, "limit": 10}
+
+	// If the last command is a $save, capture its value and remove
+	// it from the commands.
+	commands, save := extractSave(q)
+
+	// A find query is made up of a single command document.
+	if len(commands) != 1 {
+		return docs{}, commands, errors.New("Invalid find script, expecting a single command")
+	}
+
+	// Do we have variables to be substitued.
+	if vars != nil {
+		if err := processVariables(context, commands[0], vars, opts.types, opts.claims(), data); err != nil {
+			return docs{}, commands, err
+		}
+	}
+
+	fnd, err := parseFind(context, commands[0])
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Apply the policies of the collection for the caller.
+	if fnd.filter, err = applyFilterPolicies(context, db, q.Collection, commands[0], fnd.filter, opts); err != nil {
+		return docs{}, commands, err
+	}
+
+	// Build the mgo query for the provided collection.
+	mgoQuery := func(c *mgo.Collection) *mgo.Query {
+		mq := c.Find(fnd.filter).Select(fnd.projection)
+
+		if len(fnd.sort) > 0 {
+			mq = mq.Sort(fnd.sort...)
+		}
+
+		if fnd.skip > 0 {
+			mq = mq.Skip(fnd.skip)
+		}
+
+		if fnd.limit > 0 {
+			mq = mq.Limit(fnd.limit)
+		}
+
+		return mq
+	}
+
+	// Do we want the final commands without executing them.
+	if opts.dryRun {
+		return dryRun(q, commands, save, data), commands, nil
+	}
+
+	// Do we want the explain output.
+	if opts.explain {
+
+		// Build the find function for the execution for explain.
+		var m bson.M
+		f := func(c *mgo.Collection) error {
+			log.Dev(context, "execFind", "MGO Explain :\ndb.%s.find(%s, %s)", c.Name, mongo.Query(fnd.filter), mongo.Query(fnd.projection))
+			return mgoQuery(c).Explain(&m)
+		}
+
+		// Execute the find.
+		if err := db.ExecuteMGO(context, q.Collection, f); err != nil {
+			return docs{}, commands, err
+		}
+
+		return docs{Name: q.Name, Docs: []bson.M{m}}, commands, nil
+	}
+
+	// Build the find function for the execution.
+	f := func(c *mgo.Collection) *mgo.Iter {
+		log.Dev(context, "execFind", "MGO Started\ndb.%s.find(%s, %s).sort(%v).skip(%d).limit(%d)", c.Name, mongo.Query(fnd.filter), mongo.Query(fnd.projection), fnd.sort, fnd.skip, fnd.limit)
+		return mgoQuery(c).SetMaxTime(queryTimeout(context, q)).Iter()
+	}
+
+	// Execute the find.
+	results, err := readResults(context, db, q, save != nil, opts, f)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	log.Dev(context, "execFind", "Completed")
+
+	// Perform any masking and saving that is required. Streamed
+	// results have already been masked.
+	results, err = processResults(context, db, q, save, results, data, opts.emit == nil)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	return docs{Name: q.Name, Docs: results}, commands, nil
+}
+
+// parseFind extracts the find options from the command document.
+func parseFind(context interface{}, command map[string]interface{}) (findCmd, error) {
+	var fnd findCmd
+
+	for key, value := range command {
+		switch key {
+		case "filter":
+			doc, err := cmdDoc(value)
+			if err != nil {
+				log.Error(context, "parseFind", err, "Checking filter")
+				return findCmd{}, err
+			}
+			fnd.filter = doc
+
+		case "projection":
+			doc, err := cmdDoc(value)
+			if err != nil {
+				log.Error(context, "parseFind", err, "Checking projection")
+				return findCmd{}, err
+			}
+			fnd.projection = doc
+
+		case "sort":
+			sort, err := cmdStrings(value)
+			if err != nil {
+				log.Error(context, "parseFind", err, "Checking sort")
+				return findCmd{}, err
+			}
+			fnd.sort = sort
+
+		case "skip":
+			skip, err := cmdInt(value)
+			if err != nil {
+				log.Error(context, "parseFind", err, "Checking skip")
+				return findCmd{}, err
+			}
+			fnd.skip = skip
+
+		case "limit":
+			limit, err := cmdInt(value)
+			if err != nil {
+				log.Error(context, "parseFind", err, "Checking limit")
+				return findCmd{}, err
+			}
+			fnd.limit = limit
+
+		default:
+			err := fmt.Errorf("Invalid find option %q", key)
+			log.Error(context, "parseFind", err, "Checking options")
+			return findCmd{}, err
+		}
+	}
+
+	return fnd, nil
+}
+
+//==============================================================================
+
+// cmdDoc converts a command value into a document.
+func cmdDoc(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	case bson.M:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("Value is a %T but must be a document", value)
+	}
+}
+
+// cmdStrings converts a command value into a slice of strings.
+func cmdStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i := range v {
+			s, ok := v[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("Value %v is a %T but must be a string", v[i], v[i])
+			}
+			strs[i] = s
+		}
+		return strs, nil
+	default:
+		return nil, fmt.Errorf("Value is a %T but must be an array of strings", value)
+	}
+}
+
+// cmdInt converts a command value into an integer. Numbers decoded from JSON
+// are float64 and numbers decoded from BSON can be any of the integer types.
+func cmdInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("Value %v must be a whole number", v)
+		}
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("Value is a %T but must be a number", value)
+	}
+}
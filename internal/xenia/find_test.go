@@ -0,0 +1,175 @@
+package xenia_test
+
+import (
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+)
+
+// getFindExecSet returns the table for the testing.
+func getFindExecSet() []execSet {
+	return []execSet{
+		findBasic(),
+		findSortSkipLimit(),
+		findVars(),
+		findSaveIn(),
+		findInvalidOption(),
+	}
+}
+
+// findBasic starts with a simple find query.
+func findBasic() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Find Basic",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Find Basic",
+					Type:       "find",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{
+							"filter":     map[string]interface{}{"station_id": "42021"},
+							"projection": map[string]interface{}{"_id": 0, "name": 1},
+						},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Find Basic","Docs":[{"name":"C14 - Pasco County Buoy, FL"}]}]}`,
+		},
+	}
+}
+
+// findSortSkipLimit performs a find query using sort, skip and limit.
+func findSortSkipLimit() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Find Sort Skip Limit",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Find Sort Skip Limit",
+					Type:       "find",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{
+							"filter":     map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44005", "44008"}}},
+							"projection": map[string]interface{}{"_id": 0, "name": 1},
+							"sort":       []string{"-station_id"},
+							"skip":       1,
+							"limit":      1,
+						},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Find Sort Skip Limit","Docs":[{"name":"GULF OF MAINE 78 NM EAST OF PORTSMOUTH,NH"}]}]}`,
+		},
+	}
+}
+
+// findVars performs a find query with variables.
+func findVars() execSet {
+	return execSet{
+		fail: false,
+		vars: map[string]string{"station_id": "42021", "limit": "1"},
+		set: &query.Set{
+			Name:    "Find Vars",
+			Enabled: true,
+			Params: []query.Param{
+				{Name: "station_id"},
+				{Name: "limit"},
+			},
+			Queries: []query.Query{
+				{
+					Name:       "Find Vars",
+					Type:       "find",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{
+							"filter":     map[string]interface{}{"station_id": "#string:station_id"},
+							"projection": map[string]interface{}{"_id": 0, "name": 1},
+							"limit":      "#number:limit",
+						},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Find Vars","Docs":[{"name":"C14 - Pasco County Buoy, FL"}]}]}`,
+		},
+	}
+}
+
+// findSaveIn performs a find query where the result is saved and used
+// in an $in statement by a pipeline query.
+func findSaveIn() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Find Save In",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Get Ids",
+					Type:       "find",
+					Collection: tstdata.CollectionExecTest,
+					Return:     false,
+					Commands: []map[string]interface{}{
+						{
+							"filter":     map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44008"}}},
+							"projection": map[string]interface{}{"_id": 0, "station_id": 1},
+						},
+						{"$save": map[string]interface{}{"$map": "list"}},
+					},
+				},
+				{
+					Name:       "Get Documents",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": "#data.*:list.station_id"}}},
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Get Documents","Docs":[{"name":"C14 - Pasco County Buoy, FL"},{"name":"NANTUCKET 54NM Southeast of Nantucket"}]}]}`,
+		},
+	}
+}
+
+// findInvalidOption performs a find query with an unknown option.
+func findInvalidOption() execSet {
+	return execSet{
+		fail: true,
+		set: &query.Set{
+			Name:    "Find Invalid Option",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Find Invalid Option",
+					Type:       "find",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"filter": map[string]interface{}{"station_id": "42021"}, "fields": 1},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":{"commands":[{"fields":1,"filter":{"station_id":"42021"}}],"error":"Invalid find option \"fields\""}}`,
+		},
+	}
+}
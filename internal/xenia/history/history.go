@@ -0,0 +1,142 @@
+// Package history provides support for comparing the versions of the Sets,
+// Scripts, Regexs and Masks kept in their history collections. The history
+// is ordered from the newest version to the oldest, with the first version
+// ever saved being version 1.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// ErrVersionNotFound is returned when a version does not exist in the
+// history.
+var ErrVersionNotFound = errors.New("Version Not found")
+
+// Change describes a value that is different between two versions of a
+// document. The path is the dotted path to the value, with array elements
+// named by their index. Old is missing when the value was added and New is
+// missing when the value was removed.
+type Change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Index returns the index into the history of the specified version. The
+// history holds total versions, newest first.
+func Index(version int, total int) (int, error) {
+	if version < 1 || version > total {
+		return 0, ErrVersionNotFound
+	}
+
+	return total - version, nil
+}
+
+// Number returns the version number of the entry at the specified index of
+// the history. The history holds total versions, newest first.
+func Number(index int, total int) int {
+	return total - index
+}
+
+// Diff returns the changes between the two versions of a document. The
+// documents are compared in their JSON form and the changes are ordered by
+// their path.
+func Diff(from, to interface{}) ([]Change, error) {
+	f, err := toValue(from)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := toValue(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	diffValue("", f, t, &changes)
+
+	sort.Sort(byPath(changes))
+
+	return changes, nil
+}
+
+// toValue converts the document into its JSON form.
+func toValue(doc interface{}) (interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Marshaling version : %v", err)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("Unmarshaling version : %v", err)
+	}
+
+	return v, nil
+}
+
+// diffValue compares the two values at the path and appends the changes.
+func diffValue(path string, from, to interface{}, changes *[]Change) {
+	switch f := from.(type) {
+	case map[string]interface{}:
+		if t, ok := to.(map[string]interface{}); ok {
+			for key, fv := range f {
+				tv, exists := t[key]
+				if !exists {
+					*changes = append(*changes, Change{Path: join(path, key), Old: fv})
+					continue
+				}
+				diffValue(join(path, key), fv, tv, changes)
+			}
+
+			for key, tv := range t {
+				if _, exists := f[key]; !exists {
+					*changes = append(*changes, Change{Path: join(path, key), New: tv})
+				}
+			}
+			return
+		}
+
+	case []interface{}:
+		if t, ok := to.([]interface{}); ok {
+			for i := 0; i < len(f) || i < len(t); i++ {
+				key := strconv.Itoa(i)
+
+				switch {
+				case i >= len(t):
+					*changes = append(*changes, Change{Path: join(path, key), Old: f[i]})
+				case i >= len(f):
+					*changes = append(*changes, Change{Path: join(path, key), New: t[i]})
+				default:
+					diffValue(join(path, key), f[i], t[i], changes)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, Change{Path: path, Old: from, New: to})
+	}
+}
+
+// byPath sorts the changes by their path.
+type byPath []Change
+
+func (c byPath) Len() int           { return len(c) }
+func (c byPath) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byPath) Less(i, j int) bool { return c[i].Path < c[j].Path }
+
+// join adds the key to the path.
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
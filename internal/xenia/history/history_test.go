@@ -0,0 +1,107 @@
+package history_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/history"
+)
+
+func init() {
+	tests.Init("XENIA")
+}
+
+// TestDiff tests the changes between two versions of a document.
+func TestDiff(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	type doc struct {
+		Name     string                   `json:"name"`
+		Enabled  bool                     `json:"enabled"`
+		Commands []map[string]interface{} `json:"commands"`
+	}
+
+	from := doc{
+		Name: "Basic",
+		Commands: []map[string]interface{}{
+			{"$match": map[string]interface{}{"station_id": "42021"}},
+			{"$limit": 5},
+		},
+	}
+
+	to := doc{
+		Name:    "Basic",
+		Enabled: true,
+		Commands: []map[string]interface{}{
+			{"$match": map[string]interface{}{"station_id": "42021", "name": "Station"}},
+		},
+	}
+
+	t.Log("Given the need to compare two versions of a document.")
+	{
+		t.Log("\tWhen the versions are different")
+		{
+			changes, err := history.Diff(from, to)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to compare the versions : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to compare the versions.", tests.Success)
+
+			exp := []history.Change{
+				{Path: "commands.0.$match.name", New: "Station"},
+				{Path: "commands.1", Old: map[string]interface{}{"$limit": 5.0}},
+				{Path: "enabled", Old: false, New: true},
+			}
+
+			if !reflect.DeepEqual(changes, exp) {
+				t.Logf("\t%+v", changes)
+				t.Fatalf("\t%s\tShould get back each change ordered by path.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back each change ordered by path.", tests.Success)
+		}
+
+		t.Log("\tWhen the versions are the same")
+		{
+			changes, err := history.Diff(from, from)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to compare the versions : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to compare the versions.", tests.Success)
+
+			if len(changes) != 0 {
+				t.Fatalf("\t%s\tShould get back no changes : %+v", tests.Failed, changes)
+			}
+			t.Logf("\t%s\tShould get back no changes.", tests.Success)
+		}
+	}
+}
+
+// TestIndex tests finding versions within the history.
+func TestIndex(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	t.Log("Given the need to find a version within a history of 3 versions.")
+	{
+		for version, exp := range map[int]int{1: 2, 2: 1, 3: 0} {
+			idx, err := history.Index(version, 3)
+			if err != nil || idx != exp {
+				t.Fatalf("\t%s\tShould find version %d at index %d : %d %v", tests.Failed, version, exp, idx, err)
+			}
+
+			if n := history.Number(idx, 3); n != version {
+				t.Fatalf("\t%s\tShould get back version %d from index %d : %d", tests.Failed, version, idx, n)
+			}
+			t.Logf("\t%s\tShould find version %d at index %d.", tests.Success, version, exp)
+		}
+
+		for _, version := range []int{0, 4} {
+			if _, err := history.Index(version, 3); err != history.ErrVersionNotFound {
+				t.Fatalf("\t%s\tShould not find version %d : %v", tests.Failed, version, err)
+			}
+			t.Logf("\t%s\tShould not find version %d.", tests.Success, version)
+		}
+	}
+}
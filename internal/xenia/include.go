@@ -0,0 +1,199 @@
+package xenia
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxSetDepth is the number of sets that can be included within each other,
+// counting the set being executed.
+const maxSetDepth = 5
+
+// setCmd contains the options of the command for a set query.
+type setCmd struct {
+	name  string
+	vars  map[string]string
+	query string
+}
+
+// execSet executes the stored set named by the set query. The variables for
+// the set are mapped from the variables and saved results of this set. The
+// documents returned by the included set become the results of the query.
+func execSet(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
+
+	// {"name": "set name", "vars": {"station_id": "#string:id"}, "query": "query name"}
+
+	// If the last command is a $save, capture its value.
+	commands, save := extractSave(q)
+	if len(commands) != 1 {
+		return docs{}, q.Commands, errors.New("Invalid set command")
+	}
+
+	// Do we have variables to be substitued.
+	if vars != nil {
+		if err := processVariables(context, commands[0], vars, opts.types, opts.claims(), data); err != nil {
+			return docs{}, commands, err
+		}
+	}
+
+	sc, err := parseSetCmd(commands[0])
+	if err != nil {
+		log.Error(context, "execSet", err, "Parsing command")
+		return docs{}, commands, err
+	}
+
+	// Check the set is not already being executed and we are not
+	// including sets too deep.
+	sets := append(opts.sets[:len(opts.sets):len(opts.sets)], sc.name)
+	for _, name := range opts.sets {
+		if name == sc.name {
+			err := fmt.Errorf("Set %q includes itself : %s", sc.name, strings.Join(sets, " -> "))
+			log.Error(context, "execSet", err, "Checking sets")
+			return docs{}, commands, err
+		}
+	}
+
+	if len(sets) > maxSetDepth {
+		err := fmt.Errorf("Set %q is included deeper than the limit of %d sets", sc.name, maxSetDepth)
+		log.Error(context, "execSet", err, "Checking sets")
+		return docs{}, commands, err
+	}
+
+	log.Dev(context, "execSet", "Started : Name[%s]", sc.name)
+
+	set, err := query.GetByName(context, db, sc.name)
+	if err != nil {
+		return docs{}, commands, fmt.Errorf("Set %q : %v", sc.name, err)
+	}
+
+	// The caller must be allowed to execute the included sets as well.
+	if !set.ACL.CanExecute(opts.caller) {
+		err := fmt.Errorf("Set %q : Not allowed to execute", sc.name)
+		log.Error(context, "execSet", err, "Checking ACL")
+		return docs{}, commands, err
+	}
+
+	// Each query gets its own copy of the commands since variable
+	// substitution changes them.
+	inc := *set
+	inc.Queries = make([]query.Query, len(set.Queries))
+	for i := range set.Queries {
+		inc.Queries[i] = set.Queries[i]
+		inc.Queries[i].Commands = copyDocs(set.Queries[i].Commands)
+	}
+
+	// Validate the set and the variables we are providing.
+	if _, err := prepareSet(context, db, &inc, sc.vars, false); err != nil {
+		return docs{}, commands, fmt.Errorf("Set %q : %v", sc.name, err)
+	}
+
+	if err := loadPrePostScripts(context, db, &inc); err != nil {
+		return docs{}, commands, fmt.Errorf("Set %q : %v", sc.name, err)
+	}
+
+	// The included set runs within the limits of this set and its
+	// documents are only streamed as the results of this query.
+	iopts := execOpts{ctx: opts.ctx, explain: opts.explain, dryRun: opts.dryRun, limits: opts.limits, sets: sets, types: paramTypes(&inc), caller: opts.caller}
+
+	results, _, err := execQueries(context, db, &inc, sc.vars, iopts)
+	if err != nil {
+		return docs{}, commands, fmt.Errorf("Set %q : %v", sc.name, err)
+	}
+
+	// Collect the documents of the queries we were asked for.
+	var found bool
+	var included []bson.M
+	for _, r := range results {
+		if sc.query == "" || r.Name == sc.query {
+			included = append(included, r.Docs...)
+			found = true
+		}
+	}
+
+	if sc.query != "" && !found {
+		err := fmt.Errorf("Set %q does not return query %q", sc.name, sc.query)
+		log.Error(context, "execSet", err, "Collecting results")
+		return docs{}, commands, err
+	}
+
+	log.Dev(context, "execSet", "Completed : Name[%s] Docs[%d]", sc.name, len(included))
+
+	// The explain output of the included set is not saved.
+	if opts.explain {
+		return docs{Name: q.Name, Docs: included}, commands, nil
+	}
+
+	// The final commands of the included set are returned with a
+	// placeholder for any result this query saves.
+	if opts.dryRun {
+		if name, ok := save["$map"].(string); ok {
+			data[name] = placeholder(name)
+		}
+
+		return docs{Name: q.Name, Docs: included}, commands, nil
+	}
+
+	// Perform any saving that is required. The documents have already
+	// been masked by the included set.
+	included, err = processResults(context, db, q, save, included, data, false)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	if err := emitResults(opts.emit, included); err != nil {
+		return docs{}, commands, err
+	}
+
+	return docs{Name: q.Name, Docs: included}, commands, nil
+}
+
+// parseSetCmd parses the command of a set query. The values of the vars
+// document have already been substituted and are converted to strings.
+func parseSetCmd(command map[string]interface{}) (setCmd, error) {
+	sc := setCmd{
+		vars: make(map[string]string),
+	}
+
+	for key, value := range command {
+		switch key {
+		case "name":
+			name, ok := value.(string)
+			if !ok || name == "" {
+				return setCmd{}, fmt.Errorf("Set name \"%v\" must be a string", value)
+			}
+			sc.name = name
+
+		case "query":
+			name, ok := value.(string)
+			if !ok {
+				return setCmd{}, fmt.Errorf("Set query \"%v\" must be a string", value)
+			}
+			sc.query = name
+
+		case "vars":
+			doc, err := cmdDoc(value)
+			if err != nil {
+				return setCmd{}, fmt.Errorf("Set vars must be a document : %v", err)
+			}
+
+			for name, v := range doc {
+				sc.vars[name] = varString(v)
+			}
+
+		default:
+			return setCmd{}, fmt.Errorf("Invalid set option %q", key)
+		}
+	}
+
+	if sc.name == "" {
+		return setCmd{}, errors.New("Missing set name")
+	}
+
+	return sc, nil
+}
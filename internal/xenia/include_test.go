@@ -0,0 +1,199 @@
+package xenia_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/internal/xenia/query/qfix"
+	"github.com/coralproject/shelf/tstdata"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// includePrefix is the prefix of the sets the tests include.
+const includePrefix = "XTEST_INC_"
+
+// TestExecSetQuery tests executing sets that include other sets.
+func TestExecSetQuery(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	t.Log("Given the need to load the test data.")
+	{
+		loadTestData(t, db)
+	}
+
+	defer func() {
+		t.Log("Given the need to unload the test data.")
+		{
+			unloadTestData(t, db)
+
+			if err := qfix.Remove(db, includePrefix); err != nil {
+				t.Fatalf("\t%s\tShould be able to remove the sets : %v", tests.Failed, err)
+			}
+		}
+	}()
+
+	// include returns a set query that includes the named set.
+	include := func(name string, save bool) query.Query {
+		q := query.Query{
+			Name: "Include",
+			Type: "set",
+			Commands: []map[string]interface{}{
+				{"name": name, "vars": map[string]interface{}{"station_id": "#string:id"}},
+			},
+			Return: true,
+		}
+
+		if save {
+			q.Commands = append(q.Commands, map[string]interface{}{"$save": map[string]interface{}{"$map": "stations"}})
+		}
+
+		return q
+	}
+
+	stations := query.Set{
+		Name:    includePrefix + "Stations",
+		Enabled: true,
+		Params: []query.Param{
+			{Name: "station_id"},
+		},
+		Queries: []query.Query{
+			{
+				Name:       "Stations",
+				Type:       "pipeline",
+				Collection: tstdata.CollectionExecTest,
+				Commands: []map[string]interface{}{
+					{"$match": map[string]interface{}{"station_id": "#string:station_id"}},
+					{"$project": map[string]interface{}{"_id": 0, "station_id": 1, "name": 1}},
+				},
+				Return: true,
+			},
+		},
+	}
+
+	disabled := stations
+	disabled.Name = includePrefix + "Disabled"
+	disabled.Enabled = false
+
+	cycle := query.Set{
+		Name:    includePrefix + "Cycle",
+		Enabled: true,
+		Queries: []query.Query{
+			{
+				Name:     "Cycle",
+				Type:     "set",
+				Commands: []map[string]interface{}{{"name": includePrefix + "Cycle"}},
+			},
+		},
+	}
+
+	t.Log("Given the need to store the sets to include.")
+	{
+		for _, set := range []query.Set{stations, disabled, cycle} {
+			set := set
+			if err := qfix.Add(db, &set); err != nil {
+				t.Fatalf("\t%s\tShould be able to add set %q : %v", tests.Failed, set.Name, err)
+			}
+		}
+		t.Logf("\t%s\tShould be able to add the sets.", tests.Success)
+	}
+
+	vars := map[string]string{"id": "42021"}
+
+	t.Log("Given the need to include another set.")
+	{
+		t.Log("\tWhen using the results of the included set")
+		{
+			set := query.Set{
+				Name:    "Include Set",
+				Enabled: true,
+				Params:  []query.Param{{Name: "id"}},
+				Queries: []query.Query{
+					include(stations.Name, true),
+					{
+						Name:       "Station",
+						Type:       "pipeline",
+						Collection: tstdata.CollectionExecTest,
+						Commands: []map[string]interface{}{
+							{"$match": map[string]interface{}{"station_id": "#data.0:stations.station_id"}},
+							{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+						},
+						Return: true,
+					},
+				},
+			}
+
+			result := xenia.Exec(tests.Context, db, &set, vars)
+			if m, ok := result.Results.(bson.M); ok {
+				t.Fatalf("\t%s\tShould be able to execute the set : %v", tests.Failed, m["error"])
+			}
+			t.Logf("\t%s\tShould be able to execute the set.", tests.Success)
+
+			data, err := json.Marshal(result.Results)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to marshal the results : %v", tests.Failed, err)
+			}
+
+			var res []docs
+			if err := json.Unmarshal(data, &res); err != nil {
+				t.Fatalf("\t%s\tShould be able to unmarshal the results : %v", tests.Failed, err)
+			}
+
+			if len(res) != 2 || len(res[0].Docs) != 1 || res[0].Docs[0]["station_id"] != "42021" {
+				t.Log(string(data))
+				t.Fatalf("\t%s\tShould get back the documents of the included set.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back the documents of the included set.", tests.Success)
+
+			if len(res[1].Docs) != 1 || res[1].Docs[0]["name"] != res[0].Docs[0]["name"] {
+				t.Log(string(data))
+				t.Fatalf("\t%s\tShould be able to use the saved results of the included set.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould be able to use the saved results of the included set.", tests.Success)
+		}
+
+		t.Log("\tWhen the included set is disabled")
+		{
+			set := query.Set{
+				Name:    "Include Disabled",
+				Enabled: true,
+				Params:  []query.Param{{Name: "id"}},
+				Queries: []query.Query{include(disabled.Name, false)},
+			}
+
+			result := xenia.Exec(tests.Context, db, &set, vars)
+			m, ok := result.Results.(bson.M)
+			if !ok || !strings.Contains(m["error"].(string), "Set disabled") {
+				t.Fatalf("\t%s\tShould not be able to execute the set : %v", tests.Failed, result.Results)
+			}
+			t.Logf("\t%s\tShould not be able to execute the set.", tests.Success)
+		}
+
+		t.Log("\tWhen the included set includes itself")
+		{
+			set := query.Set{
+				Name:    "Include Cycle",
+				Enabled: true,
+				Queries: []query.Query{include(cycle.Name, false)},
+			}
+
+			result := xenia.Exec(tests.Context, db, &set, vars)
+			m, ok := result.Results.(bson.M)
+			if !ok || !strings.Contains(m["error"].(string), "includes itself") {
+				t.Fatalf("\t%s\tShould not be able to execute the set : %v", tests.Failed, result.Results)
+			}
+			t.Logf("\t%s\tShould not be able to execute the set.", tests.Success)
+		}
+	}
+}
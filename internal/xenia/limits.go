@@ -0,0 +1,88 @@
+package xenia
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// limits tracks the limits of a set across the queries being executed.
+type limits struct {
+	maxDocs int
+	maxSize int64
+	size    int64
+}
+
+// withLimits returns the limits for executing the set and a ctx that is
+// cancelled once the total timeout of the set expires.
+func withLimits(ctx context.Context, set *query.Set) (context.Context, context.CancelFunc, *limits) {
+	if set.Limits == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	l := limits{
+		maxDocs: set.Limits.MaxDocs,
+		maxSize: set.Limits.MaxSize,
+	}
+
+	if set.Limits.Timeout != "" {
+		if d, err := set.Limits.Duration(); err == nil {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			return ctx, cancel, &l
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, &l
+}
+
+// check checks the nth document returned by the query against the limits.
+// Only the documents of queries that return their results count against
+// the size of the response.
+func (l *limits) check(q *query.Query, n int, size int) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.maxDocs > 0 && n > l.maxDocs {
+		return fmt.Errorf("Query %q returned more than the limit of %d documents", q.Name, l.maxDocs)
+	}
+
+	if l.maxSize > 0 && q.Return {
+		if atomic.AddInt64(&l.size, int64(size)) > l.maxSize {
+			return fmt.Errorf("Query %q went over the response size limit of %d bytes", q.Name, l.maxSize)
+		}
+	}
+
+	return nil
+}
+
+// checkDocs checks the documents a query produced itself against the limits.
+func (l *limits) checkDocs(q *query.Query, results []bson.M) error {
+	if l == nil {
+		return nil
+	}
+
+	for i, doc := range results {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		if err := l.check(q, i+1, len(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timedOut reports if the ctx was cancelled because the total timeout of
+// the set expired.
+func timedOut(ctx context.Context) bool {
+	return ctx.Err() == context.DeadlineExceeded
+}
@@ -0,0 +1,88 @@
+package xenia
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
+)
+
+// TestLimits tests checking documents against the limits of a set.
+func TestLimits(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	q := query.Query{Name: "Limited", Return: true}
+
+	t.Log("Given the need to check documents against the limits of a set.")
+	{
+		t.Log("\tWhen the set has no limits")
+		{
+			_, cancel, l := withLimits(context.Background(), &query.Set{})
+			defer cancel()
+
+			if err := l.check(&q, 1000, 1000); err != nil {
+				t.Fatalf("\t%s\tShould not get an error : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not get an error.", tests.Success)
+		}
+
+		t.Log("\tWhen the set limits the documents per query")
+		{
+			_, cancel, l := withLimits(context.Background(), &query.Set{Limits: &query.Limits{MaxDocs: 2}})
+			defer cancel()
+
+			if err := l.check(&q, 2, 100); err != nil {
+				t.Fatalf("\t%s\tShould accept documents up to the limit : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould accept documents up to the limit.", tests.Success)
+
+			exp := `Query "Limited" returned more than the limit of 2 documents`
+			if err := l.check(&q, 3, 100); err == nil || err.Error() != exp {
+				t.Fatalf("\t%s\tShould get an error naming the query : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get an error naming the query.", tests.Success)
+		}
+
+		t.Log("\tWhen the set limits the size of the response")
+		{
+			_, cancel, l := withLimits(context.Background(), &query.Set{Limits: &query.Limits{MaxSize: 100}})
+			defer cancel()
+
+			if err := l.check(&query.Query{Name: "Saved"}, 1, 500); err != nil {
+				t.Fatalf("\t%s\tShould not count queries that don't return : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not count queries that don't return.", tests.Success)
+
+			if err := l.check(&q, 1, 60); err != nil {
+				t.Fatalf("\t%s\tShould accept documents up to the limit : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould accept documents up to the limit.", tests.Success)
+
+			exp := `Query "Limited" went over the response size limit of 100 bytes`
+			if err := l.check(&q, 2, 60); err == nil || err.Error() != exp {
+				t.Fatalf("\t%s\tShould get an error naming the query : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get an error naming the query.", tests.Success)
+		}
+
+		t.Log("\tWhen the set has a total timeout")
+		{
+			ctx, cancel, _ := withLimits(context.Background(), &query.Set{Limits: &query.Limits{Timeout: "10ms"}})
+			defer cancel()
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tShould be cancelled once the timeout expires.", tests.Failed)
+			}
+
+			if !timedOut(ctx) {
+				t.Fatalf("\t%s\tShould be cancelled once the timeout expires : %v", tests.Failed, ctx.Err())
+			}
+			t.Logf("\t%s\tShould be cancelled once the timeout expires.", tests.Success)
+		}
+	}
+}
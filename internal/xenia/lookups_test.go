@@ -0,0 +1,81 @@
+package xenia_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/policy"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// protectedCollection is the collection the tests protect with a policy.
+const protectedCollection = "test_xenia_protected"
+
+// TestPolicyLookups tests a pipeline can't read the documents of another
+// collection that has policies.
+func TestPolicyLookups(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	p := policy.Policy{
+		Collection: protectedCollection,
+		Role:       policy.AllRoles,
+		Match:      map[string]interface{}{"public": true},
+	}
+
+	if err := policy.Upsert(tests.Context, db, p); err != nil {
+		t.Fatalf("\t%s\tShould be able to add the policy : %v", tests.Failed, err)
+	}
+	defer policy.Delete(tests.Context, db, p.Collection, p.Role)
+
+	stages := map[string]map[string]interface{}{
+		"$unionWith":          {"$unionWith": protectedCollection},
+		"$unionWith document": {"$unionWith": map[string]interface{}{"coll": protectedCollection}},
+		"$lookup":             {"$lookup": map[string]interface{}{"from": protectedCollection, "localField": "station_id", "foreignField": "station_id", "as": "docs"}},
+		"$graphLookup":        {"$graphLookup": map[string]interface{}{"from": protectedCollection, "startWith": "$station_id", "connectFromField": "station_id", "connectToField": "station_id", "as": "docs"}},
+	}
+
+	t.Log("Given the need to keep a pipeline from reading a collection with policies.")
+	{
+		for name, stage := range stages {
+			t.Logf("\tWhen using a %s stage", name)
+			{
+				set := query.Set{
+					Name:    "Policy Lookups",
+					Enabled: true,
+					Queries: []query.Query{
+						{
+							Name:       "Policy Lookups",
+							Type:       "pipeline",
+							Collection: tstdata.CollectionExecTest,
+							Return:     true,
+							Commands:   []map[string]interface{}{stage},
+						},
+					},
+				}
+
+				result := xenia.Exec(tests.Context, db, &set, nil)
+				m, ok := result.Results.(bson.M)
+				if !ok {
+					t.Fatalf("\t%s\tShould not be able to execute the set : %v", tests.Failed, result.Results)
+				}
+
+				if msg, _ := m["error"].(string); !strings.Contains(msg, "has policies") {
+					t.Fatalf("\t%s\tShould not be able to use the collection : %v", tests.Failed, m["error"])
+				}
+				t.Logf("\t%s\tShould not be able to use the collection.", tests.Success)
+			}
+		}
+	}
+}
@@ -4,12 +4,14 @@ package mask
 
 import (
 	"errors"
-	"strings"
+	"net/url"
 	"time"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/db/mongo"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/tenant"
+	"github.com/coralproject/shelf/internal/xenia/history"
 	gc "github.com/patrickmn/go-cache"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -103,7 +105,7 @@ func Upsert(context interface{}, db *db.DB, mask Mask) error {
 		qu := bson.M{
 			"$push": bson.M{
 				"masks": bson.M{
-					"$each":     []Mask{mask},
+					"$each":     []Version{{Mask: mask, Saved: time.Now().UTC()}},
 					"$position": 0,
 				},
 			},
@@ -125,11 +127,12 @@ func Upsert(context interface{}, db *db.DB, mask Mask) error {
 
 // =============================================================================
 
-// GetAll retrieves a list of query masks.
+// GetAll retrieves a list of query masks. When tags are provided only the
+// masks with all of the tags are returned.
 func GetAll(context interface{}, db *db.DB, tags []string) (map[string]Mask, error) {
 	log.Dev(context, "GetAll", "Started : Tags[%v]", tags)
 
-	key := "gms" + strings.Join(tags, "-")
+	key := tenant.CacheKey(db, "gms"+url.Values{"tag": tags}.Encode())
 	if v, found := cache.Get(key); found {
 		mskMap := v.(map[string]Mask)
 		log.Dev(context, "GetAll", "Completed : CACHE : Masks[%d]", len(mskMap))
@@ -138,8 +141,12 @@ func GetAll(context interface{}, db *db.DB, tags []string) (map[string]Mask, err
 
 	var masks []Mask
 	f := func(c *mgo.Collection) error {
-		log.Dev(context, "GetAll", "MGO : db.%s.find({}).sort([\"name\"])", c.Name)
-		return c.Find(nil).All(&masks)
+		q := bson.M{}
+		if len(tags) > 0 {
+			q["tags"] = bson.M{"$all": tags}
+		}
+		log.Dev(context, "GetAll", "MGO : db.%s.find(%s).sort([\"name\"])", c.Name, mongo.Query(q))
+		return c.Find(q).All(&masks)
 	}
 
 	if err := db.ExecuteMGO(context, Collection, f); err != nil {
@@ -171,7 +178,7 @@ func GetAll(context interface{}, db *db.DB, tags []string) (map[string]Mask, err
 func GetByCollection(context interface{}, db *db.DB, collection string) (map[string]Mask, error) {
 	log.Dev(context, "GetByCollection", "Started : Collection[%s]", collection)
 
-	key := "gbc" + collection
+	key := tenant.CacheKey(db, "gbc"+collection)
 	if v, found := cache.Get(key); found {
 		mskMap := v.(map[string]Mask)
 		log.Dev(context, "GetByCollection", "Completed : CACHE : Masks[%d]", len(mskMap))
@@ -214,7 +221,7 @@ func GetByCollection(context interface{}, db *db.DB, collection string) (map[str
 func GetByName(context interface{}, db *db.DB, collection string, field string) (Mask, error) {
 	log.Dev(context, "GetByName", "Started : Collection[%s] Field[%s]", collection, field)
 
-	key := "gbn" + collection + field
+	key := tenant.CacheKey(db, "gbn"+collection+field)
 	if v, found := cache.Get(key); found {
 		mask := v.(Mask)
 		log.Dev(context, "GetByName", "Completed : CACHE : Mask[%+v]", mask)
@@ -252,7 +259,7 @@ func GetLastHistoryByName(context interface{}, db *db.DB, collection string, fie
 		Masks []Mask `bson:"masks"`
 	}
 
-	key := "glhbn" + collection + field
+	key := tenant.CacheKey(db, "glhbn"+collection+field)
 	if v, found := cache.Get(key); found {
 		result := v.(rslt)
 		log.Dev(context, "GetLastHistoryByName", "Completed : CACHE :  Set[%+v]", result.Masks[0])
@@ -290,6 +297,96 @@ func GetLastHistoryByName(context interface{}, db *db.DB, collection string, fie
 	return result.Masks[0], nil
 }
 
+// GetHistory retrieves every version of the query mask within the history, newest
+// first.
+func GetHistory(context interface{}, db *db.DB, collection string, field string) ([]Version, error) {
+	log.Dev(context, "GetHistory", "Started : Collection[%s] Field[%s]", collection, field)
+
+	type rslt struct {
+		Masks []Version `bson:"masks"`
+	}
+
+	key := tenant.CacheKey(db, "gh"+collection+field)
+	if v, found := cache.Get(key); found {
+		versions := v.([]Version)
+		log.Dev(context, "GetHistory", "Completed : CACHE : Versions[%d]", len(versions))
+		return versions, nil
+	}
+
+	var result rslt
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"collection": collection, "field": field}
+		log.Dev(context, "GetHistory", "MGO : db.%s.find(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).One(&result)
+	}
+
+	if err := db.ExecuteMGO(context, CollectionHistory, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetHistory", err, "Completed")
+		return nil, err
+	}
+
+	if len(result.Masks) == 0 {
+		log.Error(context, "GetHistory", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	// Number the versions.
+	for i := range result.Masks {
+		result.Masks[i].Version = history.Number(i, len(result.Masks))
+	}
+
+	cache.Set(key, result.Masks, gc.DefaultExpiration)
+
+	log.Dev(context, "GetHistory", "Completed : Versions[%d]", len(result.Masks))
+	return result.Masks, nil
+}
+
+// GetVersion retrieves the specified version of the query mask from the history.
+func GetVersion(context interface{}, db *db.DB, collection string, field string, version int) (Mask, error) {
+	log.Dev(context, "GetVersion", "Started : Collection[%s] Field[%s] Version[%d]", collection, field, version)
+
+	versions, err := GetHistory(context, db, collection, field)
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return Mask{}, err
+	}
+
+	idx, err := history.Index(version, len(versions))
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return Mask{}, err
+	}
+
+	log.Dev(context, "GetVersion", "Completed : Mask[%+v]", versions[idx].Mask)
+	return versions[idx].Mask, nil
+}
+
+// Restore makes the specified version of the query mask from the history the
+// current version. The restored query mask is added to the history as a new
+// version so the restore can be undone.
+func Restore(context interface{}, db *db.DB, collection string, field string, version int) error {
+	log.Dev(context, "Restore", "Started : Collection[%s] Field[%s] Version[%d]", collection, field, version)
+
+	msk, err := GetVersion(context, db, collection, field, version)
+	if err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	if err := Upsert(context, db, msk); err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Restore", "Completed")
+	return nil
+}
+
 // =============================================================================
 
 // Delete is used to remove an existing query mask document.
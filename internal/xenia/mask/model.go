@@ -2,7 +2,9 @@ package mask
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/coralproject/shelf/internal/xenia/acl"
 	"gopkg.in/bluesuncorp/validator.v8"
 )
 
@@ -28,9 +30,11 @@ func init() {
 
 // Mask contains information about what needs to be masked.
 type Mask struct {
-	Collection string `bson:"collection" json:"collection" validate:"required"`
-	Field      string `bson:"field" json:"field" validate:"required"`
-	Type       string `bson:"type" json:"type" validate:"required,min=3"`
+	Collection string   `bson:"collection" json:"collection" validate:"required"`
+	Field      string   `bson:"field" json:"field" validate:"required"`
+	Type       string   `bson:"type" json:"type" validate:"required,min=3"`
+	Tags       []string `bson:"tags,omitempty" json:"tags,omitempty" validate:"omitempty,dive,required"`
+	ACL        *acl.ACL `bson:"acl,omitempty" json:"acl,omitempty"` // Who may edit the Mask, execute does not apply.
 }
 
 // Validate checks the set value for consistency.
@@ -46,3 +50,10 @@ func (m Mask) Validate() error {
 		return fmt.Errorf("Invalid mask type %s", m.Type)
 	}
 }
+
+// Version contains a version of a query mask within the history.
+type Version struct {
+	Version int       `bson:"-" json:"version"`    // Number of the version, the first version saved is 1.
+	Saved   time.Time `bson:"saved" json:"saved"`  // When the version was saved, zero if not recorded.
+	Mask    Mask      `bson:",inline" json:"mask"` // The query mask as it was saved.
+}
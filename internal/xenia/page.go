@@ -0,0 +1,246 @@
+package xenia
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/mask"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrInvalidToken is returned when a page token can't be used for the query.
+var ErrInvalidToken = errors.New("Invalid page token")
+
+// pageToken is the content of a page token. The token identifies the query
+// and sort order it was issued for and the sort values of the last document
+// of the page.
+type pageToken struct {
+	Query string        `bson:"q"`
+	Sort  []string      `bson:"s"`
+	After []interface{} `bson:"a"`
+}
+
+// pager pages through the results of a query using the sort fields. The
+// sort always ends with _id so documents with the same sort values are
+// never skipped or repeated.
+type pager struct {
+	name   string
+	sort   []string
+	fields []string
+	desc   []bool
+	size   int
+	after  []interface{}
+	count  int
+	last   bson.M
+}
+
+// newPager creates a pager for the query, starting after the page token in
+// the variables if one was provided.
+func newPager(context interface{}, db *db.DB, q *query.Query, vars map[string]string) (*pager, error) {
+	p := pager{
+		name: q.Name,
+		size: q.Page.Size,
+	}
+
+	// Build the sort fields making sure _id is the last one.
+	var id bool
+	for _, s := range q.Page.Sort {
+		field := strings.TrimPrefix(s, "-")
+		if field == "_id" {
+			id = true
+		}
+
+		p.sort = append(p.sort, s)
+		p.fields = append(p.fields, field)
+		p.desc = append(p.desc, strings.HasPrefix(s, "-"))
+	}
+
+	if !id {
+		p.sort = append(p.sort, "_id")
+		p.fields = append(p.fields, "_id")
+		p.desc = append(p.desc, false)
+	}
+
+	// The sort values end up in the token, so masked fields can't be used.
+	if masks, err := mask.GetByCollection(context, db, q.Collection); err == nil {
+		for _, field := range p.fields {
+			name := field[strings.LastIndexByte(field, '.')+1:]
+			if _, exists := masks[name]; exists {
+				err := fmt.Errorf("Page sort field %q is masked", field)
+				log.Error(context, "newPager", err, "Checking sort fields")
+				return nil, err
+			}
+		}
+	}
+
+	// Are we starting after a previous page.
+	if token := vars[q.Page.TokenVar()]; token != "" {
+		after, err := p.decode(token)
+		if err != nil {
+			log.Error(context, "newPager", err, "Decoding token")
+			return nil, err
+		}
+		p.after = after
+	}
+
+	return &p, nil
+}
+
+// stages returns the pipeline stages for fetching the page.
+func (p *pager) stages() []bson.M {
+	var stages []bson.M
+
+	// Match the documents that sort after the last document of the
+	// previous page.
+	if p.after != nil {
+		var or []bson.M
+		for i := range p.fields {
+			cond := make(bson.M)
+			for j := 0; j < i; j++ {
+				cond[p.fields[j]] = p.after[j]
+			}
+
+			op := "$gt"
+			if p.desc[i] {
+				op = "$lt"
+			}
+			cond[p.fields[i]] = bson.M{op: p.after[i]}
+
+			or = append(or, cond)
+		}
+
+		if len(or) == 1 {
+			stages = append(stages, bson.M{"$match": or[0]})
+		} else {
+			stages = append(stages, bson.M{"$match": bson.M{"$or": or}})
+		}
+	}
+
+	// The order of the sort fields matters.
+	var sort bson.D
+	for i, field := range p.fields {
+		dir := 1
+		if p.desc[i] {
+			dir = -1
+		}
+		sort = append(sort, bson.DocElem{Name: field, Value: dir})
+	}
+
+	stages = append(stages, bson.M{"$sort": sort}, bson.M{"$limit": p.size})
+
+	return stages
+}
+
+// track returns an emit function that records the documents of the page
+// as they are streamed.
+func (p *pager) track(emit emitFunc) emitFunc {
+	return func(doc bson.M) error {
+		p.count++
+		p.last = doc
+		return emit(doc)
+	}
+}
+
+// seen records the documents of the page when they are not streamed.
+func (p *pager) seen(results []bson.M) {
+	p.count += len(results)
+	if len(results) > 0 {
+		p.last = results[len(results)-1]
+	}
+}
+
+// next returns the token for the next page. If the page was not full there
+// are no more documents and an empty token is returned.
+func (p *pager) next() (string, error) {
+	if p.count < p.size || p.last == nil {
+		return "", nil
+	}
+
+	t := pageToken{
+		Query: p.name,
+		Sort:  p.sort,
+		After: make([]interface{}, len(p.fields)),
+	}
+
+	for i, field := range p.fields {
+		v, exists := docValue(p.last, field)
+		if !exists {
+			return "", fmt.Errorf("Page sort field %q is missing from the results", field)
+		}
+		if !scalar(v) {
+			return "", fmt.Errorf("Page sort field %q is a %T but must be a single value", field, v)
+		}
+		t.After[i] = v
+	}
+
+	data, err := bson.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decode validates the token was issued for this query and returns the sort
+// values of the last document of the previous page.
+func (p *pager) decode(token string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var t pageToken
+	if err := bson.Unmarshal(data, &t); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if t.Query != p.name || strings.Join(t.Sort, ",") != strings.Join(p.sort, ",") || len(t.After) != len(p.fields) {
+		return nil, ErrInvalidToken
+	}
+
+	// The token comes from the caller so a document in place of a sort
+	// value could add operators to the $match of the page.
+	for _, v := range t.After {
+		if !scalar(v) {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return t.After, nil
+}
+
+// scalar reports if the value is a single value that can be compared with
+// the sort values of the documents.
+func scalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, string, bool, int, int32, int64, float64, time.Time, bson.ObjectId, bson.Binary, bson.MongoTimestamp:
+		return true
+	}
+
+	return false
+}
+
+// docValue returns the value of the field from the document. The field can
+// use dot notation to reference fields of embedded documents.
+func docValue(doc map[string]interface{}, field string) (interface{}, bool) {
+	idx := strings.IndexByte(field, '.')
+	if idx == -1 {
+		v, exists := doc[field]
+		return v, exists
+	}
+
+	switch sub := doc[field[:idx]].(type) {
+	case bson.M:
+		return docValue(sub, field[idx+1:])
+	case map[string]interface{}:
+		return docValue(sub, field[idx+1:])
+	}
+
+	return nil, false
+}
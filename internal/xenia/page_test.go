@@ -0,0 +1,150 @@
+package xenia
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestPager tests building the page stages and tokens.
+func TestPager(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	newPager := func() *pager {
+		return &pager{
+			name:   "Page",
+			sort:   []string{"-name", "_id"},
+			fields: []string{"name", "_id"},
+			desc:   []bool{true, false},
+			size:   2,
+		}
+	}
+
+	t.Log("Given the need to page through the results of a query.")
+	{
+		t.Log("\tWhen fetching the first page")
+		{
+			p := newPager()
+
+			exp := []bson.M{
+				{"$sort": bson.D{{Name: "name", Value: -1}, {Name: "_id", Value: 1}}},
+				{"$limit": 2},
+			}
+
+			if stages := p.stages(); !reflect.DeepEqual(stages, exp) {
+				t.Log("Exp:", exp)
+				t.Log("Got:", stages)
+				t.Fatalf("\t%s\tShould get the sort and limit stages.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get the sort and limit stages.", tests.Success)
+
+			p.seen([]bson.M{{"name": "b", "_id": 2}})
+
+			next, err := p.next()
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to build the token : %v", tests.Failed, err)
+			}
+			if next != "" {
+				t.Fatalf("\t%s\tShould not get a token for a partial page : %s", tests.Failed, next)
+			}
+			t.Logf("\t%s\tShould not get a token for a partial page.", tests.Success)
+		}
+
+		t.Log("\tWhen fetching the next page")
+		{
+			p := newPager()
+			p.seen([]bson.M{{"name": "b", "_id": 2}, {"name": "a", "_id": 5}})
+
+			next, err := p.next()
+			if err != nil || next == "" {
+				t.Fatalf("\t%s\tShould get a token for a full page : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get a token for a full page.", tests.Success)
+
+			np := newPager()
+			if np.after, err = np.decode(next); err != nil {
+				t.Fatalf("\t%s\tShould be able to decode the token : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to decode the token.", tests.Success)
+
+			exp := bson.M{"$match": bson.M{"$or": []bson.M{
+				{"name": bson.M{"$lt": "a"}},
+				{"name": "a", "_id": bson.M{"$gt": 5}},
+			}}}
+
+			if stages := np.stages(); !reflect.DeepEqual(stages[0], exp) {
+				t.Log("Exp:", exp)
+				t.Log("Got:", stages[0])
+				t.Fatalf("\t%s\tShould match the documents after the token.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould match the documents after the token.", tests.Success)
+		}
+
+		t.Log("\tWhen using a token from another query")
+		{
+			p := newPager()
+			p.seen([]bson.M{{"name": "b", "_id": 2}, {"name": "a", "_id": 5}})
+			next, _ := p.next()
+
+			op := newPager()
+			op.name = "Other"
+
+			if _, err := op.decode(next); err != ErrInvalidToken {
+				t.Fatalf("\t%s\tShould not be able to use the token : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not be able to use the token.", tests.Success)
+
+			if _, err := op.decode("not-a-token"); err != ErrInvalidToken {
+				t.Fatalf("\t%s\tShould not be able to use an invalid token : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not be able to use an invalid token.", tests.Success)
+		}
+
+		t.Log("\tWhen the token has a document for a sort value")
+		{
+			p := newPager()
+
+			for _, after := range []interface{}{
+				bson.M{"$ne": nil},
+				[]interface{}{"a", "b"},
+				bson.RegEx{Pattern: ".*"},
+			} {
+				data, err := bson.Marshal(pageToken{Query: p.name, Sort: p.sort, After: []interface{}{after, 5}})
+				if err != nil {
+					t.Fatalf("\t%s\tShould be able to build the token : %v", tests.Failed, err)
+				}
+
+				if _, err := p.decode(base64.RawURLEncoding.EncodeToString(data)); err != ErrInvalidToken {
+					t.Fatalf("\t%s\tShould not be able to use the token : %v", tests.Failed, err)
+				}
+			}
+			t.Logf("\t%s\tShould not be able to use the token.", tests.Success)
+		}
+
+		t.Log("\tWhen the sort field is a document in the results")
+		{
+			p := newPager()
+			p.seen([]bson.M{{"name": "b", "_id": 2}, {"name": bson.M{"first": "a"}, "_id": 5}})
+
+			if _, err := p.next(); err == nil {
+				t.Fatalf("\t%s\tShould not be able to build the token.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould not be able to build the token.", tests.Success)
+		}
+
+		t.Log("\tWhen the sort field is missing from the results")
+		{
+			p := newPager()
+			p.seen([]bson.M{{"_id": 2}, {"_id": 5}})
+
+			if _, err := p.next(); err == nil {
+				t.Fatalf("\t%s\tShould not be able to build the token.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould not be able to build the token.", tests.Success)
+		}
+	}
+}
@@ -3,16 +3,51 @@ package xenia
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/log"
 	"github.com/coralproject/shelf/internal/xenia/query"
 	"github.com/coralproject/shelf/internal/xenia/regex"
+	"gopkg.in/mgo.v2/bson"
 )
 
+// InvalidParam describes why the variable for a parameter is not valid.
+type InvalidParam struct {
+	Name string `json:"field_name"` // Name of the parameter.
+	Err  string `json:"error"`      // Why the variable is not valid.
+	msg  string
+}
+
+// ParamsError is returned when the variables do not satisfy the parameters
+// of the set. There is an entry for each invalid parameter.
+type ParamsError []InvalidParam
+
+// Error implements the error interface.
+func (pe ParamsError) Error() string {
+	msgs := make([]string, len(pe))
+	for i := range pe {
+		msgs[i] = pe[i].msg
+	}
+
+	return strings.Join(msgs, ",")
+}
+
+// CheckParams validates the variables against the parameters of the set
+// without executing it. Defaults are loaded and values are converted like
+// they are when the set is executed. When the variables are not valid, a
+// ParamsError is returned. Executing the set with checked set to true does
+// not process the variables again.
+func CheckParams(context interface{}, db *db.DB, set *query.Set, vars map[string]string) error {
+	return processParams(context, db, set, vars)
+}
+
 // processParams validates the variables against the query string of parameters.
-// It also loads default values and processes parameter regexes.
+// It also loads default values, converts the values of typed parameters and
+// processes parameter regexes.
 func processParams(context interface{}, db *db.DB, set *query.Set, vars map[string]string) error {
 
 	// Do we not have parameters.
@@ -30,7 +65,7 @@ func processParams(context interface{}, db *db.DB, set *query.Set, vars map[stri
 		}
 	}
 
-	var errs []string
+	var errs ParamsError
 
 	// Validate each known parameter is represented in the variable list.
 	for _, p := range set.Params {
@@ -43,8 +78,15 @@ func processParams(context interface{}, db *db.DB, set *query.Set, vars map[stri
 				vars[p.Name] = p.Default
 			} else {
 
-				// We are missing the parameter.
-				errs = append(errs, "Missing["+p.Name+"]")
+				// Optional parameters can be left out.
+				if p.Optional {
+					continue
+				}
+
+				// We are missing the parameter, there is
+				// nothing else to validate.
+				errs = append(errs, InvalidParam{Name: p.Name, Err: "Missing value", msg: "Missing[" + p.Name + "]"})
+				continue
 			}
 		}
 
@@ -52,19 +94,201 @@ func processParams(context interface{}, db *db.DB, set *query.Set, vars map[stri
 		if p.RegexName != "" {
 			value := vars[p.Name]
 			if err := validateRegex(context, db, value, p.RegexName); err != nil {
-				errs = append(errs, "Invalid["+value+":"+p.RegexName+":"+err.Error()+"]")
+				errs = append(errs, InvalidParam{Name: p.Name, Err: err.Error(), msg: "Invalid[" + value + ":" + p.RegexName + ":" + err.Error() + "]"})
+				continue
 			}
 		}
+
+		// Convert the value to the type of the parameter and check
+		// its constraints.
+		if value, exists := vars[p.Name]; exists {
+			v, err := validateParam(&p, value)
+			if err != nil {
+				log.Error(context, "validateParameters", err, "Validating : Name[%s]", p.Name)
+				errs = append(errs, InvalidParam{Name: p.Name, Err: err.Error(), msg: "Invalid[" + value + ":" + p.Name + ":" + err.Error() + "]"})
+				continue
+			}
+			vars[p.Name] = v
+		}
 	}
 
 	// Were there any errors.
 	if errs != nil {
-		return errors.New(strings.Join(errs, ","))
+		return errs
 	}
 
 	return nil
 }
 
+// paramTypes returns the declared types of the parameters of the set that
+// are not strings.
+func paramTypes(set *query.Set) map[string]string {
+	var types map[string]string
+	for _, p := range set.Params {
+		if p.Type == "" || p.Type == query.ParamString {
+			continue
+		}
+
+		if types == nil {
+			types = make(map[string]string)
+		}
+		types[p.Name] = p.Type
+	}
+
+	return types
+}
+
+// validateParam converts the value into the canonical form for the type of
+// the parameter and checks the value against the constraints.
+func validateParam(p *query.Param, value string) (string, error) {
+	v, size, err := paramValue(p.Type, value)
+	if err != nil {
+		return "", err
+	}
+
+	// Min and max apply to the value of numbers and the length of
+	// strings and lists.
+	if p.Min != nil && size < *p.Min {
+		return "", fmt.Errorf("Value is less than the min of %v", *p.Min)
+	}
+
+	if p.Max != nil && size > *p.Max {
+		return "", fmt.Errorf("Value is greater than the max of %v", *p.Max)
+	}
+
+	if len(p.Enum) > 0 {
+		values := []string{v}
+		if p.Type == query.ParamList {
+			values = splitList(v)
+		}
+
+		for _, v := range values {
+			if !inEnum(p, v) {
+				return "", fmt.Errorf("Value %q is not one of %s", v, strings.Join(p.Enum, ", "))
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// inEnum returns true when the value matches one of the enum values of the
+// parameter. Lists are checked for each item.
+func inEnum(p *query.Param, value string) bool {
+	typ := p.Type
+	if typ == query.ParamList {
+		typ = query.ParamString
+	}
+
+	for _, e := range p.Enum {
+		if v, _, err := paramValue(typ, e); err == nil && v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dateLayouts are the layouts date parameters can be provided in.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04:05.999",
+	"2006-01-02T15:04:05.999Z",
+	time.RFC3339Nano,
+}
+
+// dateLayout is the canonical layout for date parameters, which is a layout
+// the #date command can parse.
+const dateLayout = "2006-01-02T15:04:05.000Z"
+
+// paramValue converts the value into the canonical form for the type. The
+// size the min and max constraints are checked against is also returned.
+func paramValue(typ string, value string) (string, float64, error) {
+	switch typ {
+	case "", query.ParamString:
+		return value, float64(utf8.RuneCountInString(value)), nil
+
+	case query.ParamInt:
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("Value %q is not an int", value)
+		}
+		return strconv.FormatInt(i, 10), float64(i), nil
+
+	case query.ParamFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("Value %q is not a float", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), f, nil
+
+	case query.ParamBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", 0, fmt.Errorf("Value %q is not a bool", value)
+		}
+		return strconv.FormatBool(b), 0, nil
+
+	case query.ParamDate:
+		t, err := parseDate(value)
+		if err != nil {
+			return "", 0, err
+		}
+		return t.UTC().Format(dateLayout), 0, nil
+
+	case query.ParamObjectID:
+		if !bson.IsObjectIdHex(value) {
+			return "", 0, fmt.Errorf("Value %q is not an objectid", value)
+		}
+		return strings.ToLower(value), 0, nil
+
+	case query.ParamList:
+		items := splitList(value)
+		return strings.Join(items, ","), float64(len(items)), nil
+	}
+
+	return "", 0, fmt.Errorf("Invalid parameter type %q", typ)
+}
+
+// splitList splits the comma separated items of a list, removing the space
+// around them and any empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// typedValue converts the canonical value of a parameter into the value of
+// its declared type.
+func typedValue(context interface{}, typ string, value string) (interface{}, error) {
+	switch typ {
+	case query.ParamInt:
+		return number(context, value)
+
+	case query.ParamFloat:
+		return float(context, value)
+
+	case query.ParamBool:
+		return boolean(context, value)
+
+	case query.ParamDate:
+		return isoDate(context, value)
+
+	case query.ParamObjectID:
+		return objID(context, value)
+
+	case query.ParamList:
+		return listValues(context, "list", value)
+	}
+
+	return value, nil
+}
+
 // validateRegex compares the value to the configured regex.
 func validateRegex(context interface{}, db *db.DB, value string, name string) error {
 	rgx, err := regex.GetByName(context, db, name)
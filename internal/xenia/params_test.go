@@ -0,0 +1,195 @@
+package xenia
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
+)
+
+// TestParams tests converting and validating variables against typed
+// parameters.
+func TestParams(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	one := 1.0
+	three := 3.0
+
+	params := []struct {
+		name  string
+		param query.Param
+		value string
+		exp   string
+		fail  bool
+	}{
+		{"String", query.Param{}, "42021", "42021", false},
+		{"String Max", query.Param{Max: &three}, "42021", "", true},
+		{"Int", query.Param{Type: query.ParamInt}, " 42 ", "42", false},
+		{"Int Invalid", query.Param{Type: query.ParamInt}, "4.2", "", true},
+		{"Int Min", query.Param{Type: query.ParamInt, Min: &one}, "0", "", true},
+		{"Float", query.Param{Type: query.ParamFloat, Max: &three}, "2.50", "2.5", false},
+		{"Bool", query.Param{Type: query.ParamBool}, "T", "true", false},
+		{"Bool Invalid", query.Param{Type: query.ParamBool}, "yes", "", true},
+		{"Date", query.Param{Type: query.ParamDate}, "2013-01-16", "2013-01-16T00:00:00.000Z", false},
+		{"Date Zone", query.Param{Type: query.ParamDate}, "2013-01-16T10:00:00+02:00", "2013-01-16T08:00:00.000Z", false},
+		{"Date Invalid", query.Param{Type: query.ParamDate}, "16/01/2013", "", true},
+		{"Objectid", query.Param{Type: query.ParamObjectID}, "5660BC6E16908CAE692E0593", "5660bc6e16908cae692e0593", false},
+		{"Objectid Invalid", query.Param{Type: query.ParamObjectID}, "5660bc6e", "", true},
+		{"List", query.Param{Type: query.ParamList, Max: &three}, "a, b,,c", "a,b,c", false},
+		{"List Max", query.Param{Type: query.ParamList, Max: &one}, "a,b", "", true},
+		{"Enum", query.Param{Type: query.ParamInt, Enum: []string{"10", "20"}}, "020", "20", false},
+		{"Enum Invalid", query.Param{Enum: []string{"open", "closed"}}, "deleted", "", true},
+		{"Enum List", query.Param{Type: query.ParamList, Enum: []string{"open", "closed"}}, "open,deleted", "", true},
+	}
+
+	t.Log("Given the need to validate variables against typed parameters.")
+	{
+		for _, p := range params {
+			t.Logf("\tWhen using the %q parameter", p.name)
+			{
+				v, err := validateParam(&p.param, p.value)
+				if p.fail {
+					if err == nil {
+						t.Errorf("\t%s\tShould not be able to validate the value.", tests.Failed)
+						continue
+					}
+					t.Logf("\t%s\tShould not be able to validate the value : %v", tests.Success, err)
+					continue
+				}
+
+				if err != nil {
+					t.Errorf("\t%s\tShould be able to validate the value : %v", tests.Failed, err)
+					continue
+				}
+				t.Logf("\t%s\tShould be able to validate the value.", tests.Success)
+
+				if v != p.exp {
+					t.Errorf("\t%s\tShould get back %q : %q", tests.Failed, p.exp, v)
+					continue
+				}
+				t.Logf("\t%s\tShould get back %q.", tests.Success, p.exp)
+			}
+		}
+	}
+
+	t.Log("Given the need to process the parameters of a set.")
+	{
+		set := query.Set{
+			Params: []query.Param{
+				{Name: "limit", Type: query.ParamInt, Default: "10"},
+				{Name: "since", Type: query.ParamDate},
+				{Name: "station_id"},
+				{Name: "sort", Optional: true},
+			},
+		}
+
+		t.Log("\tWhen variables are invalid or missing")
+		{
+			vars := map[string]string{"limit": "ten"}
+
+			err := processParams(tests.Context, nil, &set, vars)
+			perr, ok := err.(ParamsError)
+			if !ok {
+				t.Fatalf("\t%s\tShould get back a params error : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get back a params error.", tests.Success)
+
+			var names []string
+			for _, ip := range perr {
+				names = append(names, ip.Name)
+			}
+
+			if exp := []string{"limit", "since", "station_id"}; !reflect.DeepEqual(names, exp) {
+				t.Fatalf("\t%s\tShould get an error for each invalid parameter : %v", tests.Failed, names)
+			}
+			t.Logf("\t%s\tShould get an error for each invalid parameter.", tests.Success)
+
+			if exp := `Invalid[ten:limit:Value "ten" is not an int],Missing[since],Missing[station_id]`; err.Error() != exp {
+				t.Fatalf("\t%s\tShould get back the error message : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get back the error message.", tests.Success)
+		}
+
+		t.Log("\tWhen variables are substituted as their types")
+		{
+			vars := map[string]string{"since": "2013-01-16", "station_id": "42021"}
+
+			if err := processParams(tests.Context, nil, &set, vars); err != nil {
+				t.Fatalf("\t%s\tShould be able to process the parameters : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to process the parameters.", tests.Success)
+
+			doc := map[string]interface{}{
+				"limit":      "#string:limit",
+				"since":      "#string:since",
+				"station_id": "#string:station_id",
+			}
+
+			if err := processVariables(tests.Context, doc, vars, paramTypes(&set), nil, nil); err != nil {
+				t.Fatalf("\t%s\tShould be able to process the variables : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to process the variables.", tests.Success)
+
+			exp := map[string]interface{}{
+				"limit":      10,
+				"since":      time.Date(2013, 1, 16, 0, 0, 0, 0, time.UTC),
+				"station_id": "42021",
+			}
+
+			if !reflect.DeepEqual(doc, exp) {
+				t.Log(doc)
+				t.Fatalf("\t%s\tShould get back the typed values.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back the typed values.", tests.Success)
+		}
+
+		t.Log("\tWhen a variable with a regex is missing")
+		{
+			rset := query.Set{Params: []query.Param{{Name: "station_id", RegexName: "station"}}}
+
+			err := processParams(tests.Context, nil, &rset, map[string]string{})
+			if exp := "Missing[station_id]"; err == nil || err.Error() != exp {
+				t.Fatalf("\t%s\tShould only get back the missing error : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould only get back the missing error.", tests.Success)
+		}
+
+		t.Log("\tWhen the parameters are checked before executing the set")
+		{
+			vars := map[string]string{"since": "2013-01-16", "station_id": "42021"}
+
+			if err := CheckParams(tests.Context, nil, &set, vars); err != nil {
+				t.Fatalf("\t%s\tShould be able to check the parameters : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to check the parameters.", tests.Success)
+
+			if vars["limit"] != "10" || vars["since"] != "2013-01-16T00:00:00.000Z" {
+				t.Fatalf("\t%s\tShould load the defaults and convert the values : %v", tests.Failed, vars)
+			}
+			t.Logf("\t%s\tShould load the defaults and convert the values.", tests.Success)
+
+			if _, ok := CheckParams(tests.Context, nil, &set, map[string]string{}).(ParamsError); !ok {
+				t.Fatalf("\t%s\tShould get back a params error for missing variables.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get back a params error for missing variables.", tests.Success)
+
+			pset := set
+			pset.Name = "Checked"
+			pset.Enabled = true
+			pset.Queries = []query.Query{{Name: "Stations", Type: query.TypePipeline, Collection: "stations", Commands: []map[string]interface{}{{"$limit": "#number:limit"}}}}
+
+			if _, err := prepareSet(tests.Context, nil, &pset, map[string]string{"limit": "ten"}, true); err != nil {
+				t.Fatalf("\t%s\tShould not process the checked variables again : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not process the checked variables again.", tests.Success)
+
+			if _, err := prepareSet(tests.Context, nil, &pset, map[string]string{"limit": "ten"}, false); err == nil {
+				t.Fatalf("\t%s\tShould process the variables that are not checked.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould process the variables that are not checked.", tests.Success)
+		}
+	}
+}
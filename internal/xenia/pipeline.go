@@ -1,68 +1,91 @@
 package xenia
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/db/mongo"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/mask"
 	"github.com/coralproject/shelf/internal/xenia/query"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 // execPipeline executes the sepcified pipeline query.
-func execPipeline(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, explain bool) (docs, []map[string]interface{}, error) {
+func execPipeline(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
 
 	// I am returning commands as the second return value because if there
 	// is an error I need to send how far we got back to the client. If not,
 	// the user will not understand the error message.
 
-	// We need to check to see if the last command is the extended $save command.
-	commands := q.Commands
-	l := len(q.Commands) - 1
-
 	// Validate we have scripts to run.
-	if l < 0 {
-		return docs{}, commands, errors.New("Invalid pipeline script")
+	if len(q.Commands) == 0 {
+		return docs{}, q.Commands, errors.New("Invalid pipeline script")
 	}
 
 	// If the last command is a $save, capture its value and remove
 	// it from the pipeline.
-	var save map[string]interface{}
-	if v, exists := q.Commands[l]["$save"]; exists {
-		if cmd, ok := v.(map[string]interface{}); ok {
-			save = cmd
-		}
+	commands, save := extractSave(q)
 
-		commands = q.Commands[0:l]
-	}
-
-	var agg string
 	var pipeline []bson.M
 
 	// Iterate over the commands and build the pipeline.
 	for _, command := range commands {
 
 		// Do we have variables to be substitued.
-		if vars != nil {
-			if err := ProcessVariables(context, command, vars, data); err != nil {
+		if vars != nil && !opts.noVars {
+			if err := processVariables(context, command, vars, opts.types, opts.claims(), data); err != nil {
 				return docs{}, commands, err
 			}
 		}
 
 		// Add the operation to the slice for the pipeline.
 		pipeline = append(pipeline, command)
+	}
 
-		// Build a logable version of this pipeline.
-		agg += mongo.Query(command) + ",\n"
+	// Add the stages to fetch the page of results.
+	var pg *pager
+	if q.Page != nil {
+		var err error
+		if pg, err = newPager(context, db, q, vars); err != nil {
+			return docs{}, commands, err
+		}
+
+		pipeline = append(pipeline, pg.stages()...)
+	}
+
+	// The stages may not read or write the collections of xenia itself.
+	if err := checkReserved(context, q.Collection, pipeline); err != nil {
+		return docs{}, commands, err
+	}
+
+	// Apply the policies of the collection for the caller. The filter of the
+	// policies becomes the first stage, or part of the $geoNear query, so
+	// every document the stages of the query see already passed it.
+	pipeline, err := applyPipelinePolicies(context, db, q.Collection, pipeline, opts)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Build a logable version of this pipeline.
+	var agg string
+	for _, stage := range pipeline {
+		agg += mongo.Query(stage) + ",\n"
+	}
+
+	// Do we want the final commands without executing them.
+	if opts.dryRun {
+		return dryRun(q, pipeline, save, data), commands, nil
 	}
 
 	// Do we want the explain output.
-	if explain {
+	if opts.explain {
 
 		// Build the pipeline function for the execution for explain.
 		var m bson.M
@@ -76,111 +99,345 @@ func execPipeline(context interface{}, db *db.DB, q *query.Query, vars map[strin
 			return docs{}, commands, err
 		}
 
-		return docs{q.Name, []bson.M{m}}, commands, nil
+		return docs{Name: q.Name, Docs: []bson.M{m}}, commands, nil
+	}
+
+	// Build the pipeline function for the execution.
+	f := func(c *mgo.Collection) *mgo.Iter {
+		log.Dev(context, "executePipeline", "MGO Started\ndb.%s.aggregate([\n%s])", c.Name, agg)
+		return aggregate(c, pipeline, queryTimeout(context, q))
 	}
 
+	// Track the documents of the page as they are streamed.
+	emit := opts.emit
+	if pg != nil && emit != nil {
+		emit = pg.track(emit)
+	}
+
+	// Execute the pipeline.
+	ropts := opts
+	ropts.emit = emit
+	results, err := readResults(context, db, q, save != nil, ropts, f)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	log.Dev(context, "executePipeline", "Completed")
+
+	// Perform any masking and saving that is required. Streamed
+	// results have already been masked.
+	results, err = processResults(context, db, q, save, results, data, emit == nil)
+	if err != nil {
+		return docs{}, commands, err
+	}
+
+	// Provide the token for the next page of results.
+	var next string
+	if pg != nil {
+		if emit == nil {
+			pg.seen(results)
+		}
+
+		if next, err = pg.next(); err != nil {
+			log.Error(context, "executePipeline", err, "Building page token")
+			return docs{}, commands, err
+		}
+	}
+
+	return docs{Name: q.Name, Docs: results, Next: next}, commands, nil
+}
+
+//==============================================================================
+
+// extractSave checks to see if the last command is the extended $save command.
+// If it is, its value is captured and removed from the commands to execute.
+func extractSave(q *query.Query) ([]map[string]interface{}, map[string]interface{}) {
+	l := len(q.Commands) - 1
+	if l < 0 {
+		return q.Commands, nil
+	}
+
+	v, exists := q.Commands[l]["$save"]
+	if !exists {
+		return q.Commands, nil
+	}
+
+	var save map[string]interface{}
+	if cmd, ok := v.(map[string]interface{}); ok {
+		save = cmd
+	}
+
+	return q.Commands[0:l], save
+}
+
+// queryTimeout returns the timeout configured for the query or the default
+// timeout if none is provided.
+func queryTimeout(context interface{}, q *query.Query) time.Duration {
+
 	// Set the default timeout for the session.
 	timeout := 25 * time.Second
 	if q.Timeout != "" {
 		if d, err := time.ParseDuration(q.Timeout); err != nil {
-			log.Dev(context, "executePipeline", "WARNING : Unable to Set Timeout[%s], using default.", q.Timeout)
+			log.Dev(context, "queryTimeout", "WARNING : Unable to Set Timeout[%s], using default.", q.Timeout)
 		} else {
 			timeout = d
 		}
 	}
 
-	log.Dev(context, "executePipeline", "MGO Timeout Set[%s]", timeout)
+	return timeout
+}
 
-	// Build the pipeline function for the execution.
-	var results []bson.M
-	f := func(c *mgo.Collection) error {
-		log.Dev(context, "executePipeline", "MGO Started\ndb.%s.aggregate([\n%s])", c.Name, agg)
-		err := c.Pipe(pipeline).All(&results)
-		return err
-	}
+// execTimeout executes the function against the query collection. We give up
+// on the operation once the query timeout expires or the execution is
+// cancelled, which includes the set going over its total timeout. When we
+// give up, the operations the function started on the server are killed so
+// they don't keep running.
+func execTimeout(context interface{}, ctx context.Context, db *db.DB, q *query.Query, f func(*mgo.Collection) error) error {
+	timeout := queryTimeout(context, q)
+
+	log.Dev(context, "execTimeout", "MGO Timeout Set[%s]", timeout)
 
-	// Set the channel to one because we might not be around
+	// Set the channels to one because we might not be around
 	// waiting for the result on timeouts.
 	wait := make(chan error, 1)
+	client := make(chan string, 1)
 
-	// Execute the pipeline.
+	// Execute the function.
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				log.Dev(context, "executePipeline", "******> Recovered from timing out")
+				log.Dev(context, "execTimeout", "******> Recovered from timing out")
+			}
+
+			// Make sure no one waits on the client if the function
+			// never ran.
+			select {
+			case client <- "":
+			default:
 			}
-			log.Dev(context, "executePipeline", "MGO Response Complete")
+
+			log.Dev(context, "execTimeout", "MGO Response Complete")
 		}()
 
-		wait <- db.ExecuteMGOTimeout(context, timeout, q.Collection, f)
+		wait <- db.ExecuteMGOTimeout(context, timeout, q.Collection, func(c *mgo.Collection) error {
+
+			// Use a session of our own so the operations we start can
+			// be identified by the connection they are running on.
+			ses := c.Database.Session.Copy()
+			defer ses.Close()
+
+			client <- clientAddr(context, ses)
+
+			return f(c.With(ses))
+		})
 	}()
 
 	// Did any errors occur.
 	select {
 
-	// Wait for the response from executing the pipeline.
+	// Wait for the response from executing the function.
 	case err := <-wait:
 		if err != nil {
 			if _, ok := err.(*net.OpError); ok {
-				log.Error(context, "executePipeline", err, "Timed out Network")
-				return docs{}, commands, errors.New("Completed : Timed out executing commands")
+				log.Error(context, "execTimeout", err, "Timed out Network")
+				return errors.New("Completed : Timed out executing commands")
 			}
 
-			log.Error(context, "executePipeline", err, "Completed")
-			return docs{}, commands, err
+			log.Error(context, "execTimeout", err, "Completed")
+			return err
 		}
 
 	// Wait to timeout the entire operation.
 	case <-time.After(timeout):
+		killOps(context, db, client)
+
 		err := errors.New("Timedout executing commands")
-		log.Error(context, "executePipeline", err, "Completed : Timed out Processing")
-		return docs{}, commands, err
+		log.Error(context, "execTimeout", err, "Completed : Timed out Processing")
+		return err
+
+	// Wait for the execution to be cancelled.
+	case <-ctx.Done():
+		killOps(context, db, client)
+
+		err := errors.New("Cancelled executing commands")
+		if timedOut(ctx) {
+			err = fmt.Errorf("Query %q went over the set timeout", q.Name)
+		}
+
+		log.Error(context, "execTimeout", err, "Completed : %v", ctx.Err())
+		return err
 	}
 
-	log.Dev(context, "executePipeline", "Completed")
+	return nil
+}
 
-	// If there were no results, return an empty array.
+// errStopped is returned when documents are emitted after the query has
+// already completed, such as after a timeout.
+var errStopped = errors.New("Query has stopped emitting results")
+
+// readResults executes the query and reads the documents from the iterator
+// the function provides, checking each document against the limits of the
+// set. When the results are being streamed, each document is masked and
+// emitted as it is read and is only kept if keep is true.
+func readResults(context interface{}, db *db.DB, q *query.Query, keep bool, opts execOpts, iter func(*mgo.Collection) *mgo.Iter) ([]bson.M, error) {
+	emit := opts.emit
+
+	// Streamed documents are masked as they are read.
+	var masks map[string]mask.Mask
+	if emit != nil {
+		var err error
+		if masks, err = mask.GetByCollection(context, db, q.Collection); err != nil {
+
+			// If there are no masks to process then great.
+			masks = nil
+		}
+	}
+
+	// The function can still be reading documents after a timeout, so
+	// no document can be emitted once we return.
+	var mu sync.Mutex
+	var stopped bool
+	defer func() {
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+	}()
+
+	emitDoc := func(doc bson.M) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			return errStopped
+		}
+
+		return emit(doc)
+	}
+
+	var results []bson.M
+	f := func(c *mgo.Collection) error {
+		it := iter(c)
+
+		for n := 1; ; n++ {
+			var raw bson.Raw
+			if !it.Next(&raw) {
+				break
+			}
+
+			if err := opts.limits.check(q, n, len(raw.Data)); err != nil {
+				it.Close()
+				return err
+			}
+
+			var doc bson.M
+			if err := raw.Unmarshal(&doc); err != nil {
+				it.Close()
+				return err
+			}
+
+			if emit != nil {
+				if err := matchMaskField(context, masks, doc); err != nil {
+					it.Close()
+					return err
+				}
+
+				if err := emitDoc(doc); err != nil {
+					it.Close()
+					return err
+				}
+
+				if !keep {
+					continue
+				}
+			}
+
+			results = append(results, doc)
+		}
+
+		return it.Close()
+	}
+
+	if err := execTimeout(context, opts.ctx, db, q, f); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// emitResults emits the documents when the results are being streamed.
+func emitResults(emit emitFunc, results []bson.M) error {
+	if emit == nil {
+		return nil
+	}
+
+	for _, doc := range results {
+		if err := emit(doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// processResults performs any masking and saving required for the results
+// of the query. If there were no results, an empty array is returned.
+func processResults(context interface{}, db *db.DB, q *query.Query, save map[string]interface{}, results []bson.M, data map[string]interface{}, masking bool) ([]bson.M, error) {
 	if results == nil {
-		return docs{q.Name, []bson.M{}}, commands, nil
+
+		// No results still replace the documents saved in a collection.
+		if isCollectionSave(save) {
+			if err := saveResult(context, db, save, nil, data); err != nil {
+				return nil, err
+			}
+		}
+
+		return []bson.M{}, nil
 	}
 
 	// Perform any masking that is required.
-	if err := processMasks(context, db, q.Collection, results); err != nil {
-		return docs{}, commands, err
+	if masking {
+		if err := processMasks(context, db, q.Collection, results); err != nil {
+			return nil, err
+		}
 	}
 
 	// Do we need to save the result.
 	if save != nil {
-		if err := saveResult(context, save, results, data); err != nil {
-			return docs{}, commands, err
+		if err := saveResult(context, db, save, results, data); err != nil {
+			return nil, err
 		}
 	}
 
-	return docs{q.Name, results}, commands, nil
+	return results, nil
 }
 
 // saveResult processes the $save command for this result.
-func saveResult(context interface{}, save map[string]interface{}, results []bson.M, data map[string]interface{}) error {
+func saveResult(context interface{}, db *db.DB, save map[string]interface{}, results []bson.M, data map[string]interface{}) error {
 
 	// {"$map": "list"}
+	// {"$collection": "name"}
 
 	// Capture the key and value and process the save.
 	for cmd, value := range save {
-		name, ok := value.(string)
-		if !ok {
-			err := fmt.Errorf("Save key \"%v\" is a %T but must be a string", value, value)
-			log.Error(context, "saveResult", err, "Extracting save key")
-			return err
-		}
-
 		switch cmd {
 
 		// Save the results into the map under the specified key.
 		case "$map":
+			name, ok := value.(string)
+			if !ok {
+				err := fmt.Errorf("Save key \"%v\" is a %T but must be a string", value, value)
+				log.Error(context, "saveResult", err, "Extracting save key")
+				return err
+			}
+
 			log.Dev(context, "saveResult", "Saving result to map[%s]", name)
 			data[name] = results
 			return nil
 
+		// Save the results into the specified collection.
+		case "$collection":
+			return saveCollection(context, db, value, results)
+
 		default:
 			err := fmt.Errorf("Invalid save location %q", cmd)
 			log.Error(context, "saveResult", err, "Nothing saved")
@@ -20,6 +20,8 @@ func getNegExecSet() []execSet {
 		dataInMalformed(),
 		mongoRegexMalformed1(),
 		mongoRegexMalformed2(),
+		limitMaxDocs(),
+		limitMaxSize(),
 	}
 }
 
@@ -407,3 +409,56 @@ func mongoRegexMalformed2() execSet {
 		},
 	}
 }
+
+// limitMaxDocs performs a query that returns more documents than the set allows.
+func limitMaxDocs() execSet {
+	return execSet{
+		fail: true,
+		set: &query.Set{
+			Name:    "Limit Max Docs",
+			Enabled: true,
+			Limits:  &query.Limits{MaxDocs: 1},
+			Queries: []query.Query{
+				{
+					Name:       "Max Docs",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":{"commands":[{"$project":{"_id":0,"name":1}}],"error":"Query \"Max Docs\" returned more than the limit of 1 documents"}}`,
+		},
+	}
+}
+
+// limitMaxSize performs a query that returns more data than the set allows.
+func limitMaxSize() execSet {
+	return execSet{
+		fail: true,
+		set: &query.Set{
+			Name:    "Limit Max Size",
+			Enabled: true,
+			Limits:  &query.Limits{MaxSize: 10},
+			Queries: []query.Query{
+				{
+					Name:       "Max Size",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": "42021"}},
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":{"commands":[{"$match":{"station_id":"42021"}},{"$project":{"_id":0,"name":1}}],"error":"Query \"Max Size\" went over the response size limit of 10 bytes"}}`,
+		},
+	}
+}
@@ -27,6 +27,8 @@ func getPosExecSet() []execSet {
 		withAdjTime(),
 		fieldReplace(),
 		explain(),
+		page(),
+		when(),
 	}
 }
 
@@ -631,3 +633,82 @@ func explain() execSet {
 		},
 	}
 }
+
+// page performs a query returning the first page of results.
+func page() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Page",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Page",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Page:       &query.Page{Sort: []string{"station_id"}, Size: 1},
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44008"}}}},
+						{"$project": map[string]interface{}{"name": 1, "station_id": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`#find:"name":"C14 - Pasco County Buoy, FL","station_id":"42021"}],"Next":"`,
+		},
+	}
+}
+
+// when performs queries that are only executed when their condition is true.
+func when() execSet {
+	empty := false
+
+	return execSet{
+		fail: false,
+		vars: map[string]string{"station_id": "42021"},
+		set: &query.Set{
+			Name:    "When",
+			Enabled: true,
+			Params: []query.Param{
+				{Name: "station_id"},
+			},
+			Queries: []query.Query{
+				{
+					Name:       "Save",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": "00000"}},
+						{"$save": map[string]interface{}{"$map": "list"}},
+					},
+				},
+				{
+					Name:       "Skipped",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					When:       &query.When{Data: "list", Empty: &empty},
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": "#data.*:list.station_id"}}},
+					},
+				},
+				{
+					Name:       "Station",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					When:       &query.When{Var: "station_id", Equals: "42021"},
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": "#string:station_id"}},
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Skipped","Docs":[],"Skipped":true},{"Name":"Station","Docs":[{"name":"C14 - Pasco County Buoy, FL"}]}]}`,
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package xenia
+
+import (
+	"fmt"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/policy"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// applyPipelinePolicies prepends the filter of the policies that apply to the
+// caller as a $match stage of the pipeline. A pipeline starting with $geoNear
+// has the filter added to its query since $geoNear must be the first stage.
+// Looking up documents from a collection with policies is not allowed since
+// the policies can't be applied to the lookup.
+func applyPipelinePolicies(context interface{}, db *db.DB, collection string, pipeline []bson.M, opts execOpts) ([]bson.M, error) {
+	for _, stage := range pipeline {
+		if err := checkLookups(context, db, stage, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	filter, err := policyFilter(context, db, collection, opts)
+	if err != nil || filter == nil {
+		return pipeline, err
+	}
+
+	if len(pipeline) > 0 {
+		if v, exists := pipeline[0]["$geoNear"]; exists {
+			geo, err := cmdDoc(v)
+			if err != nil {
+				log.Error(context, "applyPipelinePolicies", err, "Checking $geoNear")
+				return nil, err
+			}
+
+			query, err := cmdDoc(geo["query"])
+			if err != nil {
+				log.Error(context, "applyPipelinePolicies", err, "Checking $geoNear query")
+				return nil, err
+			}
+
+			geo["query"] = andFilter(query, filter)
+			return pipeline, nil
+		}
+	}
+
+	return append([]bson.M{{"$match": filter}}, pipeline...), nil
+}
+
+// applyFilterPolicies adds the filter of the policies that apply to the
+// caller to the filter of a find, count or distinct command. The command is
+// updated so the final commands of a dry run show the filter.
+func applyFilterPolicies(context interface{}, db *db.DB, collection string, command map[string]interface{}, filter map[string]interface{}, opts execOpts) (map[string]interface{}, error) {
+	pf, err := policyFilter(context, db, collection, opts)
+	if err != nil || pf == nil {
+		return filter, err
+	}
+
+	filter = andFilter(filter, pf)
+	command["filter"] = filter
+
+	return filter, nil
+}
+
+// policyFilter returns the filter of the policies of the collection that
+// apply to the caller, nil when none apply. The #claim variables of the
+// policies are substituted with the claims of the caller. The policies only
+// see the claims so the variables of the set can't change them.
+func policyFilter(context interface{}, db *db.DB, collection string, opts execOpts) (map[string]interface{}, error) {
+
+	// Without a database there are no policies, which is only the case for
+	// a dry run of a set.
+	if db == nil {
+		return nil, nil
+	}
+
+	policies, err := policy.GetByCollection(context, db, collection)
+	if err != nil {
+
+		// If there are no policies to apply then great.
+		if err == policy.ErrNotFound {
+			return nil, nil
+		}
+
+		log.Error(context, "policyFilter", err, "Loading policies")
+		return nil, err
+	}
+
+	var filters []interface{}
+	for _, p := range policies {
+		if !p.Applies(opts.caller) {
+			continue
+		}
+
+		// Each execution gets its own copy of the filter since variable
+		// substitution changes it.
+		match := copyValue(p.Match).(map[string]interface{})
+		if err := processVariables(context, match, map[string]string{}, nil, opts.claims(), nil); err != nil {
+			return nil, fmt.Errorf("Policy %q for role %q : %v", p.Collection, p.Role, err)
+		}
+
+		filters = append(filters, match)
+	}
+
+	// Every policy that applies must be matched.
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return filters[0].(map[string]interface{}), nil
+	default:
+		return map[string]interface{}{"$and": filters}, nil
+	}
+}
+
+// andFilter returns a filter matching both filters.
+func andFilter(filter map[string]interface{}, pf map[string]interface{}) map[string]interface{} {
+	if len(filter) == 0 {
+		return pf
+	}
+
+	return map[string]interface{}{"$and": []interface{}{pf, filter}}
+}
+
+// checkLookups walks the value looking for stages that read or write another
+// collection, like $lookup, $graphLookup, $unionWith and $out, including the
+// stages of a $facet, and fails if that collection has policies that apply
+// to the caller.
+func checkLookups(context interface{}, db *db.DB, value interface{}, opts execOpts) error {
+	switch v := value.(type) {
+	case bson.M:
+		return checkLookups(context, db, map[string]interface{}(v), opts)
+
+	case map[string]interface{}:
+		for key, value := range v {
+			if from := stageCollection(key, value); from != "" {
+				filter, err := policyFilter(context, db, from, opts)
+				if err != nil {
+					return err
+				}
+
+				if filter != nil {
+					err := fmt.Errorf("Collection %q has policies and can't be used by %s", from, key)
+					log.Error(context, "checkLookups", err, "Checking policies")
+					return err
+				}
+			}
+
+			if err := checkLookups(context, db, value, opts); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for i := range v {
+			if err := checkLookups(context, db, v[i], opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
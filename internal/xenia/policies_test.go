@@ -0,0 +1,94 @@
+package xenia
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+)
+
+// TestClaimVariables tests substituting the claims of the caller.
+func TestClaimVariables(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	claims := map[string]interface{}{
+		"sub":      "user1",
+		"stations": []interface{}{"42021", "42022"},
+	}
+
+	t.Log("Given the need to substitute the claims of the caller.")
+	{
+		t.Log("\tWhen the claims are provided")
+		{
+			doc := map[string]interface{}{
+				"owner":      "#claim:sub",
+				"station_id": map[string]interface{}{"$in": "#claim:stations"},
+			}
+
+			exp := map[string]interface{}{
+				"owner":      "user1",
+				"station_id": map[string]interface{}{"$in": []interface{}{"42021", "42022"}},
+			}
+
+			if err := processVariables(tests.Context, doc, map[string]string{}, nil, claims, nil); err != nil {
+				t.Fatalf("\t%s\tShould be able to substitute the claims : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to substitute the claims.", tests.Success)
+
+			if !reflect.DeepEqual(doc, exp) {
+				t.Fatalf("\t%s\tShould get back the claims : %v", tests.Failed, doc)
+			}
+			t.Logf("\t%s\tShould get back the claims.", tests.Success)
+		}
+
+		t.Log("\tWhen the claim is missing")
+		{
+			doc := map[string]interface{}{"owner": "#claim:email"}
+			if err := processVariables(tests.Context, doc, map[string]string{}, nil, claims, nil); err == nil {
+				t.Fatalf("\t%s\tShould fail to substitute the claim : %v", tests.Failed, doc)
+			}
+			t.Logf("\t%s\tShould fail to substitute the claim.", tests.Success)
+		}
+
+		t.Log("\tWhen there is no caller")
+		{
+			doc := map[string]interface{}{"owner": "#claim:sub"}
+			if err := processVariables(tests.Context, doc, map[string]string{}, nil, nil, nil); err == nil {
+				t.Fatalf("\t%s\tShould fail to substitute the claim : %v", tests.Failed, doc)
+			}
+			t.Logf("\t%s\tShould fail to substitute the claim.", tests.Success)
+		}
+	}
+}
+
+// TestAndFilter tests adding the filter of the policies to a filter.
+func TestAndFilter(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	pf := map[string]interface{}{"owner": "user1"}
+
+	table := []struct {
+		name   string
+		filter map[string]interface{}
+		exp    map[string]interface{}
+	}{
+		{"no filter", nil, pf},
+		{"empty filter", map[string]interface{}{}, pf},
+		{"filter", map[string]interface{}{"owner": "user2"}, map[string]interface{}{"$and": []interface{}{pf, map[string]interface{}{"owner": "user2"}}}},
+	}
+
+	t.Log("Given the need to add the filter of the policies to a filter.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen there is a %s", tt.name)
+			{
+				if got := andFilter(tt.filter, pf); !reflect.DeepEqual(got, tt.exp) {
+					t.Fatalf("\t%s\tShould get back the combined filter : %v", tests.Failed, got)
+				}
+				t.Logf("\t%s\tShould get back the combined filter.", tests.Success)
+			}
+		}
+	}
+}
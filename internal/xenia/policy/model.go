@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"errors"
+
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"gopkg.in/bluesuncorp/validator.v8"
+)
+
+// Set of wildcards a policy can use.
+const (
+	AllCollections = "*" // The policy applies to every collection.
+	AllRoles       = "*" // The policy applies to every caller.
+)
+
+//==============================================================================
+
+// validate is used to perform model field validation.
+var validate *validator.Validate
+
+func init() {
+	validate = validator.New(&validator.Config{TagName: "validate"})
+}
+
+//==============================================================================
+
+// Policy contains the filter the documents of a collection must match for a
+// caller with the role to see them. The filter can use the #claim variable
+// command to bind it to the claims of the caller.
+type Policy struct {
+	Collection string                 `bson:"collection" json:"collection" validate:"required"` // Collection the policy applies to, * for all.
+	Role       string                 `bson:"role" json:"role" validate:"required"`             // Role of the callers the policy applies to, * for all.
+	Match      map[string]interface{} `bson:"match" json:"match"`                               // Filter prepended as a $match stage.
+	ACL        *acl.ACL               `bson:"acl,omitempty" json:"acl,omitempty"`               // Who may edit the Policy, execute does not apply.
+}
+
+// Validate checks the policy value for consistency.
+func (p Policy) Validate() error {
+	if err := validate.Struct(p); err != nil {
+		return err
+	}
+
+	if len(p.Match) == 0 {
+		return errors.New("No match filter exists")
+	}
+
+	return nil
+}
+
+// Applies reports if the policy applies to the caller. Only the policies for
+// every caller apply when there is no caller.
+func (p Policy) Applies(caller *acl.Caller) bool {
+	return p.Role == AllRoles || caller.HasRole(p.Role)
+}
+
+// PrepareForInsert replaces the `$` to `_$` when found in the front of field names.
+func (p Policy) PrepareForInsert() {
+	prepareForInsert(p.Match)
+}
+
+// PrepareForUse replaces the `_$` to `$` when found in the front of field names.
+func (p Policy) PrepareForUse() {
+	prepareForUse(p.Match)
+}
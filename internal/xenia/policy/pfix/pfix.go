@@ -0,0 +1,53 @@
+package pfix
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/policy"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var path string
+
+func init() {
+	path = os.Getenv("GOPATH") + "/src/github.com/coralproject/shelf/internal/xenia/policy/pfix/"
+}
+
+//==============================================================================
+
+// Get retrieves a slice of policy documents from the filesystem for testing.
+func Get(fileName string) ([]policy.Policy, error) {
+	file, err := os.Open(path + fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var policies []policy.Policy
+	err = json.NewDecoder(file).Decode(&policies)
+	if err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// Remove is used to clear out all the test policies from the collection.
+func Remove(db *db.DB, collection string) error {
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"$or": []bson.M{bson.M{"collection": collection}, bson.M{"collection": "*", "role": "test"}}}
+		_, err := c.RemoveAll(q)
+		return err
+	}
+
+	if err := db.ExecuteMGO(tests.Context, policy.Collection, f); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package policy provides the service layer for managing the policies that
+// limit the documents of a collection a caller can see. The filter of each
+// policy that applies to the caller is added to every query executed against
+// the collection.
+package policy
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/tenant"
+	gc "github.com/patrickmn/go-cache"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Collection contains the name of the Mongo collection.
+const Collection = "query_policies"
+
+// Set of error variables.
+var (
+	ErrNotFound = errors.New("Policy Not found")
+)
+
+// =============================================================================
+
+// c contans a cache of policy values. The cache will maintain items for one
+// second and then marked as expired. This is a very small cache so the
+// gc time will be every hour.
+
+const (
+	expiration = time.Second
+	cleanup    = time.Hour
+)
+
+var cache = gc.New(expiration, cleanup)
+
+// =============================================================================
+
+// Upsert is used to create or update an existing Policy document.
+func Upsert(context interface{}, db *db.DB, p Policy) error {
+	log.Dev(context, "Upsert", "Started : Policy[%+v]", p)
+
+	// Validate the policy that is provided.
+	if err := p.Validate(); err != nil {
+		log.Error(context, "Upsert", err, "Completed")
+		return err
+	}
+
+	// Fix the match filter so it can be inserted.
+	p.PrepareForInsert()
+	defer p.PrepareForUse()
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"collection": p.Collection, "role": p.Role}
+		log.Dev(context, "Upsert", "MGO : db.%s.upsert(%s, %s)", c.Name, mongo.Query(q), mongo.Query(p))
+		_, err := c.Upsert(q, p)
+		return err
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		log.Error(context, "Upsert", err, "Completed")
+		return err
+	}
+
+	// Flush the cache to invalidate everything.
+	cache.Flush()
+
+	log.Dev(context, "Upsert", "Completed")
+	return nil
+}
+
+// =============================================================================
+
+// GetAll retrieves a list of policies sorted by collection and role.
+func GetAll(context interface{}, db *db.DB) ([]Policy, error) {
+	log.Dev(context, "GetAll", "Started")
+
+	key := tenant.CacheKey(db, "gap")
+	if v, found := cache.Get(key); found {
+		policies := v.([]Policy)
+		log.Dev(context, "GetAll", "Completed : CACHE : Policies[%d]", len(policies))
+		return policies, nil
+	}
+
+	var policies []Policy
+	f := func(c *mgo.Collection) error {
+		log.Dev(context, "GetAll", "MGO : db.%s.find({}).sort([\"collection\", \"role\"])", c.Name)
+		return c.Find(nil).Sort("collection", "role").All(&policies)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetAll", err, "Completed")
+		return nil, err
+	}
+
+	if policies == nil {
+		log.Error(context, "GetAll", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	// Fix the match filters so they can be used.
+	for i := range policies {
+		policies[i].PrepareForUse()
+	}
+
+	cache.Set(key, policies, gc.DefaultExpiration)
+
+	log.Dev(context, "GetAll", "Completed : Policies[%d]", len(policies))
+	return policies, nil
+}
+
+// GetByCollection retrieves the policies for the specified collection,
+// including the policies for every collection. The policies are sorted by
+// role so they are always applied in the same order.
+func GetByCollection(context interface{}, db *db.DB, collection string) ([]Policy, error) {
+	log.Dev(context, "GetByCollection", "Started : Collection[%s]", collection)
+
+	key := tenant.CacheKey(db, "gbc"+collection)
+	if v, found := cache.Get(key); found {
+		policies := v.([]Policy)
+		log.Dev(context, "GetByCollection", "Completed : CACHE : Policies[%d]", len(policies))
+		return policies, nil
+	}
+
+	var policies []Policy
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"$or": []bson.M{bson.M{"collection": collection}, bson.M{"collection": AllCollections}}}
+		log.Dev(context, "GetByCollection", "MGO : db.%s.find(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).All(&policies)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetByCollection", err, "Completed")
+		return nil, err
+	}
+
+	if policies == nil {
+		log.Error(context, "GetByCollection", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	// Fix the match filters so they can be used.
+	for i := range policies {
+		policies[i].PrepareForUse()
+	}
+
+	sort.Sort(byRole(policies))
+
+	cache.Set(key, policies, gc.DefaultExpiration)
+
+	log.Dev(context, "GetByCollection", "Completed : Policies[%d]", len(policies))
+	return policies, nil
+}
+
+// GetByName retrieves the policy for the specified collection and role.
+func GetByName(context interface{}, db *db.DB, collection string, role string) (Policy, error) {
+	log.Dev(context, "GetByName", "Started : Collection[%s] Role[%s]", collection, role)
+
+	key := tenant.CacheKey(db, "gbn"+collection+"/"+role)
+	if v, found := cache.Get(key); found {
+		p := v.(Policy)
+		log.Dev(context, "GetByName", "Completed : CACHE : Policy[%+v]", p)
+		return p, nil
+	}
+
+	var p Policy
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"collection": collection, "role": role}
+		log.Dev(context, "GetByName", "MGO : db.%s.findOne(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).One(&p)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetByName", err, "Completed")
+		return Policy{}, err
+	}
+
+	// Fix the match filter so it can be used.
+	p.PrepareForUse()
+
+	cache.Set(key, p, gc.DefaultExpiration)
+
+	log.Dev(context, "GetByName", "Completed : Policy[%+v]", p)
+	return p, nil
+}
+
+// =============================================================================
+
+// Delete is used to remove an existing Policy document.
+func Delete(context interface{}, db *db.DB, collection string, role string) error {
+	log.Dev(context, "Delete", "Started : Collection[%s] Role[%s]", collection, role)
+
+	p, err := GetByName(context, db, collection, role)
+	if err != nil {
+		return err
+	}
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"collection": p.Collection, "role": p.Role}
+		log.Dev(context, "Delete", "MGO : db.%s.remove(%s)", c.Name, mongo.Query(q))
+		return c.Remove(q)
+	}
+
+	if err := db.ExecuteMGO(context, Collection, f); err != nil {
+		log.Error(context, "Delete", err, "Completed")
+		return err
+	}
+
+	cache.Flush()
+
+	log.Dev(context, "Delete", "Completed")
+	return nil
+}
+
+// =============================================================================
+
+// byRole sorts policies by role and then by collection.
+type byRole []Policy
+
+func (p byRole) Len() int      { return len(p) }
+func (p byRole) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byRole) Less(i, j int) bool {
+	if p[i].Role != p[j].Role {
+		return p[i].Role < p[j].Role
+	}
+	return p[i].Collection < p[j].Collection
+}
@@ -0,0 +1,198 @@
+package policy_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ardanlabs/kit/cfg"
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/db/mongo"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/policy"
+	"github.com/coralproject/shelf/internal/xenia/policy/pfix"
+)
+
+// collection is what we are looking to delete after the test.
+const collection = "test_xenia_data"
+
+func init() {
+	// Initialize the configuration and logging systems. Plus anything
+	// else the web app layer needs.
+	tests.Init("XENIA")
+
+	// Initialize MongoDB using the `tests.TestSession` as the name of the
+	// master session.
+	cfg := mongo.Config{
+		Host:     cfg.MustString("MONGO_HOST"),
+		AuthDB:   cfg.MustString("MONGO_AUTHDB"),
+		DB:       cfg.MustString("MONGO_DB"),
+		User:     cfg.MustString("MONGO_USER"),
+		Password: cfg.MustString("MONGO_PASS"),
+	}
+	tests.InitMongo(cfg)
+}
+
+//==============================================================================
+
+// setup initializes for each indivdual test.
+func setup(t *testing.T, fixture string) ([]policy.Policy, *db.DB) {
+	tests.ResetLog()
+
+	policies, err := pfix.Get(fixture)
+	if err != nil {
+		t.Fatalf("%s\tShould load policy records from file : %v", tests.Failed, err)
+	}
+	t.Logf("%s\tShould load policy records from file.", tests.Success)
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+
+	return policies, db
+}
+
+// teardown deinitializes for each indivdual test.
+func teardown(t *testing.T, db *db.DB) {
+	if err := pfix.Remove(db, collection); err != nil {
+		t.Fatalf("%s\tShould be able to remove the policies : %v", tests.Failed, err)
+	}
+	t.Logf("%s\tShould be able to remove the policies.", tests.Success)
+
+	db.CloseMGO(tests.Context)
+
+	tests.DisplayLog()
+}
+
+//==============================================================================
+
+// TestUpsertPolicy tests if we can create and retrieve a policy.
+func TestUpsertPolicy(t *testing.T) {
+	const fixture = "basic.json"
+	policies, db := setup(t, fixture)
+	defer teardown(t, db)
+
+	t.Log("Given the need to save a policy into the database.")
+	{
+		t.Log("\tWhen using fixture", fixture)
+		{
+			if err := policy.Upsert(tests.Context, db, policies[1]); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a policy : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to create a policy.", tests.Success)
+
+			p, err := policy.GetByName(tests.Context, db, policies[1].Collection, policies[1].Role)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to retrieve the policy : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the policy.", tests.Success)
+
+			if !reflect.DeepEqual(policies[1], p) {
+				t.Logf("\t%+v", policies[1])
+				t.Logf("\t%+v", p)
+				t.Errorf("\t%s\tShould be able to get back the same policy values.", tests.Failed)
+			} else {
+				t.Logf("\t%s\tShould be able to get back the same policy values.", tests.Success)
+			}
+		}
+	}
+}
+
+// TestGetPoliciesByCollection tests retrieving the policies of a collection.
+func TestGetPoliciesByCollection(t *testing.T) {
+	const fixture = "basic.json"
+	policies, db := setup(t, fixture)
+	defer teardown(t, db)
+
+	t.Log("Given the need to retrieve the policies of a collection.")
+	{
+		t.Log("\tWhen using fixture", fixture)
+		{
+			for _, p := range policies {
+				if err := policy.Upsert(tests.Context, db, p); err != nil {
+					t.Fatalf("\t%s\tShould be able to create a policy : %s", tests.Failed, err)
+				}
+			}
+			t.Logf("\t%s\tShould be able to create the policies.", tests.Success)
+
+			got, err := policy.GetByCollection(tests.Context, db, collection)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to retrieve the policies : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the policies.", tests.Success)
+
+			var roles []string
+			for _, p := range got {
+				roles = append(roles, p.Role)
+			}
+
+			exp := []string{"*", "reporter", "test"}
+			if !reflect.DeepEqual(roles, exp) {
+				t.Fatalf("\t%s\tShould get back the policies sorted by role : %v", tests.Failed, roles)
+			}
+			t.Logf("\t%s\tShould get back the policies sorted by role.", tests.Success)
+		}
+	}
+}
+
+// TestDeletePolicy tests if we can delete a policy from the db.
+func TestDeletePolicy(t *testing.T) {
+	const fixture = "basic.json"
+	policies, db := setup(t, fixture)
+	defer teardown(t, db)
+
+	t.Log("Given the need to delete a policy in the database.")
+	{
+		t.Log("\tWhen using fixture", fixture)
+		{
+			if err := policy.Upsert(tests.Context, db, policies[0]); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a policy : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to create a policy.", tests.Success)
+
+			if err := policy.Delete(tests.Context, db, policies[0].Collection, policies[0].Role); err != nil {
+				t.Fatalf("\t%s\tShould be able to delete the policy : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to delete the policy.", tests.Success)
+
+			if _, err := policy.GetByName(tests.Context, db, policies[0].Collection, policies[0].Role); err != policy.ErrNotFound {
+				t.Fatalf("\t%s\tShould not be able to retrieve the policy : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not be able to retrieve the policy.", tests.Success)
+		}
+	}
+}
+
+// TestApplies tests which callers a policy applies to.
+func TestApplies(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	table := []struct {
+		name    string
+		role    string
+		caller  *acl.Caller
+		applies bool
+	}{
+		{"every caller", "*", &acl.Caller{Subject: "user1"}, true},
+		{"every caller without a caller", "*", nil, true},
+		{"caller with the role", "reporter", &acl.Caller{Roles: []string{"editor", "reporter"}}, true},
+		{"caller without the role", "reporter", &acl.Caller{Roles: []string{"editor"}}, false},
+		{"role without a caller", "reporter", nil, false},
+	}
+
+	t.Log("Given the need to know which callers a policy applies to.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen checking the %s", tt.name)
+			{
+				p := policy.Policy{Collection: collection, Role: tt.role}
+				if got := p.Applies(tt.caller); got != tt.applies {
+					t.Fatalf("\t%s\tShould get %v : %v", tests.Failed, tt.applies, got)
+				}
+				t.Logf("\t%s\tShould get %v.", tests.Success, tt.applies)
+			}
+		}
+	}
+}
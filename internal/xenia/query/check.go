@@ -0,0 +1,315 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/mask"
+	"github.com/coralproject/shelf/internal/xenia/regex"
+	"github.com/coralproject/shelf/internal/xenia/script"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Problem describes a reference in a set that can't be resolved.
+type Problem struct {
+	Field string `json:"field_name"` // Where in the set the reference is.
+	Err   string `json:"error"`      // Why the reference can't be resolved.
+}
+
+// Problems is returned when a set has references that can't be resolved.
+// There is an entry for each problem found.
+type Problems []Problem
+
+// Error implements the error interface.
+func (p Problems) Error() string {
+	msgs := make([]string, len(p))
+	for i := range p {
+		msgs[i] = p[i].Field + " : " + p[i].Err
+	}
+
+	return strings.Join(msgs, ", ")
+}
+
+// Check resolves the references of the set against the regex, script, mask
+// and set stores. The regexes of the parameters, the pre and post scripts,
+// the included sets, the saved results read with #data and the variables
+// are all checked. Every variable must be declared as a parameter of the
+// set. When references can't be resolved, Problems is returned with every
+// problem found.
+func Check(context interface{}, db *db.DB, set *Set) error {
+	log.Dev(context, "Check", "Started : Name[%s]", set.Name)
+
+	var probs Problems
+	add := func(field string, format string, a ...interface{}) {
+		probs = append(probs, Problem{Field: field, Err: fmt.Sprintf(format, a...)})
+	}
+
+	// Resolve the regexes used to validate the parameters.
+	for i, p := range set.Params {
+		if p.RegexName == "" {
+			continue
+		}
+
+		if _, err := regex.GetByName(context, db, p.RegexName); err != nil {
+			add(fmt.Sprintf("params[%d].regex_name", i), "Regex %q : %v", p.RegexName, err)
+		}
+	}
+
+	// Resolve the scripts added to the pipelines.
+	if set.PreScript != "" {
+		if _, err := script.GetByName(context, db, set.PreScript); err != nil {
+			add("pre_script", "Script %q : %v", set.PreScript, err)
+		}
+	}
+
+	if set.PstScript != "" {
+		if _, err := script.GetByName(context, db, set.PstScript); err != nil {
+			add("pst_script", "Script %q : %v", set.PstScript, err)
+		}
+	}
+
+	// The variables used by the set must all be declared as parameters.
+	params := make(map[string]bool, len(set.Params))
+	for _, p := range set.Params {
+		params[p.Name] = true
+	}
+
+	if set.Cache != nil {
+		for _, v := range set.Cache.Vars {
+			if !params[v] {
+				add("cache.vars", "Variable %q is not a parameter", v)
+			}
+		}
+	}
+
+	// The names of the results saved by the queries checked so far.
+	saved := make(map[string]bool)
+
+	for i := range set.Queries {
+		q := &set.Queries[i]
+		field := fmt.Sprintf("queries[%d]", i)
+
+		// Resolve the set that is included.
+		if q.Type == TypeSet && len(q.Commands) > 0 {
+			if name, ok := q.Commands[0]["name"].(string); ok && name != set.Name {
+				if _, err := GetByName(context, db, name); err != nil {
+					add(field+".commands", "Set %q : %v", name, err)
+				}
+			}
+		}
+
+		// Masked fields can't be used to order pages since the page
+		// token carries the values of the sort fields.
+		if q.Page != nil && q.Collection != "" {
+			if masks, err := mask.GetByCollection(context, db, q.Collection); err == nil {
+				for _, s := range q.Page.Sort {
+					if _, exists := masks[strings.TrimPrefix(s, "-")]; exists {
+						add(field+".page.sort", "Field %q is masked", strings.TrimPrefix(s, "-"))
+					}
+				}
+			}
+		}
+
+		if q.When != nil {
+			if q.When.Data != "" && !saved[q.When.Data] {
+				add(field+".when.data", "Result %q is not saved by an earlier query", q.When.Data)
+			}
+
+			if q.When.Var != "" && !params[q.When.Var] {
+				add(field+".when.var", "Variable %q is not a parameter", q.When.Var)
+			}
+		}
+
+		// Check the references within the commands.
+		var refs []ref
+		for _, command := range q.Commands {
+			refs = append(refs, docRefs(command)...)
+		}
+
+		for _, r := range refs {
+			switch {
+			case r.data:
+				if !saved[r.name] {
+					add(field+".commands", "Result %q in %q is not saved by an earlier query", r.name, r.value)
+				}
+
+			case !params[r.name]:
+				add(field+".commands", "Variable %q in %q is not a parameter", r.name, r.value)
+			}
+		}
+
+		if name := savedName(q); name != "" {
+			saved[name] = true
+		}
+	}
+
+	if probs != nil {
+		log.Error(context, "Check", probs, "Completed")
+		return probs
+	}
+
+	log.Dev(context, "Check", "Completed")
+	return nil
+}
+
+// ref is a reference to a variable or a saved result within a command.
+type ref struct {
+	name  string // Name of the variable or saved result.
+	value string // Value the reference was found in.
+	data  bool   // The reference is to a saved result.
+}
+
+// inlineRef matches the references within a larger string, like
+// "prefix-#string:name-suffix".
+var inlineRef = regexp.MustCompile(`#(\w+(?:\.[0-9*]+)?):(-?\w+(?:\.\w+)*)`)
+
+// varName matches values that name a variable instead of being a literal.
+var varName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// docRefs walks the document looking for references to variables and
+// saved results. The keys are walked in order so the problems are reported
+// in the same order every time.
+func docRefs(doc map[string]interface{}) []ref {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var refs []ref
+	for _, key := range keys {
+		value := doc[key]
+
+		// {"statistics.{dimension}.count": 1}
+		for _, part := range strings.Split(key, ".") {
+			if len(part) > 2 && part[0] == '{' && part[len(part)-1] == '}' {
+				refs = append(refs, ref{name: part[1 : len(part)-1], value: key})
+			}
+		}
+
+		// Templates can access the variables and saved results in
+		// any way so they can't be checked.
+		if key == "$template" {
+			continue
+		}
+
+		refs = append(refs, valueRefs(value)...)
+	}
+
+	return refs
+}
+
+// valueRefs looks for references to variables and saved results within
+// the value.
+func valueRefs(value interface{}) []ref {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return docRefs(v)
+
+	case bson.M:
+		return docRefs(v)
+
+	case []interface{}:
+		var refs []ref
+		for _, sub := range v {
+			refs = append(refs, valueRefs(sub)...)
+		}
+		return refs
+
+	case string:
+
+		// {"field": "#cmd:variable"}
+		if v != "" && v[0] == '#' {
+			idx := strings.IndexByte(v, ':')
+			if idx == -1 {
+				return nil
+			}
+
+			if r, ok := cmdRef(v[1:idx], v[idx+1:], v); ok {
+				return []ref{r}
+			}
+			return nil
+		}
+
+		// {"field": "prefix-#cmd:variable-suffix"}
+		var refs []ref
+		for _, sub := range inlineRef.FindAllStringSubmatch(v, -1) {
+			if r, ok := cmdRef(sub[1], sub[2], v); ok {
+				refs = append(refs, r)
+			}
+		}
+		return refs
+	}
+
+	return nil
+}
+
+// cmdRef returns the reference made by the variable command. Commands that
+// are given a literal value, like "#date:2013-01-16", make no reference.
+func cmdRef(cmd, variable, value string) (ref, bool) {
+
+	// {"field": "#data.0:list.station_id"}
+	if strings.HasPrefix(cmd, "data.") {
+		name := variable
+		if dot := strings.IndexByte(name, '.'); dot != -1 {
+			name = name[:dot]
+		}
+		return ref{name: name, value: value, data: true}, true
+	}
+
+	switch cmd {
+	case "string", "number", "float", "date", "json", "list", "numlist", "objidlist":
+
+	case "bool":
+		if variable == "true" || variable == "false" {
+			return ref{}, false
+		}
+
+	case "objid":
+		if bson.IsObjectIdHex(variable) {
+			return ref{}, false
+		}
+
+	// The date to work from is the first term of the expression.
+	case "dateexpr":
+		terms := strings.Fields(variable)
+		if len(terms) == 0 || terms[0] == "now" {
+			return ref{}, false
+		}
+		variable = terms[0]
+
+	// The other commands like #regex and #since use literal values.
+	default:
+		return ref{}, false
+	}
+
+	if !varName.MatchString(variable) {
+		return ref{}, false
+	}
+
+	return ref{name: variable, value: value}, true
+}
+
+// savedName returns the name of the result the query saves with $map.
+func savedName(q *Query) string {
+	l := len(q.Commands) - 1
+	if l < 0 {
+		return ""
+	}
+
+	switch save := q.Commands[l]["$save"].(type) {
+	case map[string]interface{}:
+		name, _ := save["$map"].(string)
+		return name
+
+	case bson.M:
+		name, _ := save["$map"].(string)
+		return name
+	}
+
+	return ""
+}
@@ -2,13 +2,21 @@ package query
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/coralproject/shelf/internal/xenia/acl"
 	"gopkg.in/bluesuncorp/validator.v8"
 )
 
 // Set of query types we expect to receive.
 const (
 	TypePipeline = "pipeline"
+	TypeFind     = "find"
+	TypeCount    = "count"
+	TypeDistinct = "distinct"
+	TypeTemplate = "template"
+	TypeSet      = "set"
 )
 
 //==============================================================================
@@ -44,15 +52,17 @@ type Index struct {
 
 // Query contains the configuration details for a query.
 type Query struct {
-	Name        string                   `bson:"name" json:"name" validate:"required,min=3"`                                 // Unique name per query document.
-	Description string                   `bson:"desc,omitempty" json:"desc,omitempty"`                                       // Description of this specific query.
-	Type        string                   `bson:"type" json:"type" validate:"required,min=8"`                                 // TypePipeline, TypeTemplate
-	Collection  string                   `bson:"collection,omitempty" json:"collection,omitempty" validate:"required,min=3"` // Name of the collection to use for processing the query.
-	Timeout     string                   `bson:"timeout,omitempty" json:"timeout,omitempty"`                                 // Provides a timeout for the query if it does not return.
-	Commands    []map[string]interface{} `bson:"commands" json:"commands"`                                                   // Commands to process for the query.
-	Indexes     []Index                  `bson:"indexes" json:"indexes"`                                                     // Set of indexes required to optimize the execution of the query.
-	Continue    bool                     `bson:"continue,omitempty" json:"continue,omitempty"`                               // Indicates that on failure to process the next query.
-	Return      bool                     `bson:"return" json:"return"`                                                       // Return the results back to the user with Name as the key.
+	Name        string                   `bson:"name" json:"name" validate:"required,min=3"`       // Unique name per query document.
+	Description string                   `bson:"desc,omitempty" json:"desc,omitempty"`             // Description of this specific query.
+	Type        string                   `bson:"type" json:"type" validate:"required,min=3"`       // TypePipeline, TypeFind, TypeCount, TypeDistinct, TypeTemplate, TypeSet
+	Collection  string                   `bson:"collection,omitempty" json:"collection,omitempty"` // Name of the collection to use for processing the query.
+	Timeout     string                   `bson:"timeout,omitempty" json:"timeout,omitempty"`       // Provides a timeout for the query if it does not return.
+	Commands    []map[string]interface{} `bson:"commands" json:"commands"`                         // Commands to process for the query.
+	Indexes     []Index                  `bson:"indexes" json:"indexes"`                           // Set of indexes required to optimize the execution of the query.
+	Continue    bool                     `bson:"continue,omitempty" json:"continue,omitempty"`     // Indicates that on failure to process the next query.
+	Page        *Page                    `bson:"page,omitempty" json:"page,omitempty"`             // Policy for paging through the results with page tokens.
+	When        *When                    `bson:"when,omitempty" json:"when,omitempty"`             // Condition for executing the query.
+	Return      bool                     `bson:"return" json:"return"`                             // Return the results back to the user with Name as the key.
 }
 
 // Validate checks the query value for consistency.
@@ -65,39 +75,242 @@ func (q *Query) Validate() error {
 		return errors.New("No commands exist")
 	}
 
+	// Set queries run the queries of another set so they don't use a
+	// collection of their own.
+	if q.Type != TypeSet && len(q.Collection) < 3 {
+		return errors.New("Collection must be at least 3 characters")
+	}
+
 	switch q.Type {
-	case TypePipeline:
-		// Currently this is the only type we have at the moment.
+	case TypePipeline, TypeFind, TypeCount, TypeDistinct:
+
+	case TypeTemplate:
+		var found bool
+		for _, cmd := range q.Commands {
+			if _, exists := cmd["$template"]; exists {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.New("No $template command exists")
+		}
+
+	case TypeSet:
+		if name, ok := q.Commands[0]["name"].(string); !ok || name == "" {
+			return errors.New("No set name exists")
+		}
 
 	default:
 		return errors.New("Invalid query type")
 	}
 
+	if q.When != nil {
+		if err := q.When.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if q.Page != nil {
+		if q.Type != TypePipeline && q.Type != TypeTemplate {
+			return errors.New("Paging is only supported by pipeline and template queries")
+		}
+
+		if err := validate.Struct(q.Page); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 //==============================================================================
 
+// Set of parameter types we expect to receive.
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamFloat    = "float"
+	ParamBool     = "bool"
+	ParamDate     = "date"
+	ParamObjectID = "objectid"
+	ParamList     = "list"
+)
+
 // Param contains meta-data about a required parameter for the query.
 type Param struct {
-	Name      string `bson:"name" json:"name"`             // Name of the parameter.
-	Desc      string `bson:"desc" json:"desc"`             // Description about the parameter.
-	Default   string `bson:"default" json:"default"`       // Default value for the parameter.
-	RegexName string `bson:"regex_name" json:"regex_name"` // Regular expression name.
+	Name      string   `bson:"name" json:"name"`                             // Name of the parameter.
+	Desc      string   `bson:"desc" json:"desc"`                             // Description about the parameter.
+	Default   string   `bson:"default" json:"default"`                       // Default value for the parameter.
+	RegexName string   `bson:"regex_name" json:"regex_name"`                 // Regular expression name.
+	Type      string   `bson:"type,omitempty" json:"type,omitempty"`         // ParamString when not provided, ParamInt, ParamFloat, ParamBool, ParamDate, ParamObjectID, ParamList
+	Optional  bool     `bson:"optional,omitempty" json:"optional,omitempty"` // The parameter can be left out when it has no default.
+	Min       *float64 `bson:"min,omitempty" json:"min,omitempty"`           // Smallest number, or shortest string or list.
+	Max       *float64 `bson:"max,omitempty" json:"max,omitempty"`           // Largest number, or longest string or list.
+	Enum      []string `bson:"enum,omitempty" json:"enum,omitempty"`         // Values the parameter is limited to.
+	Masked    bool     `bson:"masked,omitempty" json:"masked,omitempty"`     // The value is redacted from the audit log.
+}
+
+// Validate checks the parameter value for consistency.
+func (p *Param) Validate() error {
+	if p.Name == "" {
+		return errors.New("Parameter name is missing")
+	}
+
+	switch p.Type {
+	case "", ParamString, ParamInt, ParamFloat, ParamList:
+
+	case ParamBool, ParamDate, ParamObjectID:
+		if p.Min != nil || p.Max != nil {
+			return fmt.Errorf("Parameter %q of type %q can't have a min or max", p.Name, p.Type)
+		}
+
+	default:
+		return fmt.Errorf("Parameter %q has invalid type %q", p.Name, p.Type)
+	}
+
+	if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+		return fmt.Errorf("Parameter %q has a min greater than its max", p.Name)
+	}
+
+	return nil
+}
+
+//==============================================================================
+
+// When contains the condition for executing a query. The condition tests a
+// variable or the result of a previous query saved with $map. The query is
+// skipped when the condition is false.
+type When struct {
+	Var     string `bson:"var,omitempty" json:"var,omitempty"`           // Variable that must be provided.
+	Equals  string `bson:"equals,omitempty" json:"equals,omitempty"`     // Value the variable must be equal to.
+	Data    string `bson:"data,omitempty" json:"data,omitempty"`         // Name of the saved result to test.
+	Empty   *bool  `bson:"empty,omitempty" json:"empty,omitempty"`       // If the saved result must be empty or not.
+	MinSize *int   `bson:"min_size,omitempty" json:"min_size,omitempty"` // Minimum number of documents in the saved result.
+	MaxSize *int   `bson:"max_size,omitempty" json:"max_size,omitempty"` // Maximum number of documents in the saved result.
+	Not     bool   `bson:"not,omitempty" json:"not,omitempty"`           // Execute the query when the condition is false instead.
+}
+
+// Validate checks the when value for consistency.
+func (w *When) Validate() error {
+	if (w.Var == "") == (w.Data == "") {
+		return errors.New("When must test either a variable or a saved result")
+	}
+
+	if w.Var != "" && (w.Empty != nil || w.MinSize != nil || w.MaxSize != nil) {
+		return errors.New("When can only test the size of a saved result")
+	}
+
+	if w.Data != "" && w.Equals != "" {
+		return errors.New("When can only test the value of a variable")
+	}
+
+	return nil
+}
+
+//==============================================================================
+
+// Page contains the policy for paging through the results of a query. The
+// results are ordered by the sort fields and each page returns a token that
+// is provided back through the page variable to get the next page.
+type Page struct {
+	Sort []string `bson:"sort" json:"sort" validate:"required,min=1"` // Fields the results are ordered by; prefix name with dash (-) for descending order.
+	Size int      `bson:"size" json:"size" validate:"required,min=1"` // Number of documents per page.
+	Var  string   `bson:"var,omitempty" json:"var,omitempty"`         // Name of the variable with the page token, page if empty.
+}
+
+// TokenVar returns the name of the variable with the page token.
+func (p *Page) TokenVar() string {
+	if p.Var == "" {
+		return "page"
+	}
+
+	return p.Var
+}
+
+//==============================================================================
+
+// Cache contains the policy for caching the results of a set.
+type Cache struct {
+	TTL  string   `bson:"ttl" json:"ttl"`                       // How long the results are cached, like 10m or 1h.
+	Vars []string `bson:"vars,omitempty" json:"vars,omitempty"` // Variables that form the cache key. All variables if empty.
+}
+
+// Duration returns the ttl as a duration.
+func (c *Cache) Duration() (time.Duration, error) {
+	d, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid cache ttl %q", c.TTL)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("Invalid cache ttl %q, must be positive", c.TTL)
+	}
+
+	return d, nil
+}
+
+//==============================================================================
+
+// Limits contains the limits on executing a set. A zero value means there is
+// no limit.
+type Limits struct {
+	Timeout string `bson:"timeout,omitempty" json:"timeout,omitempty"`   // Total time all the queries can run, like 30s.
+	MaxDocs int    `bson:"max_docs,omitempty" json:"max_docs,omitempty"` // Maximum number of documents a query can return.
+	MaxSize int64  `bson:"max_size,omitempty" json:"max_size,omitempty"` // Maximum size in bytes of the returned documents.
+}
+
+// Validate checks the limits value for consistency.
+func (l *Limits) Validate() error {
+	if l.Timeout != "" {
+		if _, err := l.Duration(); err != nil {
+			return err
+		}
+	}
+
+	if l.MaxDocs < 0 {
+		return fmt.Errorf("Invalid max docs %d, must not be negative", l.MaxDocs)
+	}
+
+	if l.MaxSize < 0 {
+		return fmt.Errorf("Invalid max size %d, must not be negative", l.MaxSize)
+	}
+
+	return nil
+}
+
+// Duration returns the timeout as a duration.
+func (l *Limits) Duration() (time.Duration, error) {
+	d, err := time.ParseDuration(l.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid timeout %q", l.Timeout)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("Invalid timeout %q, must be positive", l.Timeout)
+	}
+
+	return d, nil
 }
 
 //==============================================================================
 
 // Set contains the configuration details for a rule set.
 type Set struct {
-	Name        string  `bson:"name" json:"name" validate:"required,min=3"` // Name of the query set.
-	Description string  `bson:"desc" json:"desc"`                           // Description of the query set.
-	PreScript   string  `bson:"pre_script" json:"pre_script"`               // Name of a script document to prepend.
-	PstScript   string  `bson:"pst_script" json:"pst_script"`               // Name of a script document to append.
-	Params      []Param `bson:"params" json:"params"`                       // Collection of parameters.
-	Queries     []Query `bson:"queries" json:"queries"`                     // Collection of queries.
-	Enabled     bool    `bson:"enabled" json:"enabled"`                     // If the query set is enabled to run.
-	Explain     bool    `bson:"explain" json:"explain"`                     // If we want the explain output.
+	Name        string   `bson:"name" json:"name" validate:"required,min=3"`                              // Name of the query set.
+	Description string   `bson:"desc" json:"desc"`                                                        // Description of the query set.
+	Tags        []string `bson:"tags,omitempty" json:"tags,omitempty" validate:"omitempty,dive,required"` // Tags for finding the query set, like the product area and owner.
+	PreScript   string   `bson:"pre_script" json:"pre_script"`                                            // Name of a script document to prepend.
+	PstScript   string   `bson:"pst_script" json:"pst_script"`                                            // Name of a script document to append.
+	Params      []Param  `bson:"params" json:"params"`                                                    // Collection of parameters.
+	Queries     []Query  `bson:"queries" json:"queries"`                                                  // Collection of queries.
+	Enabled     bool     `bson:"enabled" json:"enabled"`                                                  // If the query set is enabled to run.
+	Explain     bool     `bson:"explain" json:"explain"`                                                  // If we want the explain output.
+	DryRun      bool     `bson:"-" json:"dry_run,omitempty"`                                              // If we want the final commands without executing them.
+	Cache       *Cache   `bson:"cache,omitempty" json:"cache,omitempty"`                                  // Policy for caching the results.
+	Limits      *Limits  `bson:"limits,omitempty" json:"limits,omitempty"`                                // Limits on executing the set.
+	ACL         *acl.ACL `bson:"acl,omitempty" json:"acl,omitempty"`                                      // Who may execute and edit the set.
 }
 
 // Validate checks the set value for consistency.
@@ -106,6 +319,24 @@ func (s *Set) Validate() error {
 		return err
 	}
 
+	if s.Cache != nil {
+		if _, err := s.Cache.Duration(); err != nil {
+			return err
+		}
+	}
+
+	if s.Limits != nil {
+		if err := s.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range s.Params {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
 	for _, q := range s.Queries {
 		if err := q.Validate(); err != nil {
 			return err
@@ -115,6 +346,13 @@ func (s *Set) Validate() error {
 	return nil
 }
 
+// Version contains a version of a Set within the history.
+type Version struct {
+	Version int       `bson:"-" json:"version"`   // Number of the version, the first version saved is 1.
+	Saved   time.Time `bson:"saved" json:"saved"` // When the version was saved, zero if not recorded.
+	Set     Set       `bson:",inline" json:"set"` // The Set as it was saved.
+}
+
 // PrepareForInsert replaces the documents for insertion.
 func (s *Set) PrepareForInsert() {
 
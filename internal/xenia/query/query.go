@@ -5,12 +5,15 @@ package query
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/db/mongo"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/tenant"
+	"github.com/coralproject/shelf/internal/xenia/history"
 	gc "github.com/patrickmn/go-cache"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -156,7 +159,7 @@ func Upsert(context interface{}, db *db.DB, set *Set) error {
 		qu := bson.M{
 			"$push": bson.M{
 				"sets": bson.M{
-					"$each":     []*Set{set},
+					"$each":     []Version{{Set: *set, Saved: time.Now().UTC()}},
 					"$position": 0,
 				},
 			},
@@ -186,7 +189,7 @@ func GetNames(context interface{}, db *db.DB) ([]string, error) {
 		Name string
 	}
 
-	key := "gns"
+	key := tenant.CacheKey(db, "gns")
 	if v, found := cache.Get(key); found {
 		names := v.([]string)
 		log.Dev(context, "GetNames", "Completed : CACHE : Sets[%d]", len(names))
@@ -224,11 +227,12 @@ func GetNames(context interface{}, db *db.DB) ([]string, error) {
 	return names, nil
 }
 
-// GetAll retrieves a list of sets.
+// GetAll retrieves a list of sets. When tags are provided only the sets
+// with all of the tags are returned.
 func GetAll(context interface{}, db *db.DB, tags []string) ([]Set, error) {
 	log.Dev(context, "GetAll", "Started : Tags[%v]", tags)
 
-	key := "gss" + strings.Join(tags, "-")
+	key := tenant.CacheKey(db, "gss"+url.Values{"tag": tags}.Encode())
 	if v, found := cache.Get(key); found {
 		sets := v.([]Set)
 		log.Dev(context, "GetAll", "Completed : CACHE : Sets[%d]", len(sets))
@@ -237,8 +241,12 @@ func GetAll(context interface{}, db *db.DB, tags []string) ([]Set, error) {
 
 	var sets []Set
 	f := func(c *mgo.Collection) error {
-		log.Dev(context, "GetAll", "MGO : db.%s.find({}).sort([\"name\"])", c.Name)
-		return c.Find(nil).All(&sets)
+		q := bson.M{}
+		if len(tags) > 0 {
+			q["tags"] = bson.M{"$all": tags}
+		}
+		log.Dev(context, "GetAll", "MGO : db.%s.find(%s).sort([\"name\"])", c.Name, mongo.Query(q))
+		return c.Find(q).All(&sets)
 	}
 
 	if err := db.ExecuteMGO(context, Collection, f); err != nil {
@@ -270,7 +278,7 @@ func GetAll(context interface{}, db *db.DB, tags []string) ([]Set, error) {
 func GetByName(context interface{}, db *db.DB, name string) (*Set, error) {
 	log.Dev(context, "GetByName", "Started : Name[%s]", name)
 
-	key := "gbn" + name
+	key := tenant.CacheKey(db, "gbn"+name)
 	if v, found := cache.Get(key); found {
 		set := v.(Set)
 		log.Dev(context, "GetByName", "Completed : CACHE : Set[%+v]", &set)
@@ -311,7 +319,7 @@ func GetLastHistoryByName(context interface{}, db *db.DB, name string) (*Set, er
 		Sets []Set  `bson:"sets"`
 	}
 
-	key := "glhbn" + name
+	key := tenant.CacheKey(db, "glhbn"+name)
 	if v, found := cache.Get(key); found {
 		result := v.(rslt)
 		log.Dev(context, "GetLastHistoryByName", "Completed : CACHE :  Set[%+v]", &result.Sets[0])
@@ -352,6 +360,100 @@ func GetLastHistoryByName(context interface{}, db *db.DB, name string) (*Set, er
 	return &result.Sets[0], nil
 }
 
+// GetHistory retrieves every version of the Set within the history, newest
+// first.
+func GetHistory(context interface{}, db *db.DB, name string) ([]Version, error) {
+	log.Dev(context, "GetHistory", "Started : Name[%s]", name)
+
+	type rslt struct {
+		Name string    `bson:"name"`
+		Sets []Version `bson:"sets"`
+	}
+
+	key := tenant.CacheKey(db, "gh"+name)
+	if v, found := cache.Get(key); found {
+		versions := v.([]Version)
+		log.Dev(context, "GetHistory", "Completed : CACHE : Versions[%d]", len(versions))
+		return versions, nil
+	}
+
+	var result rslt
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"name": name}
+		log.Dev(context, "GetHistory", "MGO : db.%s.find(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).One(&result)
+	}
+
+	if err := db.ExecuteMGO(context, CollectionHistory, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetHistory", err, "Completed")
+		return nil, err
+	}
+
+	if len(result.Sets) == 0 {
+		log.Error(context, "GetHistory", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	// Number the versions and fix the sets so they can be used.
+	for i := range result.Sets {
+		result.Sets[i].Version = history.Number(i, len(result.Sets))
+		result.Sets[i].Set.PrepareForUse()
+	}
+
+	cache.Set(key, result.Sets, gc.DefaultExpiration)
+
+	log.Dev(context, "GetHistory", "Completed : Versions[%d]", len(result.Sets))
+	return result.Sets, nil
+}
+
+// GetVersion retrieves the specified version of the Set from the history.
+func GetVersion(context interface{}, db *db.DB, name string, version int) (*Set, error) {
+	log.Dev(context, "GetVersion", "Started : Name[%s] Version[%d]", name, version)
+
+	versions, err := GetHistory(context, db, name)
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return nil, err
+	}
+
+	idx, err := history.Index(version, len(versions))
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return nil, err
+	}
+
+	set := versions[idx].Set
+
+	log.Dev(context, "GetVersion", "Completed : Set[%+v]", &set)
+	return &set, nil
+}
+
+// Restore makes the specified version of the Set from the history the
+// current version. The restored Set is added to the history as a new
+// version so the restore can be undone.
+func Restore(context interface{}, db *db.DB, name string, version int) error {
+	log.Dev(context, "Restore", "Started : Name[%s] Version[%d]", name, version)
+
+	set, err := GetVersion(context, db, name, version)
+	if err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	if err := Upsert(context, db, set); err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Restore", "Completed")
+	return nil
+}
+
 // =============================================================================
 
 // Delete is used to remove an existing Set document.
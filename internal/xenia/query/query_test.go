@@ -189,6 +189,59 @@ func TestGetSets(t *testing.T) {
 	}
 }
 
+// TestGetSetsByTag tests if we can retrieve the list of Sets with tags.
+func TestGetSetsByTag(t *testing.T) {
+	const fixture = "basic.json"
+	set1, db := setup(t, fixture)
+	defer teardown(t, db)
+
+	t.Log("Given the need to retrieve a list of query sets by tag.")
+	{
+		t.Log("\tWhen using fixture", fixture)
+		{
+			set1.Tags = []string{"QTEST_O_reports", "QTEST_O_orders"}
+			if err := query.Upsert(tests.Context, db, set1); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a query set : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to create a query set.", tests.Success)
+
+			set1.Name += "2"
+			set1.Tags = []string{"QTEST_O_reports"}
+			if err := query.Upsert(tests.Context, db, set1); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a second query set : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to create a second query set.", tests.Success)
+
+			sets, err := query.GetAll(tests.Context, db, []string{"QTEST_O_reports"})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to retrieve the query sets : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the query sets", tests.Success)
+
+			if len(sets) != 2 {
+				t.Fatalf("\t%s\tShould have two query sets with one tag : %d", tests.Failed, len(sets))
+			}
+			t.Logf("\t%s\tShould have two query sets with one tag.", tests.Success)
+
+			sets, err = query.GetAll(tests.Context, db, []string{"QTEST_O_reports", "QTEST_O_orders"})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to retrieve the query sets : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the query sets", tests.Success)
+
+			if len(sets) != 1 || sets[0].Name != prefix+"_basic" {
+				t.Fatalf("\t%s\tShould have one query set with both tags : %+v", tests.Failed, sets)
+			}
+			t.Logf("\t%s\tShould have one query set with both tags.", tests.Success)
+
+			if _, err := query.GetAll(tests.Context, db, []string{"QTEST_O_none"}); err != query.ErrNotFound {
+				t.Fatalf("\t%s\tShould not find query sets with an unknown tag : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould not find query sets with an unknown tag.", tests.Success)
+		}
+	}
+}
+
 // TestGetLastSetHistoryByName validates retrieval of query Set from the history
 // collection.
 func TestGetLastSetHistoryByName(t *testing.T) {
@@ -292,6 +345,139 @@ func TestUpsertUpdateQuery(t *testing.T) {
 	}
 }
 
+// TestUpsertProblems validates all the references of a set that can't be
+// resolved are reported when it is checked, and that upserting the set does
+// not check them.
+func TestUpsertProblems(t *testing.T) {
+	const fixture = "basic_var.json"
+	set1, db := setup(t, fixture)
+	defer teardown(t, db)
+
+	t.Log("Given the need to validate the references of a query set.")
+	{
+		t.Log("\tWhen using fixture", fixture)
+		{
+			set1.PreScript = prefix + "_missing"
+			set1.Params = []query.Param{{Name: "id", RegexName: prefix + "_missing"}}
+
+			q := set1.Queries[0]
+			q.Name = "Saved"
+			q.When = &query.When{Data: "list"}
+			q.Commands = []map[string]interface{}{
+				{"$match": map[string]interface{}{"station_id": "#data.0:list.station_id"}},
+			}
+			set1.Queries = append(set1.Queries, q)
+
+			err := query.Check(tests.Context, db, set1)
+			probs, ok := err.(query.Problems)
+			if !ok {
+				t.Fatalf("\t%s\tShould get back the problems with the set : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould get back the problems with the set.", tests.Success)
+
+			var fields []string
+			for _, p := range probs {
+				fields = append(fields, p.Field)
+			}
+
+			exp := []string{"params[0].regex_name", "pre_script", "queries[0].commands", "queries[1].when.data", "queries[1].commands"}
+			if !reflect.DeepEqual(fields, exp) {
+				t.Logf("\t%v", probs)
+				t.Fatalf("\t%s\tShould get back a problem for each reference : %v", tests.Failed, fields)
+			}
+			t.Logf("\t%s\tShould get back a problem for each reference.", tests.Success)
+
+			if err := query.Upsert(tests.Context, db, set1); err != nil {
+				t.Fatalf("\t%s\tShould be able to upsert the query set without checking it : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to upsert the query set without checking it.", tests.Success)
+		}
+
+		t.Log("\tWhen the set declares no parameters")
+		{
+			set := query.Set{
+				Name: prefix + "_noparams",
+				Queries: []query.Query{{
+					Name:       "Vars",
+					Type:       query.TypePipeline,
+					Collection: "test_xenia_data",
+					Commands:   []map[string]interface{}{{"$match": map[string]interface{}{"station_id": "#string:foo"}}},
+				}},
+			}
+
+			probs, ok := query.Check(tests.Context, db, &set).(query.Problems)
+			if !ok || len(probs) != 1 || probs[0].Field != "queries[0].commands" {
+				t.Fatalf("\t%s\tShould report the variable that is not a parameter : %v", tests.Failed, probs)
+			}
+			t.Logf("\t%s\tShould report the variable that is not a parameter.", tests.Success)
+		}
+	}
+}
+
+// TestSetHistory validates the versions of a query Set can be listed and
+// restored.
+func TestSetHistory(t *testing.T) {
+	const fixture = "basic.json"
+	set1, db := setup(t, fixture)
+	defer teardown(t, db)
+
+	t.Log("Given the need to restore a version of a query set.")
+	{
+		t.Log("\tWhen using fixture", fixture)
+		{
+			if err := query.Upsert(tests.Context, db, set1); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a query set : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to create a query set.", tests.Success)
+
+			set2 := *set1
+			set2.Description = "Updated"
+
+			if err := query.Upsert(tests.Context, db, &set2); err != nil {
+				t.Fatalf("\t%s\tShould be able to update a query set : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to update a query set.", tests.Success)
+
+			versions, err := query.GetHistory(tests.Context, db, set1.Name)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to retrieve the history : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the history.", tests.Success)
+
+			if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+				t.Fatalf("\t%s\tShould get back both versions newest first : %+v", tests.Failed, versions)
+			}
+			t.Logf("\t%s\tShould get back both versions newest first.", tests.Success)
+
+			if versions[0].Saved.IsZero() || versions[0].Set.Description != "Updated" {
+				t.Fatalf("\t%s\tShould get back when each version was saved : %+v", tests.Failed, versions[0])
+			}
+			t.Logf("\t%s\tShould get back when each version was saved.", tests.Success)
+
+			if err := query.Restore(tests.Context, db, set1.Name, 1); err != nil {
+				t.Fatalf("\t%s\tShould be able to restore the first version : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to restore the first version.", tests.Success)
+
+			set, err := query.GetByName(tests.Context, db, set1.Name)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to retrieve the query set : %s", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to retrieve the query set.", tests.Success)
+
+			if set.Description != set1.Description {
+				t.Fatalf("\t%s\tShould get back the first version : %q", tests.Failed, set.Description)
+			}
+			t.Logf("\t%s\tShould get back the first version.", tests.Success)
+
+			if _, err := query.GetVersion(tests.Context, db, set1.Name, 4); err == nil {
+				t.Fatalf("\t%s\tShould not be able to retrieve a version that does not exist.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould not be able to retrieve a version that does not exist.", tests.Success)
+		}
+	}
+}
+
 // TestDeleteSet validates the removal of a query from the database.
 func TestDeleteSet(t *testing.T) {
 	const fixture = "basic.json"
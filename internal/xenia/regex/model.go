@@ -2,7 +2,9 @@ package regex
 
 import (
 	"regexp"
+	"time"
 
+	"github.com/coralproject/shelf/internal/xenia/acl"
 	"gopkg.in/bluesuncorp/validator.v8"
 )
 
@@ -19,8 +21,10 @@ func init() {
 
 // Regex contains a single regular expresion bound to a name.
 type Regex struct {
-	Name string `bson:"name" json:"name" validate:"required,min=3"`
-	Expr string `bson:"expr" json:"expr" validate:"required,min=3"`
+	Name string   `bson:"name" json:"name" validate:"required,min=3"`
+	Expr string   `bson:"expr" json:"expr" validate:"required,min=3"`
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty" validate:"omitempty,dive,required"`
+	ACL  *acl.ACL `bson:"acl,omitempty" json:"acl,omitempty"`
 
 	Compile *regexp.Regexp
 }
@@ -37,3 +41,10 @@ func (r Regex) Validate() error {
 
 	return nil
 }
+
+// Version contains a version of a Regex within the history.
+type Version struct {
+	Version int       `bson:"-" json:"version"`     // Number of the version, the first version saved is 1.
+	Saved   time.Time `bson:"saved" json:"saved"`   // When the version was saved, zero if not recorded.
+	Regex   Regex     `bson:",inline" json:"regex"` // The Regex as it was saved.
+}
@@ -4,6 +4,7 @@ package regex
 
 import (
 	"errors"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -11,6 +12,8 @@ import (
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/db/mongo"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/tenant"
+	"github.com/coralproject/shelf/internal/xenia/history"
 	gc "github.com/patrickmn/go-cache"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -103,7 +106,7 @@ func Upsert(context interface{}, db *db.DB, rgx Regex) error {
 		qu := bson.M{
 			"$push": bson.M{
 				"regexs": bson.M{
-					"$each":     []Regex{rgx},
+					"$each":     []Version{{Regex: rgx, Saved: time.Now().UTC()}},
 					"$position": 0,
 				},
 			},
@@ -133,7 +136,7 @@ func GetNames(context interface{}, db *db.DB) ([]string, error) {
 		Name string
 	}
 
-	key := "gns"
+	key := tenant.CacheKey(db, "gns")
 	if v, found := cache.Get(key); found {
 		names := v.([]string)
 		log.Dev(context, "GetNames", "Completed : CACHE : Rgxs[%d]", len(names))
@@ -171,11 +174,12 @@ func GetNames(context interface{}, db *db.DB) ([]string, error) {
 	return names, nil
 }
 
-// GetAll retrieves a list of regexs.
+// GetAll retrieves a list of regexs. When tags are provided only the regexs
+// with all of the tags are returned.
 func GetAll(context interface{}, db *db.DB, tags []string) ([]Regex, error) {
 	log.Dev(context, "GetAll", "Started : Tags[%v]", tags)
 
-	key := "grs" + strings.Join(tags, "-")
+	key := tenant.CacheKey(db, "grs"+url.Values{"tag": tags}.Encode())
 	if v, found := cache.Get(key); found {
 		rgxs := v.([]Regex)
 		log.Dev(context, "GetAll", "Completed : CACHE : Rgxs[%d]", len(rgxs))
@@ -184,8 +188,12 @@ func GetAll(context interface{}, db *db.DB, tags []string) ([]Regex, error) {
 
 	var rgxs []Regex
 	f := func(c *mgo.Collection) error {
-		log.Dev(context, "GetAll", "MGO : db.%s.find({}).sort([\"name\"])", c.Name)
-		return c.Find(nil).All(&rgxs)
+		q := bson.M{}
+		if len(tags) > 0 {
+			q["tags"] = bson.M{"$all": tags}
+		}
+		log.Dev(context, "GetAll", "MGO : db.%s.find(%s).sort([\"name\"])", c.Name, mongo.Query(q))
+		return c.Find(q).All(&rgxs)
 	}
 
 	if err := db.ExecuteMGO(context, Collection, f); err != nil {
@@ -212,7 +220,7 @@ func GetAll(context interface{}, db *db.DB, tags []string) ([]Regex, error) {
 func GetByName(context interface{}, db *db.DB, name string) (Regex, error) {
 	log.Dev(context, "GetByName", "Started : Name[%s]", name)
 
-	key := "gbn" + name
+	key := tenant.CacheKey(db, "gbn"+name)
 	if v, found := cache.Get(key); found {
 		rgx := v.(Regex)
 		log.Dev(context, "GetByName", "Completed : CACHE : Rgx[%s]", rgx.Name)
@@ -252,7 +260,7 @@ func GetByName(context interface{}, db *db.DB, name string) (Regex, error) {
 func GetByNames(context interface{}, db *db.DB, names []string) ([]Regex, error) {
 	log.Dev(context, "GetByNames", "Started : Names[%+v]", names)
 
-	key := "gbns" + strings.Join(names, "-")
+	key := tenant.CacheKey(db, "gbns"+strings.Join(names, "-"))
 	if v, found := cache.Get(key); found {
 		regexs := v.([]Regex)
 		log.Dev(context, "GetByNames", "Completed : CACHE : Regexs[%+v]", regexs)
@@ -321,7 +329,7 @@ func GetLastHistoryByName(context interface{}, db *db.DB, name string) (Regex, e
 		Regexs []Regex `bson:"regexs"`
 	}
 
-	key := "glhbn" + name
+	key := tenant.CacheKey(db, "glhbn"+name)
 	if v, found := cache.Get(key); found {
 		result := v.(rslt)
 		log.Dev(context, "GetLastHistoryByName", "Completed : CACHE : Regex[%+v]", &result.Regexs[0])
@@ -359,6 +367,96 @@ func GetLastHistoryByName(context interface{}, db *db.DB, name string) (Regex, e
 	return result.Regexs[0], nil
 }
 
+// GetHistory retrieves every version of the Regex within the history, newest
+// first.
+func GetHistory(context interface{}, db *db.DB, name string) ([]Version, error) {
+	log.Dev(context, "GetHistory", "Started : Name[%s]", name)
+
+	type rslt struct {
+		Regexs []Version `bson:"regexs"`
+	}
+
+	key := tenant.CacheKey(db, "gh"+name)
+	if v, found := cache.Get(key); found {
+		versions := v.([]Version)
+		log.Dev(context, "GetHistory", "Completed : CACHE : Versions[%d]", len(versions))
+		return versions, nil
+	}
+
+	var result rslt
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"name": name}
+		log.Dev(context, "GetHistory", "MGO : db.%s.find(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).One(&result)
+	}
+
+	if err := db.ExecuteMGO(context, CollectionHistory, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetHistory", err, "Completed")
+		return nil, err
+	}
+
+	if len(result.Regexs) == 0 {
+		log.Error(context, "GetHistory", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	// Number the versions.
+	for i := range result.Regexs {
+		result.Regexs[i].Version = history.Number(i, len(result.Regexs))
+	}
+
+	cache.Set(key, result.Regexs, gc.DefaultExpiration)
+
+	log.Dev(context, "GetHistory", "Completed : Versions[%d]", len(result.Regexs))
+	return result.Regexs, nil
+}
+
+// GetVersion retrieves the specified version of the Regex from the history.
+func GetVersion(context interface{}, db *db.DB, name string, version int) (Regex, error) {
+	log.Dev(context, "GetVersion", "Started : Name[%s] Version[%d]", name, version)
+
+	versions, err := GetHistory(context, db, name)
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return Regex{}, err
+	}
+
+	idx, err := history.Index(version, len(versions))
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return Regex{}, err
+	}
+
+	log.Dev(context, "GetVersion", "Completed : Regex[%+v]", versions[idx].Regex)
+	return versions[idx].Regex, nil
+}
+
+// Restore makes the specified version of the Regex from the history the
+// current version. The restored Regex is added to the history as a new
+// version so the restore can be undone.
+func Restore(context interface{}, db *db.DB, name string, version int) error {
+	log.Dev(context, "Restore", "Started : Name[%s] Version[%d]", name, version)
+
+	rgx, err := GetVersion(context, db, name, version)
+	if err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	if err := Upsert(context, db, rgx); err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Restore", "Completed")
+	return nil
+}
+
 // =============================================================================
 
 // Delete is used to remove an existing Regex document.
@@ -0,0 +1,116 @@
+package xenia
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
+)
+
+// TestRenderVars tests the variables of the caller can't change the commands
+// a template renders.
+func TestRenderVars(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	inject := `42021"}}, {"$out": "stations`
+
+	t.Log("Given the need to render the variables of the caller in a template.")
+	{
+		t.Log("\tWhen a variable is rendered without the json function")
+		{
+			vars := map[string]string{"station_id": inject}
+			exp := []map[string]interface{}{{"$match": map[string]interface{}{"station_id": inject}}}
+
+			commands, err := renderTemplate(tests.Context, "vars", `[{"$match": {"station_id": {{.Vars.station_id}}}}]`, vars, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to render the template : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to render the template.", tests.Success)
+
+			if !reflect.DeepEqual(commands, exp) {
+				t.Fatalf("\t%s\tShould render the variable as a string : %v", tests.Failed, commands)
+			}
+			t.Logf("\t%s\tShould render the variable as a string.", tests.Success)
+		}
+
+		t.Log("\tWhen a variable is rendered with the json function")
+		{
+			vars := map[string]string{"station_id": inject}
+			exp := []map[string]interface{}{{"$match": map[string]interface{}{"station_id": inject}}}
+
+			commands, err := renderTemplate(tests.Context, "vars", `{"$match": {"station_id": {{json .Vars.station_id}}}}`, vars, nil)
+			if err != nil || !reflect.DeepEqual(commands, exp) {
+				t.Fatalf("\t%s\tShould render the variable as a string : %v : %v", tests.Failed, commands, err)
+			}
+			t.Logf("\t%s\tShould render the variable as a string.", tests.Success)
+		}
+
+		t.Log("\tWhen a variable is rendered as a number")
+		{
+			text := `[{"$match": {}}, {"$limit": {{number .Vars.limit}}}]`
+
+			commands, err := renderTemplate(tests.Context, "vars", text, map[string]string{"limit": "10"}, nil)
+			if err != nil || commands[1]["$limit"] != float64(10) {
+				t.Fatalf("\t%s\tShould render the number : %v : %v", tests.Failed, commands, err)
+			}
+			t.Logf("\t%s\tShould render the number.", tests.Success)
+
+			if _, err := renderTemplate(tests.Context, "vars", text, map[string]string{"limit": `10}, {"$out": "stations"`}, nil); err == nil {
+				t.Fatalf("\t%s\tShould not render a variable that is not a number.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould not render a variable that is not a number.", tests.Success)
+		}
+	}
+}
+
+// TestTemplateVarCommand tests a variable rendered by a template stays a
+// literal string even when it looks like a variable command.
+func TestTemplateVarCommand(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	q := query.Query{
+		Name:       "Template Var Command",
+		Type:       query.TypeTemplate,
+		Collection: "test_xenia_data",
+		Commands: []map[string]interface{}{
+			{"$template": `{"$match": {"station_id": {{.Vars.station_id}}}}`},
+			{"$limit": "#number:limit"},
+		},
+	}
+
+	vars := map[string]string{"station_id": "#regex:/.*/", "limit": "5"}
+
+	t.Log("Given the need to keep rendered variables from running as commands.")
+	{
+		t.Log("\tWhen a variable looks like a variable command")
+		{
+			result, _, err := execTemplate(tests.Context, nil, &q, vars, map[string]interface{}{}, execOpts{ctx: noCancel, dryRun: true})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to render the template : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to render the template.", tests.Success)
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to marshal the result : %v", tests.Failed, err)
+			}
+
+			if !strings.Contains(string(data), `{"$match":{"station_id":"#regex:/.*/"}}`) {
+				t.Log(string(data))
+				t.Fatalf("\t%s\tShould keep the variable as a literal string.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould keep the variable as a literal string.", tests.Success)
+
+			if !strings.Contains(string(data), `{"$limit":5}`) {
+				t.Log(string(data))
+				t.Fatalf("\t%s\tShould substitute the variables of the other commands.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould substitute the variables of the other commands.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package xenia
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/kit/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// reservedPrefixes are the prefixes of the collections holding the documents
+// of Mongo and of xenia itself, like the sets, the policies, the cached
+// results and the audit log.
+var reservedPrefixes = []string{"system.", "query_"}
+
+// reservedCollection reports if the collection is one sets may not use.
+func reservedCollection(name string) bool {
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkReserved fails if the query reads a reserved collection, or if any of
+// the stages of the pipeline read or write one. Stages nested in a $facet or
+// in the pipeline of a $lookup are checked too.
+func checkReserved(context interface{}, collection string, pipeline []bson.M) error {
+	if reservedCollection(collection) {
+		err := fmt.Errorf("Collection %q is reserved", collection)
+		log.Error(context, "checkReserved", err, "Checking collection")
+		return err
+	}
+
+	for _, stage := range pipeline {
+		if err := checkStages(map[string]interface{}(stage)); err != nil {
+			log.Error(context, "checkReserved", err, "Checking stages")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkStages walks the value looking for stages that name a reserved
+// collection.
+func checkStages(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if name := stageCollection(key, value); reservedCollection(name) {
+				return fmt.Errorf("Collection %q is reserved and can't be used by %s", name, key)
+			}
+
+			if err := checkStages(value); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for i := range v {
+			if err := checkStages(v[i]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		if doc, err := cmdDoc(v); err == nil && doc != nil {
+			return checkStages(doc)
+		}
+	}
+
+	return nil
+}
+
+// stageCollection returns the collection the stage reads or writes, if any.
+func stageCollection(key string, value interface{}) string {
+
+	// {"$out": "name"} or {"$out": {"db": "db", "coll": "name"}}
+	// {"$merge": {"into": "name"}} or {"$merge": {"into": {"coll": "name"}}}
+	// {"$lookup": {"from": "name"}} and {"$graphLookup": {"from": "name"}}
+	// {"$unionWith": "name"} or {"$unionWith": {"coll": "name"}}
+
+	var field string
+	switch key {
+	case "$out", "$unionWith":
+		field = "coll"
+	case "$merge":
+		field = "into"
+	case "$lookup", "$graphLookup":
+		field = "from"
+	default:
+		return ""
+	}
+
+	if name, ok := value.(string); ok {
+		return name
+	}
+
+	doc, err := cmdDoc(value)
+	if err != nil {
+		return ""
+	}
+
+	if key == "$merge" {
+		return stageCollection("$out", doc[field])
+	}
+
+	name, _ := doc[field].(string)
+	return name
+}
@@ -0,0 +1,52 @@
+package xenia
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestCheckReserved tests rejecting queries that use the collections of
+// xenia itself.
+func TestCheckReserved(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	table := []struct {
+		name       string
+		collection string
+		pipeline   []bson.M
+		valid      bool
+	}{
+		{"query of a collection", "test_xenia_data", []bson.M{{"$match": bson.M{"station_id": "42021"}}}, true},
+		{"lookup of a collection", "test_xenia_data", []bson.M{{"$lookup": map[string]interface{}{"from": "test_xenia_data"}}}, true},
+		{"query of the sets", "query_sets", nil, false},
+		{"query of a system collection", "system.users", nil, false},
+		{"$out into the policies", "test_xenia_data", []bson.M{{"$out": "query_policies"}}, false},
+		{"$out document into the policies", "test_xenia_data", []bson.M{{"$out": map[string]interface{}{"db": "xenia", "coll": "query_policies"}}}, false},
+		{"$merge into the policies", "test_xenia_data", []bson.M{{"$merge": map[string]interface{}{"into": "query_policies"}}}, false},
+		{"$merge document into the policies", "test_xenia_data", []bson.M{{"$merge": map[string]interface{}{"into": map[string]interface{}{"coll": "query_policies"}}}}, false},
+		{"lookup of the cache", "test_xenia_data", []bson.M{{"$lookup": map[string]interface{}{"from": "query_sets_cache"}}}, false},
+		{"graph lookup of the audit log", "test_xenia_data", []bson.M{{"$graphLookup": bson.M{"from": "query_audit"}}}, false},
+		{"union with the audit log", "test_xenia_data", []bson.M{{"$unionWith": "query_audit"}}, false},
+		{"lookup in a facet", "test_xenia_data", []bson.M{{"$facet": map[string]interface{}{"audit": []interface{}{map[string]interface{}{"$lookup": map[string]interface{}{"from": "query_audit"}}}}}}, false},
+	}
+
+	t.Log("Given the need to reject queries using the collections of xenia.")
+	{
+		for _, tt := range table {
+			t.Logf("\tWhen checking a %s", tt.name)
+			{
+				err := checkReserved(tests.Context, tt.collection, tt.pipeline)
+				if tt.valid && err != nil {
+					t.Fatalf("\t%s\tShould be able to use the collection : %v", tests.Failed, err)
+				}
+				if !tt.valid && err == nil {
+					t.Fatalf("\t%s\tShould not be able to use the collection.", tests.Failed)
+				}
+				t.Logf("\t%s\tShould get back %v for using the collection.", tests.Success, tt.valid)
+			}
+		}
+	}
+}
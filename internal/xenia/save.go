@@ -0,0 +1,278 @@
+package xenia
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// saveBatch controls the size of the batches used when saving results
+// into a collection.
+var saveBatch = 100
+
+// Set of modes for saving results into a collection.
+const (
+	saveReplace = "replace"
+	saveMerge   = "merge"
+)
+
+// expiresField is the field added to saved documents when they expire.
+const expiresField = "_expires"
+
+// savePrefix is the prefix of the collections results can be saved into so
+// sets can't replace or drop the collections of the application.
+var savePrefix = "saved_"
+
+// UseSavePrefix sets the prefix of the collections results can be saved
+// into. This should be called during initialization before any sets are
+// executed.
+func UseSavePrefix(prefix string) {
+	savePrefix = prefix
+}
+
+// colSave contains the options for saving results into a collection.
+type colSave struct {
+	name string
+	mode string
+	ttl  time.Duration
+}
+
+// saveCollection saves the results into the collection. The results either
+// replace the documents in the collection or are merged into it by _id.
+func saveCollection(context interface{}, db *db.DB, value interface{}, results []bson.M) error {
+
+	// {"$collection": "name"}
+	// {"$collection": {"name": "name", "mode": "merge", "ttl": "24h"}}
+
+	cs, err := parseColSave(value)
+	if err != nil {
+		log.Error(context, "saveCollection", err, "Checking options")
+		return err
+	}
+
+	log.Dev(context, "saveCollection", "Saving result to collection[%s] Mode[%s] TTL[%v]", cs.name, cs.mode, cs.ttl)
+
+	// Add the expiration to a copy of the documents since the results
+	// are still used by the set.
+	docs := results
+	if cs.ttl > 0 {
+		expires := time.Now().Add(cs.ttl)
+
+		docs = make([]bson.M, len(results))
+		for i, result := range results {
+			doc := make(bson.M, len(result)+1)
+			for k, v := range result {
+				doc[k] = v
+			}
+			doc[expiresField] = expires
+			docs[i] = doc
+		}
+	}
+
+	if cs.mode == saveMerge {
+		if err := writeDocs(context, db, cs.name, docs, true); err != nil {
+			log.Error(context, "saveCollection", err, "Merging documents")
+			return err
+		}
+
+		return ensureExpires(context, db, cs)
+	}
+
+	// Replace the collection by writing the documents into a temporary
+	// collection and renaming it over the collection. This way readers
+	// never see a partially written collection.
+	if len(docs) == 0 {
+		if err := dropCollection(context, db, cs.name); err != nil {
+			log.Error(context, "saveCollection", err, "Dropping collection")
+			return err
+		}
+
+		return nil
+	}
+
+	tmp := colSave{
+		name: cs.name + "_tmp_" + bson.NewObjectId().Hex(),
+		ttl:  cs.ttl,
+	}
+
+	if err := writeDocs(context, db, tmp.name, docs, false); err != nil {
+		log.Error(context, "saveCollection", err, "Writing documents")
+		dropTemp(context, db, tmp.name)
+		return err
+	}
+
+	if err := ensureExpires(context, db, tmp); err != nil {
+		dropTemp(context, db, tmp.name)
+		return err
+	}
+
+	f := func(c *mgo.Collection) error {
+		cmd := bson.D{
+			{Name: "renameCollection", Value: c.Database.Name + "." + tmp.name},
+			{Name: "to", Value: c.Database.Name + "." + cs.name},
+			{Name: "dropTarget", Value: true},
+		}
+		return c.Database.Session.Run(cmd, nil)
+	}
+
+	if err := db.ExecuteMGO(context, cs.name, f); err != nil {
+		log.Error(context, "saveCollection", err, "Renaming collection")
+		dropTemp(context, db, tmp.name)
+		return err
+	}
+
+	return nil
+}
+
+// dropCollection drops the collection if it exists.
+func dropCollection(context interface{}, db *db.DB, name string) error {
+	f := func(c *mgo.Collection) error {
+		if err := c.DropCollection(); err != nil && !strings.Contains(err.Error(), "ns not found") {
+			return err
+		}
+		return nil
+	}
+
+	return db.ExecuteMGO(context, name, f)
+}
+
+// dropTemp drops the temporary collection of a save that failed. Failing to
+// drop it does not change the error the save failed with.
+func dropTemp(context interface{}, db *db.DB, name string) {
+	if err := dropCollection(context, db, name); err != nil {
+		log.Error(context, "dropTemp", err, "Dropping temporary collection %s", name)
+	}
+}
+
+// parseColSave extracts the options for saving results into a collection.
+func parseColSave(value interface{}) (colSave, error) {
+	cs := colSave{
+		mode: saveReplace,
+	}
+
+	switch v := value.(type) {
+	case string:
+		cs.name = v
+
+	case map[string]interface{}, bson.M:
+		doc, _ := cmdDoc(v)
+		for key, value := range doc {
+			str, ok := value.(string)
+			if !ok {
+				return colSave{}, fmt.Errorf("Save collection option %q is a %T but must be a string", key, value)
+			}
+
+			switch key {
+			case "name":
+				cs.name = str
+
+			case "mode":
+				if str != saveReplace && str != saveMerge {
+					return colSave{}, fmt.Errorf("Invalid save collection mode %q", str)
+				}
+				cs.mode = str
+
+			case "ttl":
+				d, err := time.ParseDuration(str)
+				if err != nil || d <= 0 {
+					return colSave{}, fmt.Errorf("Invalid save collection ttl %q", str)
+				}
+				cs.ttl = d
+
+			default:
+				return colSave{}, fmt.Errorf("Invalid save collection option %q", key)
+			}
+		}
+
+	default:
+		return colSave{}, fmt.Errorf("Save collection \"%v\" is a %T but must be a string or document", value, value)
+	}
+
+	if cs.name == "" || strings.ContainsAny(cs.name, "$\x00") {
+		return colSave{}, fmt.Errorf("Invalid save collection name %q", cs.name)
+	}
+
+	// Replacing renames over the collection, dropping what was there.
+	if reservedCollection(cs.name) {
+		return colSave{}, fmt.Errorf("Save collection %q is reserved", cs.name)
+	}
+
+	if !strings.HasPrefix(cs.name, savePrefix) {
+		return colSave{}, fmt.Errorf("Save collection %q must start with %q", cs.name, savePrefix)
+	}
+
+	return cs, nil
+}
+
+// writeDocs writes the documents into the collection in batches. When
+// merging, documents with an _id replace the existing document.
+func writeDocs(context interface{}, db *db.DB, name string, docs []bson.M, merge bool) error {
+	tx, err := db.BulkOperationMGO(context, name)
+	if err != nil {
+		return err
+	}
+
+	var queuedDocs int
+	for _, doc := range docs {
+
+		// Queue the write of the document.
+		if id, exists := doc["_id"]; merge && exists {
+			tx.Upsert(bson.M{"_id": id}, doc)
+		} else {
+			tx.Insert(doc)
+		}
+		queuedDocs++
+
+		// If the queued documents have reached the batch size, run the
+		// bulk operation and re-initialize it.
+		if queuedDocs >= saveBatch {
+			if _, err := tx.Run(); err != nil {
+				return err
+			}
+
+			if tx, err = db.BulkOperationMGO(context, name); err != nil {
+				return err
+			}
+			queuedDocs = 0
+		}
+	}
+
+	// Run the bulk operation for any remaining queued documents.
+	if queuedDocs > 0 {
+		if _, err := tx.Run(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureExpires creates the index that removes the saved documents once
+// they expire.
+func ensureExpires(context interface{}, db *db.DB, cs colSave) error {
+	if cs.ttl == 0 {
+		return nil
+	}
+
+	f := func(c *mgo.Collection) error {
+		return c.EnsureIndex(mgo.Index{Key: []string{expiresField}, ExpireAfter: time.Second})
+	}
+
+	if err := db.ExecuteMGO(context, cs.name, f); err != nil {
+		log.Error(context, "ensureExpires", err, "Creating index")
+		return err
+	}
+
+	return nil
+}
+
+// isCollectionSave returns true if the save writes into a collection.
+func isCollectionSave(save map[string]interface{}) bool {
+	_, exists := save["$collection"]
+	return exists
+}
@@ -0,0 +1,153 @@
+package xenia_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// savedCollection is the collection the tests save results into.
+const savedCollection = "saved_test_xenia"
+
+// TestSaveCollection tests saving the results of a query into a collection.
+func TestSaveCollection(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	t.Log("Given the need to load the test data.")
+	{
+		loadTestData(t, db)
+	}
+
+	defer func() {
+		t.Log("Given the need to unload the test data.")
+		{
+			unloadTestData(t, db)
+
+			db.ExecuteMGO(tests.Context, savedCollection, func(c *mgo.Collection) error {
+				return c.DropCollection()
+			})
+		}
+	}()
+
+	// set returns a set that saves the stations into the collection
+	// and reads them back.
+	set := func(save interface{}, stations ...string) *query.Set {
+		return &query.Set{
+			Name:    "Save Collection",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Save",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": stations}}},
+						{"$project": map[string]interface{}{"_id": "$station_id", "name": 1}},
+						{"$save": map[string]interface{}{"$collection": save}},
+					},
+				},
+			},
+		}
+	}
+
+	// count returns the number of documents in the collection.
+	count := func() int {
+		var n int
+		db.ExecuteMGO(tests.Context, savedCollection, func(c *mgo.Collection) error {
+			var err error
+			n, err = c.Count()
+			return err
+		})
+		return n
+	}
+
+	t.Log("Given the need to save results into a collection.")
+	{
+		t.Log("\tWhen replacing the documents of the collection")
+		{
+			for _, stations := range [][]string{{"42021", "44008"}, {"44005"}} {
+				result := xenia.Exec(tests.Context, db, set(savedCollection, stations...), nil)
+				if m, ok := result.Results.(bson.M); ok {
+					t.Fatalf("\t%s\tShould be able to execute the set : %v", tests.Failed, m["error"])
+				}
+			}
+			t.Logf("\t%s\tShould be able to execute the set.", tests.Success)
+
+			if n := count(); n != 1 {
+				t.Fatalf("\t%s\tShould only have the last results : %d", tests.Failed, n)
+			}
+			t.Logf("\t%s\tShould only have the last results.", tests.Success)
+		}
+
+		t.Log("\tWhen merging the documents into the collection")
+		{
+			save := map[string]interface{}{"name": savedCollection, "mode": "merge", "ttl": "1h"}
+
+			for _, stations := range [][]string{{"42021", "44008"}, {"42021"}} {
+				result := xenia.Exec(tests.Context, db, set(save, stations...), nil)
+				if m, ok := result.Results.(bson.M); ok {
+					t.Fatalf("\t%s\tShould be able to execute the set : %v", tests.Failed, m["error"])
+				}
+			}
+			t.Logf("\t%s\tShould be able to execute the set.", tests.Success)
+
+			if n := count(); n != 3 {
+				t.Fatalf("\t%s\tShould have the merged results : %d", tests.Failed, n)
+			}
+			t.Logf("\t%s\tShould have the merged results.", tests.Success)
+		}
+
+		t.Log("\tWhen using an invalid mode")
+		{
+			save := map[string]interface{}{"name": savedCollection, "mode": "append"}
+
+			result := xenia.Exec(tests.Context, db, set(save, "42021"), nil)
+			m, ok := result.Results.(bson.M)
+			if !ok || m["error"] != `Invalid save collection mode "append"` {
+				t.Fatalf("\t%s\tShould not be able to execute the set : %v", tests.Failed, result.Results)
+			}
+			t.Logf("\t%s\tShould not be able to execute the set.", tests.Success)
+		}
+
+		t.Log("\tWhen saving into a collection without the save prefix")
+		{
+			result := xenia.Exec(tests.Context, db, set(tstdata.CollectionExecTest, "42021"), nil)
+			m, ok := result.Results.(bson.M)
+			if !ok || m["error"] != `Save collection "test_xenia_data" must start with "saved_"` {
+				t.Fatalf("\t%s\tShould not be able to execute the set : %v", tests.Failed, result.Results)
+			}
+			t.Logf("\t%s\tShould not be able to execute the set.", tests.Success)
+		}
+
+		t.Log("\tWhen saving into a reserved collection")
+		{
+			saves := map[string]interface{}{
+				"query_policies": "query_policies",
+				"query_sets":     map[string]interface{}{"name": "query_sets", "mode": "merge"},
+				"system.users":   "system.users",
+			}
+
+			for name, save := range saves {
+				result := xenia.Exec(tests.Context, db, set(save, "42021"), nil)
+				m, ok := result.Results.(bson.M)
+				if !ok || m["error"] != `Save collection "`+name+`" is reserved` {
+					t.Fatalf("\t%s\tShould not be able to execute the set : %v", tests.Failed, result.Results)
+				}
+			}
+			t.Logf("\t%s\tShould not be able to execute the set.", tests.Success)
+		}
+	}
+}
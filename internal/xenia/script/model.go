@@ -2,7 +2,9 @@ package script
 
 import (
 	"errors"
+	"time"
 
+	"github.com/coralproject/shelf/internal/xenia/acl"
 	"gopkg.in/bluesuncorp/validator.v8"
 )
 
@@ -17,8 +19,10 @@ func init() {
 
 // Script contain pre and post commands to use per set or per query.
 type Script struct {
-	Name     string                   `bson:"name" json:"name" validate:"required,min=3"` // Unique name per Script document
-	Commands []map[string]interface{} `bson:"commands" json:"commands"`                   // Commands to add to a query.
+	Name     string                   `bson:"name" json:"name" validate:"required,min=3"`                              // Unique name per Script document
+	Commands []map[string]interface{} `bson:"commands" json:"commands"`                                                // Commands to add to a query.
+	Tags     []string                 `bson:"tags,omitempty" json:"tags,omitempty" validate:"omitempty,dive,required"` // Tags for finding the Script.
+	ACL      *acl.ACL                 `bson:"acl,omitempty" json:"acl,omitempty"`                                      // Who may edit the Script, execute does not apply.
 }
 
 // Validate checks the query value for consistency.
@@ -51,3 +55,10 @@ func (scr Script) PrepareForUse() {
 		prepareForUse(scr.Commands[c])
 	}
 }
+
+// Version contains a version of a Script within the history.
+type Version struct {
+	Version int       `bson:"-" json:"version"`      // Number of the version, the first version saved is 1.
+	Saved   time.Time `bson:"saved" json:"saved"`    // When the version was saved, zero if not recorded.
+	Script  Script    `bson:",inline" json:"script"` // The Script as it was saved.
+}
@@ -2,12 +2,15 @@ package script
 
 import (
 	"errors"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/db/mongo"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/tenant"
+	"github.com/coralproject/shelf/internal/xenia/history"
 	gc "github.com/patrickmn/go-cache"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -104,7 +107,7 @@ func Upsert(context interface{}, db *db.DB, scr Script) error {
 		su := bson.M{
 			"$push": bson.M{
 				"scripts": bson.M{
-					"$each":     []Script{scr},
+					"$each":     []Version{{Script: scr, Saved: time.Now().UTC()}},
 					"$position": 0,
 				},
 			},
@@ -134,7 +137,7 @@ func GetNames(context interface{}, db *db.DB) ([]string, error) {
 		Name string
 	}
 
-	key := "gns"
+	key := tenant.CacheKey(db, "gns")
 	if v, found := cache.Get(key); found {
 		names := v.([]string)
 		log.Dev(context, "GetNames", "Completed : CACHE : Scripts[%d]", len(names))
@@ -172,11 +175,12 @@ func GetNames(context interface{}, db *db.DB) ([]string, error) {
 	return names, nil
 }
 
-// GetAll retrieves a list of scripts.
+// GetAll retrieves a list of scripts. When tags are provided only the
+// scripts with all of the tags are returned.
 func GetAll(context interface{}, db *db.DB, tags []string) ([]Script, error) {
 	log.Dev(context, "GetAll", "Started : Tags[%v]", tags)
 
-	key := "gss" + strings.Join(tags, "-")
+	key := tenant.CacheKey(db, "gss"+url.Values{"tag": tags}.Encode())
 	if v, found := cache.Get(key); found {
 		scrs := v.([]Script)
 		log.Dev(context, "GetAll", "Completed : CACHE : Scripts[%d]", len(scrs))
@@ -185,8 +189,12 @@ func GetAll(context interface{}, db *db.DB, tags []string) ([]Script, error) {
 
 	var scrs []Script
 	f := func(c *mgo.Collection) error {
-		log.Dev(context, "GetAll", "MGO : db.%s.find({}).sort([\"name\"])", c.Name)
-		return c.Find(nil).All(&scrs)
+		q := bson.M{}
+		if len(tags) > 0 {
+			q["tags"] = bson.M{"$all": tags}
+		}
+		log.Dev(context, "GetAll", "MGO : db.%s.find(%s).sort([\"name\"])", c.Name, mongo.Query(q))
+		return c.Find(q).All(&scrs)
 	}
 
 	if err := db.ExecuteMGO(context, Collection, f); err != nil {
@@ -218,7 +226,7 @@ func GetAll(context interface{}, db *db.DB, tags []string) ([]Script, error) {
 func GetByName(context interface{}, db *db.DB, name string) (Script, error) {
 	log.Dev(context, "GetByName", "Started : Name[%s]", name)
 
-	key := "gbn" + name
+	key := tenant.CacheKey(db, "gbn"+name)
 	if v, found := cache.Get(key); found {
 		scr := v.(Script)
 		log.Dev(context, "GetByName", "Completed : CACHE : Script[%+v]", &scr)
@@ -254,7 +262,7 @@ func GetByName(context interface{}, db *db.DB, name string) (Script, error) {
 func GetByNames(context interface{}, db *db.DB, names []string) ([]Script, error) {
 	log.Dev(context, "GetByNames", "Started : Names[%+v]", names)
 
-	key := "gbns" + strings.Join(names, "-")
+	key := tenant.CacheKey(db, "gbns"+strings.Join(names, "-"))
 	if v, found := cache.Get(key); found {
 		scripts := v.([]Script)
 		log.Dev(context, "GetByNames", "Completed : CACHE : Scripts[%+v]", scripts)
@@ -328,7 +336,7 @@ func GetLastHistoryByName(context interface{}, db *db.DB, name string) (Script,
 		Scripts []Script `bson:"scripts"`
 	}
 
-	key := "glhbn" + name
+	key := tenant.CacheKey(db, "glhbn"+name)
 	if v, found := cache.Get(key); found {
 		result := v.(rslt)
 		log.Dev(context, "GetLastHistoryByName", "Completed : CACHE : Script[%+v]", &result.Scripts[0])
@@ -369,6 +377,97 @@ func GetLastHistoryByName(context interface{}, db *db.DB, name string) (Script,
 	return result.Scripts[0], nil
 }
 
+// GetHistory retrieves every version of the Script within the history, newest
+// first.
+func GetHistory(context interface{}, db *db.DB, name string) ([]Version, error) {
+	log.Dev(context, "GetHistory", "Started : Name[%s]", name)
+
+	type rslt struct {
+		Scripts []Version `bson:"scripts"`
+	}
+
+	key := tenant.CacheKey(db, "gh"+name)
+	if v, found := cache.Get(key); found {
+		versions := v.([]Version)
+		log.Dev(context, "GetHistory", "Completed : CACHE : Versions[%d]", len(versions))
+		return versions, nil
+	}
+
+	var result rslt
+
+	f := func(c *mgo.Collection) error {
+		q := bson.M{"name": name}
+		log.Dev(context, "GetHistory", "MGO : db.%s.find(%s)", c.Name, mongo.Query(q))
+		return c.Find(q).One(&result)
+	}
+
+	if err := db.ExecuteMGO(context, CollectionHistory, f); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrNotFound
+		}
+
+		log.Error(context, "GetHistory", err, "Completed")
+		return nil, err
+	}
+
+	if len(result.Scripts) == 0 {
+		log.Error(context, "GetHistory", ErrNotFound, "Completed")
+		return nil, ErrNotFound
+	}
+
+	// Number the versions and fix the scripts so they can be used.
+	for i := range result.Scripts {
+		result.Scripts[i].Version = history.Number(i, len(result.Scripts))
+		result.Scripts[i].Script.PrepareForUse()
+	}
+
+	cache.Set(key, result.Scripts, gc.DefaultExpiration)
+
+	log.Dev(context, "GetHistory", "Completed : Versions[%d]", len(result.Scripts))
+	return result.Scripts, nil
+}
+
+// GetVersion retrieves the specified version of the Script from the history.
+func GetVersion(context interface{}, db *db.DB, name string, version int) (Script, error) {
+	log.Dev(context, "GetVersion", "Started : Name[%s] Version[%d]", name, version)
+
+	versions, err := GetHistory(context, db, name)
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return Script{}, err
+	}
+
+	idx, err := history.Index(version, len(versions))
+	if err != nil {
+		log.Error(context, "GetVersion", err, "Completed")
+		return Script{}, err
+	}
+
+	log.Dev(context, "GetVersion", "Completed : Script[%+v]", versions[idx].Script)
+	return versions[idx].Script, nil
+}
+
+// Restore makes the specified version of the Script from the history the
+// current version. The restored Script is added to the history as a new
+// version so the restore can be undone.
+func Restore(context interface{}, db *db.DB, name string, version int) error {
+	log.Dev(context, "Restore", "Started : Name[%s] Version[%d]", name, version)
+
+	scr, err := GetVersion(context, db, name, version)
+	if err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	if err := Upsert(context, db, scr); err != nil {
+		log.Error(context, "Restore", err, "Completed")
+		return err
+	}
+
+	log.Dev(context, "Restore", "Completed")
+	return nil
+}
+
 // =============================================================================
 
 // Delete is used to remove an existing Set document.
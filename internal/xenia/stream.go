@@ -0,0 +1,187 @@
+package xenia
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// record represents a line written when streaming the results of a set.
+// After the documents of a paged query, a record with the token for the
+// next page is written.
+type record struct {
+	Name    string
+	Doc     bson.M `json:",omitempty"`
+	Next    string `json:",omitempty"`
+	Skipped bool   `json:",omitempty"`
+}
+
+// ExecStream executes the specified query set, writing the documents returned
+// by the queries to the writer as newline delimited JSON as they are read:
+//
+//	{"Name":"query name","Doc":{...}}
+//
+// A paged query with more results is followed by a record with the token
+// for the next page:
+//
+//	{"Name":"query name","Next":"..."}
+//
+// A query that is skipped because of its condition is written as:
+//
+//	{"Name":"query name","Skipped":true}
+//
+// If the set fails, a trailer record with the error and the commands is
+// written as the last line:
+//
+//	{"commands":[...],"error":"..."}
+//
+// The queries are executed in order and their results are not cached. When
+// the ctx is cancelled, the query still running is killed on the server. An
+// error is only returned when writing to the writer fails. The execution is
+// recorded in the audit log the same as for ExecContext. When checked is true
+// the variables were already processed by CheckParams and are not processed
+// again.
+func ExecStream(ctx context.Context, context interface{}, db *db.DB, set *query.Set, vars map[string]string, checked bool, w io.Writer) error {
+	log.Dev(context, "ExecStream", "Started : Name[%s]", set.Name)
+
+	enc := json.NewEncoder(w)
+
+	// If we have been provided a nil map, make one.
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+
+	// Record the execution in the audit log when it is sampled.
+	rec := sampleAudit(ctx, context, set)
+	if rec != nil {
+		defer addAudit(context, db, set, vars, rec)
+	}
+
+	return execStream(ctx, context, db, set, vars, checked, enc, rec)
+}
+
+// execStream streams the results of the query set, adding the outcome of
+// each query to the audit record if there is one.
+func execStream(ctx context.Context, context interface{}, db *db.DB, set *query.Set, vars map[string]string, checked bool, enc *json.Encoder, rec *audit.Record) error {
+
+	// Validate the set and the variables we have been provided.
+	if msg, err := prepareSet(context, db, set, vars, checked); err != nil {
+		return errRecord(context, enc, rec, err, nil, msg)
+	}
+
+	// The explain output is not a stream of documents.
+	if set.Explain {
+		return errRecord(context, enc, rec, errors.New("Explain is not supported when streaming"), nil, "Explain")
+	}
+
+	// The final commands are not a stream of documents.
+	if set.DryRun {
+		return errRecord(context, enc, rec, errors.New("Dry run is not supported when streaming"), nil, "Dry run")
+	}
+
+	// Load the pre/post scripts.
+	if err := loadPrePostScripts(context, db, set); err != nil {
+		return errRecord(context, enc, rec, err, nil, "Loading Pre/Post scripts")
+	}
+
+	// Apply the limits of the set to the execution.
+	ctx, cancel, lmts := withLimits(ctx, set)
+	defer cancel()
+
+	// Hold any data we have been asked to save.
+	data := make(map[string]interface{})
+
+	// Hold the first error writing to the writer.
+	var werr error
+
+	// Execute the queries in order, emitting the documents of the
+	// queries whose results are returned.
+	for i := range set.Queries {
+		q := set.Queries[i]
+
+		// Count the documents written for the audit log.
+		var emitted int
+
+		opts := execOpts{ctx: ctx, limits: lmts, sets: []string{set.Name}, types: paramTypes(set), caller: acl.FromContext(ctx)}
+		if q.Return {
+			opts.emit = func(doc bson.M) error {
+				if err := enc.Encode(record{Name: q.Name, Doc: doc}); err != nil {
+					werr = err
+					return err
+				}
+				emitted++
+				return nil
+			}
+		}
+
+		start := time.Now()
+		result, commands, err := execQuery(context, db, &q, vars, data, opts)
+
+		if rec != nil {
+			aq := auditQuery(q.Name, outcome{result: result, err: err, duration: time.Since(start)})
+			if q.Return {
+				aq.Docs = emitted
+				rec.Docs += emitted
+			}
+			rec.Queries = append(rec.Queries, aq)
+		}
+
+		// The client is no longer reading the results.
+		if werr != nil {
+			if rec != nil {
+				rec.Error = werr.Error()
+			}
+
+			log.Error(context, "ExecStream", werr, "Completed : Writing results")
+			return werr
+		}
+
+		if err != nil {
+
+			// Were we told to continue to the next one.
+			if q.Continue {
+				continue
+			}
+
+			return errRecord(context, enc, rec, err, commands, "Executing Result")
+		}
+
+		// Mark the query as skipped or provide the token for the next
+		// page of results.
+		if q.Return && (result.Skipped || result.Next != "") {
+			if err := enc.Encode(record{Name: q.Name, Next: result.Next, Skipped: result.Skipped}); err != nil {
+				log.Error(context, "ExecStream", err, "Completed : Writing results")
+				return err
+			}
+		}
+	}
+
+	log.Dev(context, "ExecStream", "Completed")
+	return nil
+}
+
+// errRecord writes the trailer record with the error and the commands. The
+// error is added to the audit record if there is one.
+func errRecord(context interface{}, enc *json.Encoder, rec *audit.Record, err error, commands []map[string]interface{}, msg string) error {
+	log.Error(context, "errRecord", err, "Completed : %s", msg)
+
+	if rec != nil {
+		rec.Error = err.Error()
+	}
+
+	trailer := bson.M{"error": err.Error()}
+	if commands != nil {
+		trailer["commands"] = commands
+	}
+
+	return enc.Encode(trailer)
+}
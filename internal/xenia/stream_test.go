@@ -0,0 +1,127 @@
+package xenia_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestExecStream tests streaming the results of a set.
+func TestExecStream(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	db, err := db.NewMGO(tests.Context, tests.TestSession)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to get a Mongo session : %v", tests.Failed, err)
+	}
+	defer db.CloseMGO(tests.Context)
+
+	t.Log("Given the need to load the test data.")
+	{
+		loadTestData(t, db)
+	}
+
+	defer func() {
+		t.Log("Given the need to unload the test data.")
+		{
+			unloadTestData(t, db)
+		}
+	}()
+
+	set := query.Set{
+		Name:    "Stream",
+		Enabled: true,
+		Queries: []query.Query{
+			{
+				Name:       "Stream Pipeline",
+				Type:       "pipeline",
+				Collection: tstdata.CollectionExecTest,
+				Return:     true,
+				Commands: []map[string]interface{}{
+					{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44008"}}}},
+					{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					{"$sort": map[string]interface{}{"name": 1}},
+				},
+			},
+			{
+				Name:       "Stream Count",
+				Type:       "count",
+				Collection: tstdata.CollectionExecTest,
+				Return:     true,
+				Commands: []map[string]interface{}{
+					{"filter": map[string]interface{}{"station_id": "42021"}},
+				},
+			},
+			{
+				Name:       "Stream Invalid",
+				Type:       "find",
+				Collection: tstdata.CollectionExecTest,
+				Return:     true,
+				Commands: []map[string]interface{}{
+					{"fields": 1},
+				},
+			},
+		},
+	}
+
+	t.Log("Given the need to stream the results of a set.")
+	{
+		t.Logf("\tWhen using Execute Set %s", set.Name)
+		{
+			var b bytes.Buffer
+			if err := xenia.ExecStream(context.Background(), tests.Context, db, &set, nil, false, &b); err != nil {
+				t.Fatalf("\t%s\tShould be able to write the results : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to write the results.", tests.Success)
+
+			exp := `{"Name":"Stream Pipeline","Doc":{"name":"C14 - Pasco County Buoy, FL"}}` + "\n" +
+				`{"Name":"Stream Pipeline","Doc":{"name":"NANTUCKET 54NM Southeast of Nantucket"}}` + "\n" +
+				`{"Name":"Stream Count","Doc":{"count":1}}` + "\n" +
+				`{"commands":[{"fields":1}],"error":"Invalid find option \"fields\""}` + "\n"
+
+			if b.String() != exp {
+				t.Log("Exp:", exp)
+				t.Log("Got:", b.String())
+				t.Fatalf("\t%s\tShould get a line per document and the error trailer.", tests.Failed)
+			}
+			t.Logf("\t%s\tShould get a line per document and the error trailer.", tests.Success)
+		}
+
+		t.Log("\tWhen the audit log is on")
+		{
+			xenia.UseAudit(1)
+			defer xenia.UseAudit(0)
+
+			// Records can't be removed from a capped collection so the
+			// set gets a name of its own.
+			audited := set
+			audited.Name = "QTEST_stream_" + bson.NewObjectId().Hex()
+
+			var b bytes.Buffer
+			if err := xenia.ExecStream(context.Background(), tests.Context, db, &audited, nil, false, &b); err != nil {
+				t.Fatalf("\t%s\tShould be able to write the results : %v", tests.Failed, err)
+			}
+			t.Logf("\t%s\tShould be able to write the results.", tests.Success)
+
+			recs, err := audit.Get(tests.Context, db, audit.Filter{Set: audited.Name})
+			if err != nil || len(recs) != 1 {
+				t.Fatalf("\t%s\tShould be able to read the audit record : %d : %v", tests.Failed, len(recs), err)
+			}
+			t.Logf("\t%s\tShould be able to read the audit record.", tests.Success)
+
+			if rec := recs[0]; rec.Docs != 3 || len(rec.Queries) != 3 || rec.Error != `Invalid find option "fields"` {
+				t.Fatalf("\t%s\tShould record the outcome of the queries : %+v", tests.Failed, rec)
+			}
+			t.Logf("\t%s\tShould record the outcome of the queries.", tests.Success)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package xenia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/ardanlabs/kit/db"
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/query"
+)
+
+// tmplData is the data provided to a template when it is rendered.
+type tmplData struct {
+	Vars map[string]tmplVar
+	Data map[string]interface{}
+}
+
+// tmplVar is a variable provided to a template. The variables come from the
+// caller so they always render as JSON strings, keeping their values from
+// changing the commands the template renders.
+type tmplVar string
+
+// String implements the fmt.Stringer interface so the variable renders the
+// same as with the json function.
+func (v tmplVar) String() string {
+	data, _ := json.Marshal(string(v))
+	return string(data)
+}
+
+// tmplFuncs are the functions available to templates beyond the builtins.
+var tmplFuncs = template.FuncMap{
+	"json":   tmplJSON,
+	"number": tmplNumber,
+}
+
+// execTemplate renders the $template commands of the query and executes the
+// rendered commands as a pipeline.
+func execTemplate(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
+
+	// {"$template": "[{\"$match\": {\"station_id\": {{.Vars.station_id}}}}{{if .Vars.limit}}, {\"$limit\": {{number .Vars.limit}}}{{end}}]"}
+
+	// Replace each $template command with the commands it renders. The
+	// variables of the other commands are substituted here since the
+	// rendered commands must not be substituted again, or a variable
+	// rendered as a string could run as a variable command.
+	var commands []map[string]interface{}
+	for _, command := range q.Commands {
+		v, exists := command["$template"]
+		if !exists {
+			if _, save := command["$save"]; !save && vars != nil {
+				if err := processVariables(context, command, vars, opts.types, opts.claims(), data); err != nil {
+					return docs{}, q.Commands, err
+				}
+			}
+
+			commands = append(commands, command)
+			continue
+		}
+
+		text, ok := v.(string)
+		if !ok {
+			err := fmt.Errorf("Template \"%v\" is a %T but must be a string", v, v)
+			log.Error(context, "execTemplate", err, "Checking template")
+			return docs{}, q.Commands, err
+		}
+
+		rendered, err := renderTemplate(context, q.Name, text, vars, data)
+		if err != nil {
+			return docs{}, q.Commands, err
+		}
+
+		commands = append(commands, rendered...)
+	}
+
+	// Execute the rendered commands as a pipeline query.
+	pq := *q
+	pq.Type = query.TypePipeline
+	pq.Commands = commands
+
+	opts.noVars = true
+	return execPipeline(context, db, &pq, vars, data, opts)
+}
+
+// renderTemplate executes the template against the variables and saved
+// results. The output must be a JSON document or an array of documents.
+func renderTemplate(context interface{}, name string, text string, vars map[string]string, data map[string]interface{}) ([]map[string]interface{}, error) {
+	tmpl, err := template.New(name).Funcs(tmplFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		log.Error(context, "renderTemplate", err, "Parsing template")
+		return nil, err
+	}
+
+	tvars := make(map[string]tmplVar, len(vars))
+	for k, v := range vars {
+		tvars[k] = tmplVar(v)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, tmplData{Vars: tvars, Data: data}); err != nil {
+		log.Error(context, "renderTemplate", err, "Executing template")
+		return nil, err
+	}
+
+	log.Dev(context, "renderTemplate", "Rendered\n%s", b.String())
+
+	// The template can produce a single command or an array of commands.
+	rendered := bytes.TrimSpace(b.Bytes())
+	if len(rendered) > 0 && rendered[0] == '{' {
+		var command map[string]interface{}
+		if err := json.Unmarshal(rendered, &command); err != nil {
+			err = fmt.Errorf("Template rendered invalid JSON : %v", err)
+			log.Error(context, "renderTemplate", err, "Unmarshaling command")
+			return nil, err
+		}
+
+		return []map[string]interface{}{command}, nil
+	}
+
+	var commands []map[string]interface{}
+	if err := json.Unmarshal(rendered, &commands); err != nil {
+		err = fmt.Errorf("Template rendered invalid JSON : %v", err)
+		log.Error(context, "renderTemplate", err, "Unmarshaling commands")
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+// tmplJSON is a template function that renders the value as JSON.
+func tmplJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// tmplNumber is a template function that renders the variable as a JSON
+// number. It fails if the variable is not a number.
+func tmplNumber(v tmplVar) (string, error) {
+	var n float64
+	if err := json.Unmarshal([]byte(v), &n); err != nil {
+		return "", fmt.Errorf("Variable value %q is not a number", string(v))
+	}
+
+	return string(v), nil
+}
@@ -0,0 +1,165 @@
+package xenia_test
+
+import (
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"github.com/coralproject/shelf/tstdata"
+)
+
+// getTemplateExecSet returns the table for the testing.
+func getTemplateExecSet() []execSet {
+	return []execSet{
+		templateBasic(),
+		templateConditional(),
+		templateSaveRange(),
+		templateInvalidJSON(),
+		templateVarCommand(),
+	}
+}
+
+// templateBasic renders a simple template with a variable.
+func templateBasic() execSet {
+	return execSet{
+		fail: false,
+		vars: map[string]string{"station_id": "42021"},
+		set: &query.Set{
+			Name:    "Template Basic",
+			Enabled: true,
+			Params: []query.Param{
+				{Name: "station_id"},
+			},
+			Queries: []query.Query{
+				{
+					Name:       "Template Basic",
+					Type:       "template",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$template": `[{"$match": {"station_id": {{json .Vars.station_id}}}}, {"$project": {"_id": 0, "name": 1}}]`},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Template Basic","Docs":[{"name":"C14 - Pasco County Buoy, FL"}]}]}`,
+		},
+	}
+}
+
+// templateConditional renders a template with an optional $match clause
+// followed by commands that are not templated.
+func templateConditional() execSet {
+	return execSet{
+		fail: false,
+		vars: map[string]string{"station_id": "44008"},
+		set: &query.Set{
+			Name:    "Template Conditional",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Template Conditional",
+					Type:       "template",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$template": `{"$match": {{if .Vars.station_id}}{"station_id": {{json .Vars.station_id}}}{{else}}{}{{end}}}`},
+						{"$project": map[string]interface{}{"_id": 0, "name": 1}},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Template Conditional","Docs":[{"name":"NANTUCKET 54NM Southeast of Nantucket"}]}]}`,
+		},
+	}
+}
+
+// templateSaveRange renders a template by ranging over saved results.
+func templateSaveRange() execSet {
+	return execSet{
+		fail: false,
+		set: &query.Set{
+			Name:    "Template Save Range",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Get Ids",
+					Type:       "pipeline",
+					Collection: tstdata.CollectionExecTest,
+					Return:     false,
+					Commands: []map[string]interface{}{
+						{"$match": map[string]interface{}{"station_id": map[string]interface{}{"$in": []string{"42021", "44008"}}}},
+						{"$project": map[string]interface{}{"_id": 0, "station_id": 1}},
+						{"$save": map[string]interface{}{"$map": "list"}},
+					},
+				},
+				{
+					Name:       "Get Documents",
+					Type:       "template",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$template": `[{"$match": {"$or": [{{range $i, $doc := .Data.list}}{{if $i}}, {{end}}{"station_id": {{json $doc.station_id}}}{{end}}]}}, {"$project": {"_id": 0, "name": 1}}]`},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Get Documents","Docs":[{"name":"C14 - Pasco County Buoy, FL"},{"name":"NANTUCKET 54NM Southeast of Nantucket"}]}]}`,
+		},
+	}
+}
+
+// templateInvalidJSON renders a template that does not produce valid JSON.
+func templateInvalidJSON() execSet {
+	return execSet{
+		fail: true,
+		set: &query.Set{
+			Name:    "Template Invalid JSON",
+			Enabled: true,
+			Queries: []query.Query{
+				{
+					Name:       "Template Invalid JSON",
+					Type:       "template",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$template": `[{"$match": {"station_id": }}]`},
+					},
+				},
+			},
+		},
+		results: []string{
+			`#find:"error":"Template rendered invalid JSON`,
+		},
+	}
+}
+
+// templateVarCommand renders a variable whose value looks like a variable
+// command, which must stay a literal string.
+func templateVarCommand() execSet {
+	return execSet{
+		fail: false,
+		vars: map[string]string{"station_id": "#regex:/.*/"},
+		set: &query.Set{
+			Name:    "Template Var Command",
+			Enabled: true,
+			Params: []query.Param{
+				{Name: "station_id"},
+			},
+			Queries: []query.Query{
+				{
+					Name:       "Template Var Command",
+					Type:       "template",
+					Collection: tstdata.CollectionExecTest,
+					Return:     true,
+					Commands: []map[string]interface{}{
+						{"$template": `[{"$match": {"station_id": {{.Vars.station_id}}}}, {"$project": {"_id": 0, "name": 1}}]`},
+					},
+				},
+			},
+		},
+		results: []string{
+			`{"results":[{"Name":"Template Var Command","Docs":[]}]}`,
+		},
+	}
+}
@@ -1,8 +1,10 @@
 package xenia
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -14,9 +16,17 @@ import (
 // ProcessVariables walks the document performing variable substitutions.
 // This function is exported because it is accessed by the tstdata package.
 func ProcessVariables(context interface{}, commands map[string]interface{}, vars map[string]string, results map[string]interface{}) error {
+	return processVariables(context, commands, vars, nil, nil, results)
+}
+
+// processVariables walks the document performing variable substitutions. The
+// variables of typed parameters are substituted as their declared type.
+func processVariables(context interface{}, commands map[string]interface{}, vars map[string]string, types map[string]string, claims map[string]interface{}, results map[string]interface{}) error {
 
 	// commands: Contains the mongodb pipeline with any extenstions.
 	// vars    : Key/Value pairs passed into the set execution for variable substituion.
+	// types   : Declared types of the variables for typed parameters.
+	// claims  : Claims of the validated JWT of the caller, if any.
 	// results : Any result from previous sets that have been saved.
 
 	// A map of keys that may need to be replaced.
@@ -37,39 +47,59 @@ func ProcessVariables(context interface{}, commands map[string]interface{}, vars
 
 		// We have another document.
 		case map[string]interface{}:
-			if err := ProcessVariables(context, doc, vars, results); err != nil {
+			if err := processVariables(context, doc, vars, types, claims, results); err != nil {
 				return err
 			}
 
 		// We have a string value so check it.
 		case string:
 			if doc != "" && doc[0] == '#' {
-				if err := valSub(context, key, doc, commands, vars, results); err != nil {
+				if err := valSub(context, key, doc, commands, vars, types, claims, results); err != nil {
 					return err
 				}
+				continue
+			}
+
+			// Are there variables within the string.
+			if hasInline(doc) {
+				v, err := interpolate(context, doc, vars, types, claims, results)
+				if err != nil {
+					return err
+				}
+				commands[key] = v
 			}
 
 		// We have an array of values.
 		case []interface{}:
 
 			// Iterate over the array of values.
-			for _, subDoc := range doc {
+			for i, subDoc := range doc {
 
 				// What type of subDoc is this array made of.
 				switch arrDoc := subDoc.(type) {
 
 				// We have another document.
 				case map[string]interface{}:
-					if err := ProcessVariables(context, arrDoc, vars, results); err != nil {
+					if err := processVariables(context, arrDoc, vars, types, claims, results); err != nil {
 						return err
 					}
 
 				// We have a string value so check it.
 				case string:
 					if arrDoc != "" && arrDoc[0] == '#' {
-						if err := valSub(context, key, arrDoc, commands, vars, results); err != nil {
+						if err := valSub(context, key, arrDoc, commands, vars, types, claims, results); err != nil {
+							return err
+						}
+						continue
+					}
+
+					// Are there variables within the string.
+					if hasInline(arrDoc) {
+						v, err := interpolate(context, arrDoc, vars, types, claims, results)
+						if err != nil {
 							return err
 						}
+						doc[i] = v
 					}
 				}
 			}
@@ -136,8 +166,87 @@ func fldSub(context interface{}, key string, vars map[string]string, replace map
 	return nil
 }
 
+// inlineVar matches the variables used within a larger string, like
+// "prefix-#string:name-suffix".
+var inlineVar = regexp.MustCompile(`#(string|number|float|bool|date|objid|time|claim|data\.[0-9*]+):(-?\w+(?:\.\w+)*)`)
+
+// inlineField matches the field variables used within a string value, like
+// "$data.{field}".
+var inlineField = regexp.MustCompile(`\{(\w+)\}`)
+
+// hasInline returns true when the string may have variables within it.
+func hasInline(value string) bool {
+	return strings.IndexByte(value, '#') != -1 || strings.IndexByte(value, '{') != -1
+}
+
+// interpolate replaces the variables within the string with their values.
+// Field variables that don't exist are left as they are.
+func interpolate(context interface{}, value string, vars map[string]string, types map[string]string, claims map[string]interface{}, results map[string]interface{}) (string, error) {
+
+	// Before: "prefix-#string:name-suffix"  After: "prefix-bill-suffix"
+	// Before: "$data.{field}"               After: "$data.name"
+
+	var err error
+	value = inlineVar.ReplaceAllStringFunc(value, func(match string) string {
+		if err != nil {
+			return match
+		}
+
+		sub := inlineVar.FindStringSubmatch(match)
+
+		var v interface{}
+		if v, err = varLookup(context, sub[1], sub[2], vars, types, claims, results); err != nil {
+			return match
+		}
+
+		return varString(v)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	value = inlineField.ReplaceAllStringFunc(value, func(match string) string {
+		if v, exists := vars[match[1:len(match)-1]]; exists {
+			return v
+		}
+		return match
+	})
+
+	return value, nil
+}
+
+// varString converts a substituted value back to the string form used for
+// variables.
+func varString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+
+	// The format the #date command parses.
+	case time.Time:
+		return v.UTC().Format(dateLayout)
+
+	case bson.ObjectId:
+		return v.Hex()
+
+	// The items of lists are comma separated.
+	case []interface{}:
+		items := make([]string, len(v))
+		for i := range v {
+			items[i] = varString(v[i])
+		}
+		return strings.Join(items, ",")
+
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
+
 // valSub replaces variables inside the command set with values.
-func valSub(context interface{}, key, variable string, commands map[string]interface{}, vars map[string]string, results map[string]interface{}) error {
+func valSub(context interface{}, key, variable string, commands map[string]interface{}, vars map[string]string, types map[string]string, claims map[string]interface{}, results map[string]interface{}) error {
 
 	// Before: {"field": "#number:variable_name"}  After: {"field": 1234}
 	// key: "field"  variable:"#cmd:variable_name"
@@ -159,6 +268,29 @@ func valSub(context interface{}, key, variable string, commands map[string]inter
 
 	switch key {
 	case "$in":
+
+		// Lists of variables can be used like saved results.
+		if isListCmd(cmd) {
+			v, err := listLookup(context, cmd, vari, vars)
+			if err != nil {
+				return err
+			}
+
+			commands[key] = v
+			return nil
+		}
+
+		// Claims can hold a list of values.
+		if cmd == "claim" {
+			v, err := claimLookup(context, vari, claims)
+			if err != nil {
+				return err
+			}
+
+			commands[key] = v
+			return nil
+		}
+
 		if len(cmd) != 6 || cmd[0:4] != "data" {
 			err := fmt.Errorf("Invalid $in command %q, missing \"data\" keyword or malformed", cmd)
 			log.Error(context, "varSub", err, "$in command processing")
@@ -174,7 +306,7 @@ func valSub(context interface{}, key, variable string, commands map[string]inter
 		return nil
 
 	default:
-		v, err := varLookup(context, cmd, vari, vars, results)
+		v, err := varLookup(context, cmd, vari, vars, types, claims, results)
 		if err != nil {
 			return err
 		}
@@ -185,7 +317,7 @@ func valSub(context interface{}, key, variable string, commands map[string]inter
 }
 
 // varLookup looks up variables and returns their values as the specified type.
-func varLookup(context interface{}, cmd, variable string, vars map[string]string, results map[string]interface{}) (interface{}, error) {
+func varLookup(context interface{}, cmd, variable string, vars map[string]string, types map[string]string, claims map[string]interface{}, results map[string]interface{}) (interface{}, error) {
 
 	// {"field": "#cmd:variable"}
 	// Before: {"field": "#number:variable_name"}  		After: {"field": 1234}
@@ -194,7 +326,15 @@ func varLookup(context interface{}, cmd, variable string, vars map[string]string
 	// Before: {"field": "#objid:variable_name"}   		After: {"field": mgo.ObjectId}
 	// Before: {"field": "#regex:/pattern/<options>"}   After: {"field": bson.RegEx}
 	// Before: {"field": "#since:3600"}   				After: {"field": time.Time}
+	// Before: {"field": "#dateexpr:since -30d /d"}		After: {"field": time.Time}
 	// Before: {"field": "#data.0:doc.station_id"}   	After: {"field": "23453"}
+	// Before: {"field": "#float:variable_name"}  		After: {"field": 12.34}
+	// Before: {"field": "#bool:variable_name"}  		After: {"field": true}
+	// Before: {"field": "#json:variable_name"}  		After: {"field": {"sub": "document"}}
+	// Before: {"field": "#list:variable_name"}   		After: {"field": ["a", "b"]}
+	// Before: {"field": "#numlist:variable_name"}   	After: {"field": [1, 2]}
+	// Before: {"field": "#objidlist:variable_name"}   	After: {"field": [mgo.ObjectId, mgo.ObjectId]}
+	// Before: {"field": "#claim:claim_name"}   		After: {"field": "value of the claim"}
 
 	// If the variable does not exist, use the variable straight up.
 	param, exists := vars[variable]
@@ -202,6 +342,21 @@ func varLookup(context interface{}, cmd, variable string, vars map[string]string
 		param = variable
 	}
 
+	// Lists share their prefix with other commands.
+	if isListCmd(cmd) {
+		return listLookup(context, cmd, variable, vars)
+	}
+
+	// Date expressions share their prefix with the date command.
+	if cmd == "dateexpr" {
+		return dateExpr(context, variable, vars, time.Now())
+	}
+
+	// Claims come from the JWT of the caller and never from the variables.
+	if cmd == "claim" {
+		return claimLookup(context, variable, claims)
+	}
+
 	// Do we have a command that is not known.
 	if len(cmd) < 4 {
 		err := fmt.Errorf("Unknown command %q", cmd)
@@ -214,7 +369,22 @@ func varLookup(context interface{}, cmd, variable string, vars map[string]string
 	case "numb":
 		return number(context, param)
 
+	case "floa":
+		return float(context, param)
+
+	case "bool":
+		return boolean(context, param)
+
+	case "json":
+		return jsonValue(context, param)
+
 	case "stri":
+
+		// Variables of typed parameters are substituted as their type.
+		if typ, ok := types[variable]; ok && exists {
+			return typedValue(context, typ, param)
+		}
+
 		return param, nil
 
 	case "date":
@@ -245,6 +415,81 @@ func varLookup(context interface{}, cmd, variable string, vars map[string]string
 	}
 }
 
+// claimLookup returns the value of the named claim of the caller.
+func claimLookup(context interface{}, name string, claims map[string]interface{}) (interface{}, error) {
+	if claims == nil {
+		err := fmt.Errorf("Claim %q requires an authenticated caller", name)
+		log.Error(context, "claimLookup", err, "Checking claims")
+		return nil, err
+	}
+
+	v, exists := claims[name]
+	if !exists {
+		err := fmt.Errorf("Claim %q not found", name)
+		log.Error(context, "claimLookup", err, "Checking claims")
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// isListCmd returns true if the command substitutes a list of values.
+func isListCmd(cmd string) bool {
+	switch cmd {
+	case "list", "numlist", "objidlist":
+		return true
+	}
+
+	return false
+}
+
+// listLookup looks up the variable and returns its comma separated values
+// as an array of the type for the command.
+func listLookup(context interface{}, cmd, variable string, vars map[string]string) ([]interface{}, error) {
+
+	// Before: {"field": {"$in": "#numlist:ids"}}   ids: "1,2,3"
+	// After : {"field": {"$in": [1, 2, 3]}}
+
+	param, exists := vars[variable]
+	if !exists {
+		err := fmt.Errorf("Variable %q does not exist", variable)
+		log.Error(context, "listLookup", err, "Checking variable")
+		return nil, err
+	}
+
+	return listValues(context, cmd, param)
+}
+
+// listValues converts the comma separated values into an array of the type
+// for the list command.
+func listValues(context interface{}, cmd, value string) ([]interface{}, error) {
+	items := splitList(value)
+	list := make([]interface{}, len(items))
+
+	for i, item := range items {
+		switch cmd {
+		case "numlist":
+			n, err := number(context, item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = n
+
+		case "objidlist":
+			id, err := objID(context, item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = id
+
+		default:
+			list[i] = item
+		}
+	}
+
+	return list, nil
+}
+
 // dataLookup looks up data from the saved results based on the data operation
 // and the lookup value.
 func dataLookup(context interface{}, dataOp, lookup string, results map[string]interface{}) (interface{}, error) {
@@ -256,6 +501,11 @@ func dataLookup(context interface{}, dataOp, lookup string, results map[string]i
 	//  	lookup : "list.station_id"							    //  	lookup : "list.station_id"
 	//  	results: {"list": [{"station_id":"42021"}]}				//  	results: {"list": [{"station_id":"42021"}, {"station_id":"23567"}]}
 
+	// During a dry run the saved results are placeholders.
+	if v, ok := dryRunLookup(dataOp, lookup, results); ok {
+		return v, nil
+	}
+
 	// Find the result data based on the lookup and the field lookup.
 	data, field, err := findResultData(context, lookup, results)
 	if err != nil {
@@ -414,6 +664,40 @@ func number(context interface{}, value string) (int, error) {
 	return i, nil
 }
 
+// float is a helper function to convert a string into a float.
+func float(context interface{}, value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		err = fmt.Errorf("Parameter %q is not a float", value)
+		log.Error(context, "varLookup", err, "Float conversion")
+		return 0, err
+	}
+	return f, nil
+}
+
+// boolean is a helper function to convert a string into a bool.
+func boolean(context interface{}, value string) (bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		err = fmt.Errorf("Parameter %q is not a bool", value)
+		log.Error(context, "varLookup", err, "Bool conversion")
+		return false, err
+	}
+	return b, nil
+}
+
+// jsonValue is a helper function to parse a JSON value, like a sub-document
+// or an array, from a string.
+func jsonValue(context interface{}, value string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		err = fmt.Errorf("Parameter %q is not valid JSON : %v", value, err)
+		log.Error(context, "varLookup", err, "JSON parsing")
+		return nil, err
+	}
+	return v, nil
+}
+
 // isoDate is a helper function to convert the internal extension for dates
 // into a BSON date. We convert the following string
 func isoDate(context interface{}, value string) (time.Time, error) {
@@ -1,6 +1,7 @@
 package xenia_test
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -178,6 +179,157 @@ func compareTime(t1 time.Time, t2 time.Time) bool {
 	return true
 }
 
+// TestListVariables tests substituting variables with lists of values.
+func TestListVariables(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	vars := map[string]string{
+		"ids":    "42021, 44008",
+		"nums":   "1,2,3",
+		"objids": "5660bc6e16908cae692e0593",
+	}
+
+	commands := []struct {
+		doc   map[string]interface{}
+		after map[string]interface{}
+	}{
+		{
+			map[string]interface{}{"station_id": map[string]interface{}{"$in": "#list:ids"}},
+			map[string]interface{}{"station_id": map[string]interface{}{"$in": []interface{}{"42021", "44008"}}},
+		},
+		{
+			map[string]interface{}{"count": map[string]interface{}{"$nin": "#numlist:nums"}},
+			map[string]interface{}{"count": map[string]interface{}{"$nin": []interface{}{1, 2, 3}}},
+		},
+		{
+			map[string]interface{}{"ids": map[string]interface{}{"$all": "#objidlist:objids"}},
+			map[string]interface{}{"ids": map[string]interface{}{"$all": []interface{}{bson.ObjectIdHex("5660bc6e16908cae692e0593")}}},
+		},
+	}
+
+	t.Logf("Given the need to substitute lists of values.")
+	{
+		for _, cmd := range commands {
+			t.Logf("\tWhen using %+v", cmd.doc)
+			{
+				if err := xenia.ProcessVariables("", cmd.doc, vars, nil); err != nil {
+					t.Errorf("\t%s\tShould be able to process the variables : %v", tests.Failed, err)
+					continue
+				}
+				t.Logf("\t%s\tShould be able to process the variables.", tests.Success)
+
+				if !reflect.DeepEqual(cmd.doc, cmd.after) {
+					t.Log(cmd.doc)
+					t.Log(cmd.after)
+					t.Errorf("\t%s\tShould get back the expected document.", tests.Failed)
+					continue
+				}
+				t.Logf("\t%s\tShould get back the expected document.", tests.Success)
+			}
+		}
+
+		t.Logf("\tWhen a list has an invalid value")
+		{
+			doc := map[string]interface{}{"count": map[string]interface{}{"$in": "#numlist:ids"}}
+			vars := map[string]string{"ids": "1,two"}
+
+			if err := xenia.ProcessVariables("", doc, vars, nil); err == nil {
+				t.Errorf("\t%s\tShould not be able to process the variables.", tests.Failed)
+			} else {
+				t.Logf("\t%s\tShould not be able to process the variables.", tests.Success)
+			}
+		}
+	}
+}
+
+// TestInlineVariables tests substituting typed values and variables within
+// larger strings.
+func TestInlineVariables(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	vars := map[string]string{
+		"name":  "bill",
+		"ratio": "0.25",
+		"on":    "true",
+		"doc":   `{"$gt": 10}`,
+		"field": "station_id",
+		"date":  "2013-01-16",
+	}
+
+	commands := []struct {
+		doc   map[string]interface{}
+		after map[string]interface{}
+	}{
+		{
+			map[string]interface{}{"ratio": "#float:ratio"},
+			map[string]interface{}{"ratio": 0.25},
+		},
+		{
+			map[string]interface{}{"on": "#bool:on"},
+			map[string]interface{}{"on": true},
+		},
+		{
+			map[string]interface{}{"count": "#json:doc"},
+			map[string]interface{}{"count": map[string]interface{}{"$gt": float64(10)}},
+		},
+		{
+			map[string]interface{}{"since": "#dateexpr:date -1M /M"},
+			map[string]interface{}{"since": time.Date(2012, 12, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			map[string]interface{}{"id": "prefix-#string:name-suffix"},
+			map[string]interface{}{"id": "prefix-bill-suffix"},
+		},
+		{
+			map[string]interface{}{"label": "By #string:name on #date:date"},
+			map[string]interface{}{"label": "By bill on 2013-01-16T00:00:00.000Z"},
+		},
+		{
+			map[string]interface{}{"$project": map[string]interface{}{"value": "$data.{field}", "other": "a{2}"}},
+			map[string]interface{}{"$project": map[string]interface{}{"value": "$data.station_id", "other": "a{2}"}},
+		},
+		{
+			map[string]interface{}{"$concat": []interface{}{"$name", "-#string:name"}},
+			map[string]interface{}{"$concat": []interface{}{"$name", "-bill"}},
+		},
+	}
+
+	t.Logf("Given the need to substitute typed values and variables within strings.")
+	{
+		for _, cmd := range commands {
+			t.Logf("\tWhen using %+v", cmd.doc)
+			{
+				if err := xenia.ProcessVariables("", cmd.doc, vars, nil); err != nil {
+					t.Errorf("\t%s\tShould be able to process the variables : %v", tests.Failed, err)
+					continue
+				}
+				t.Logf("\t%s\tShould be able to process the variables.", tests.Success)
+
+				if !reflect.DeepEqual(cmd.doc, cmd.after) {
+					t.Log(cmd.doc)
+					t.Log(cmd.after)
+					t.Errorf("\t%s\tShould get back the expected document.", tests.Failed)
+					continue
+				}
+				t.Logf("\t%s\tShould get back the expected document.", tests.Success)
+			}
+		}
+
+		t.Logf("\tWhen a value can't be converted")
+		{
+			doc := map[string]interface{}{"id": "prefix-#number:name"}
+
+			if err := xenia.ProcessVariables("", doc, vars, nil); err == nil {
+				t.Errorf("\t%s\tShould not be able to process the variables.", tests.Failed)
+			} else {
+				t.Logf("\t%s\tShould not be able to process the variables.", tests.Success)
+			}
+		}
+	}
+}
+
 // compareBson compares two bson maps for equivalence.
 func compareBson(m1 bson.M, m2 bson.M) bool {
 	if len(m1) != len(m2) {
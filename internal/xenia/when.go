@@ -0,0 +1,68 @@
+package xenia
+
+import (
+	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// execWhen evaluates the condition for executing the query against the
+// variables and the saved results. A query without a condition is always
+// executed.
+func execWhen(context interface{}, q *query.Query, vars map[string]string, data map[string]interface{}) bool {
+	w := q.When
+	if w == nil {
+		return true
+	}
+
+	var ok bool
+	switch {
+	case w.Var != "":
+		var value string
+		value, ok = vars[w.Var]
+		if ok && w.Equals != "" {
+			ok = value == w.Equals
+		}
+
+	case w.Data != "":
+
+		// A result that was not saved because it had no documents
+		// is empty.
+		size := savedSize(data[w.Data])
+
+		ok = true
+		if w.Empty != nil {
+			ok = ok && (size == 0) == *w.Empty
+		}
+		if w.MinSize != nil {
+			ok = ok && size >= *w.MinSize
+		}
+		if w.MaxSize != nil {
+			ok = ok && size <= *w.MaxSize
+		}
+	}
+
+	if w.Not {
+		ok = !ok
+	}
+
+	if !ok {
+		log.Dev(context, "execWhen", "Skipping : Query[%s]", q.Name)
+	}
+
+	return ok
+}
+
+// savedSize returns the number of documents in the saved result.
+func savedSize(saved interface{}) int {
+	switch v := saved.(type) {
+	case nil:
+		return 0
+	case []bson.M:
+		return len(v)
+	case []interface{}:
+		return len(v)
+	default:
+		return 1
+	}
+}
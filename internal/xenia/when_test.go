@@ -0,0 +1,57 @@
+package xenia
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/kit/tests"
+	"github.com/coralproject/shelf/internal/xenia/query"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestWhen tests evaluating the condition for executing a query.
+func TestWhen(t *testing.T) {
+	tests.ResetLog()
+	defer tests.DisplayLog()
+
+	yes := true
+	no := false
+	two := 2
+
+	vars := map[string]string{"station_id": "42021"}
+	data := map[string]interface{}{"list": []bson.M{{"a": 1}, {"a": 2}}}
+
+	conds := []struct {
+		name string
+		when *query.When
+		exec bool
+	}{
+		{"No Condition", nil, true},
+		{"Var Present", &query.When{Var: "station_id"}, true},
+		{"Var Missing", &query.When{Var: "limit"}, false},
+		{"Var Missing Not", &query.When{Var: "limit", Not: true}, true},
+		{"Var Equals", &query.When{Var: "station_id", Equals: "42021"}, true},
+		{"Var Not Equals", &query.When{Var: "station_id", Equals: "44008"}, false},
+		{"Data Not Empty", &query.When{Data: "list", Empty: &no}, true},
+		{"Data Empty", &query.When{Data: "list", Empty: &yes}, false},
+		{"Data Missing Empty", &query.When{Data: "other", Empty: &yes}, true},
+		{"Data Min Size", &query.When{Data: "list", MinSize: &two}, true},
+		{"Data Max Size", &query.When{Data: "list", MaxSize: &two}, true},
+		{"Data Over Min Size", &query.When{Data: "other", MinSize: &two}, false},
+	}
+
+	t.Log("Given the need to evaluate the condition for executing a query.")
+	{
+		for _, cond := range conds {
+			t.Logf("\tWhen using the %q condition", cond.name)
+			{
+				q := query.Query{Name: cond.name, When: cond.when}
+
+				if exec := execWhen(tests.Context, &q, vars, data); exec != cond.exec {
+					t.Errorf("\t%s\tShould get %v for executing the query.", tests.Failed, cond.exec)
+					continue
+				}
+				t.Logf("\t%s\tShould get %v for executing the query.", tests.Success, cond.exec)
+			}
+		}
+	}
+}
@@ -3,11 +3,20 @@
 package xenia
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ardanlabs/kit/db"
 	"github.com/ardanlabs/kit/log"
+	"github.com/coralproject/shelf/internal/xenia/acl"
+	"github.com/coralproject/shelf/internal/xenia/audit"
+	"github.com/coralproject/shelf/internal/xenia/cache"
 	"github.com/coralproject/shelf/internal/xenia/query"
 	"github.com/coralproject/shelf/internal/xenia/script"
 	"gopkg.in/mgo.v2/bson"
@@ -16,37 +25,93 @@ import (
 // docs represents what a user will receive after
 // excuting a successful set.
 type docs struct {
-	Name string
-	Docs []bson.M
+	Name    string
+	Docs    []bson.M
+	Next    string `json:",omitempty"`
+	Skipped bool   `json:",omitempty"`
 }
 
 // emptyResult is for returning empty runs.
 var emptyResult []docs
 
+// resultCache stores the results of sets with a cache policy. The
+// results are held in memory unless another cache is provided.
+var resultCache cache.Cache = cache.NewMemory()
+
+// UseCache replaces the cache used to store the results of sets. This
+// should be called during initialization before any sets are executed.
+func UseCache(c cache.Cache) {
+	resultCache = c
+}
+
+// PurgeCache removes all the cached results for the specified set.
+func PurgeCache(context interface{}, db *db.DB, name string) error {
+	return resultCache.Purge(context, db, name)
+}
+
 //==============================================================================
 
 // Exec executes the specified query set by name.
 func Exec(context interface{}, db *db.DB, set *query.Set, vars map[string]string) *query.Result {
-	log.Dev(context, "Exec", "Started : Name[%s]", set.Name)
-
-	// Validate the set that is provided.
-	if err := set.Validate(); err != nil {
-		return errResult(context, err, "Validated")
-	}
+	return ExecContext(noCancel, context, db, set, vars, false)
+}
 
-	// Is the rule enabled.
-	if !set.Enabled {
-		return errResult(context, errors.New("Set disabled"), "Enabled")
-	}
+// ExecContext executes the specified query set by name. When the ctx is
+// cancelled, the queries still running are killed on the server and the
+// set fails. When checked is true the variables were already processed by
+// CheckParams and are not processed again.
+func ExecContext(ctx context.Context, context interface{}, db *db.DB, set *query.Set, vars map[string]string, checked bool) *query.Result {
 
 	// If we have been provided a nil map, make one.
 	if vars == nil {
 		vars = make(map[string]string)
 	}
 
-	// Did we get everything we need. Also load defaults.
-	if err := processParams(context, db, set, vars); err != nil {
-		return errResult(context, err, "Process parameters")
+	// Record the execution in the audit log when it is sampled.
+	rec := sampleAudit(ctx, context, set)
+
+	r := execContext(ctx, context, db, set, vars, checked, rec)
+
+	if rec != nil {
+		writeAudit(context, db, set, vars, rec, r)
+	}
+
+	return r
+}
+
+// execContext executes the query set, adding the outcome of each query to
+// the audit record if there is one.
+func execContext(ctx context.Context, context interface{}, db *db.DB, set *query.Set, vars map[string]string, checked bool, rec *audit.Record) *query.Result {
+	log.Dev(context, "Exec", "Started : Name[%s]", set.Name)
+
+	// Validate the set and the variables we have been provided.
+	if msg, err := prepareSet(context, db, set, vars, checked); err != nil {
+		return errResult(context, err, msg)
+	}
+
+	// Return the cached results if the set has any.
+	var key string
+	if set.Cache != nil && !set.Explain && !set.DryRun {
+		key = cache.Key(set.Name, vars, cacheVars(set))
+
+		// The claims and policies of the caller can change the results so
+		// each caller has their own.
+		if caller := acl.FromContext(ctx); caller != nil {
+			key += "&caller=" + url.QueryEscape(caller.Subject)
+		}
+
+		if data, err := resultCache.Get(context, db, key); err == nil {
+			r := query.Result{
+				Results: json.RawMessage(data),
+			}
+
+			if rec != nil {
+				rec.Cached = true
+			}
+
+			log.Dev(context, "Exec", "Completed : CACHE : Key[%s]", key)
+			return &r
+		}
 	}
 
 	// Load the pre/post scripts.
@@ -54,54 +119,349 @@ func Exec(context interface{}, db *db.DB, set *query.Set, vars map[string]string
 		return errResult(context, err, "Loading Pre/Post scripts")
 	}
 
+	// Apply the limits of the set to the execution.
+	ctx, cancel, lmts := withLimits(ctx, set)
+	defer cancel()
+
+	// Execute the queries of the set.
+	results, commands, err := execQueries(context, db, set, vars, execOpts{ctx: ctx, explain: set.Explain, dryRun: set.DryRun, limits: lmts, sets: []string{set.Name}, types: paramTypes(set), caller: acl.FromContext(ctx), audit: rec})
+	if err != nil {
+
+		// We need to return an error result with the commands.
+		r := query.Result{
+			Results: bson.M{"error": err.Error(), "commands": commands},
+		}
+
+		log.Error(context, "errResult", err, "Completed : Executing Result")
+		return &r
+	}
+
+	// Cache the results if the set has a cache policy.
+	if key != "" {
+		cacheResults(context, db, set, key, results)
+	}
+
+	// Setup the result we will return.
+	r := query.Result{
+		Results: results,
+	}
+
+	log.Dev(context, "Exec", "Completed")
+	return &r
+}
+
+// execQueries executes the queries of the set in waves and returns the
+// results of the queries marked to return them. If a query fails, the other
+// queries of its wave are cancelled and the error is returned with the
+// commands of the query.
+func execQueries(context interface{}, db *db.DB, set *query.Set, vars map[string]string, opts execOpts) ([]docs, []map[string]interface{}, error) {
+
 	// Hold any data we have been asked to save.
 	data := make(map[string]interface{})
 
-	// Final results of running the set of queries.
-	var results []docs
+	// Hold the outcome of executing each query.
+	outcomes := make([]outcome, len(set.Queries))
 
-	// Iterate over the set of queries.
-	for _, q := range set.Queries {
-		var result docs
-		var commands []map[string]interface{}
-		var err error
+	// Iterate over the waves of queries. The queries within a wave have
+	// no dependencies on each other so they are executed concurrently.
+	for _, wave := range queryWaves(set.Queries) {
+		var wg sync.WaitGroup
+		wg.Add(len(wave))
 
-		// We only have pipeline right now.
-		switch strings.ToLower(q.Type) {
-		case "pipeline":
-			result, commands, err = execPipeline(context, db, &q, vars, data, set.Explain)
-		}
+		// A query failing cancels the other queries of the wave.
+		wctx, cancel := waveContext(opts.ctx)
 
-		// Was there an error processing the query.
+		// Each query of the wave gets its own session so the timeouts it
+		// sets don't change the session of the other queries. Without
+		// sessions of their own the queries are executed one at a time.
+		qdbs, err := copyDBs(context, db, len(wave))
 		if err != nil {
+			log.Dev(context, "execQueries", "Executing the wave one query at a time : %v", err)
+		}
+
+		for j, i := range wave {
+			i := i
+			q := set.Queries[i]
+
+			// Each query gets its own copy of the saved data so
+			// results can be saved without synchronization.
+			saved := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				saved[k] = v
+			}
+
+			qdb := db
+			if qdbs != nil {
+				qdb = qdbs[j]
+			}
 
-			// Were we told to continue to the next one.
-			if q.Continue {
+			exec := func() {
+				defer wg.Done()
+
+				qopts := opts
+				qopts.ctx = wctx
+
+				start := time.Now()
+				result, commands, err := execQuery(context, qdb, &q, vars, saved, qopts)
+				outcomes[i] = outcome{result: result, commands: commands, saved: saved, err: err, duration: time.Since(start)}
+
+				if err != nil {
+					outcomes[i].cancelled = wctx.Err() != nil && opts.ctx.Err() == nil
+					if !q.Continue {
+						cancel()
+					}
+				}
+			}
+
+			if qdbs == nil {
+				exec()
 				continue
 			}
 
-			// We need to return an error result with the commands.
-			r := query.Result{
-				Results: bson.M{"error": err.Error(), "commands": commands},
+			go exec()
+		}
+
+		wg.Wait()
+		cancel()
+		closeDBs(context, qdbs)
+
+		// Review the outcomes in the order of the queries.
+		for _, i := range wave {
+			o := outcomes[i]
+
+			// Add the outcome of the query to the audit record.
+			if opts.audit != nil {
+				opts.audit.Queries = append(opts.audit.Queries, auditQuery(set.Queries[i].Name, o))
 			}
 
-			log.Error(context, "errResult", err, "Completed : Executing Result")
-			return &r
+			// Was there an error processing the query.
+			if o.err != nil {
+
+				// Were we told to continue to the next one. A query
+				// cancelled by the failure of another query of the
+				// wave leaves the error of that query to be returned.
+				if set.Queries[i].Continue || o.cancelled {
+					continue
+				}
+
+				return nil, o.commands, o.err
+			}
+
+			// Keep any results the query saved for the next wave.
+			for k, v := range o.saved {
+				data[k] = v
+			}
 		}
+	}
 
-		// Append these results to the final set.
-		if q.Return {
-			results = append(results, result)
+	// Final results of running the set of queries.
+	var results []docs
+
+	// Append the results to the final set in the order of the queries.
+	for i, q := range set.Queries {
+		if q.Return && outcomes[i].err == nil {
+			results = append(results, outcomes[i].result)
 		}
 	}
 
-	// Setup the result we will return.
-	r := query.Result{
-		Results: results,
+	return results, nil, nil
+}
+
+// waveContext returns the context for executing the queries of a wave. The
+// context is cancelled once a query of the wave fails.
+func waveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(ctx)
+}
+
+// copyDBs returns a DB with a session of its own for each of the n queries
+// of a wave to execute them concurrently. Nil is returned for a wave of a
+// single query since it can use the DB of the set.
+func copyDBs(context interface{}, sdb *db.DB, n int) ([]*db.DB, error) {
+	if n < 2 {
+		return nil, nil
 	}
 
-	log.Dev(context, "Exec", "Completed")
-	return &r
+	dbs := make([]*db.DB, 0, n)
+	for i := 0; i < n; i++ {
+		cdb, err := copyDB(context, sdb)
+		if err != nil {
+			closeDBs(context, dbs)
+			return nil, err
+		}
+		dbs = append(dbs, cdb)
+	}
+
+	return dbs, nil
+}
+
+// copyDB returns a DB with a session of its own for the database of the DB.
+// Master sessions are registered under the name of their database by
+// convention.
+func copyDB(context interface{}, sdb *db.DB) (*db.DB, error) {
+	c, err := sdb.CollectionMGO(context, "")
+	if err != nil {
+		return nil, err
+	}
+
+	cdb, err := db.NewMGO(context, c.Database.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the master session is for the same database.
+	if cc, err := cdb.CollectionMGO(context, ""); err != nil || cc.Database.Name != c.Database.Name {
+		cdb.CloseMGO(context)
+		return nil, fmt.Errorf("No master session for database %q", c.Database.Name)
+	}
+
+	return cdb, nil
+}
+
+// closeDBs releases the sessions of the DBs.
+func closeDBs(context interface{}, dbs []*db.DB) {
+	for _, cdb := range dbs {
+		cdb.CloseMGO(context)
+	}
+}
+
+// prepareSet validates the set is ready to be executed and processes the
+// variables against the set parameters, unless they were already checked.
+// On failure, the step that failed is returned with the error.
+func prepareSet(context interface{}, db *db.DB, set *query.Set, vars map[string]string, checked bool) (string, error) {
+
+	// Validate the set that is provided.
+	if err := set.Validate(); err != nil {
+		return "Validated", err
+	}
+
+	// Is the rule enabled.
+	if !set.Enabled {
+		return "Enabled", errors.New("Set disabled")
+	}
+
+	// Did we get everything we need. Also load defaults.
+	if checked {
+		return "", nil
+	}
+
+	if err := processParams(context, db, set, vars); err != nil {
+		return "Process parameters", err
+	}
+
+	return "", nil
+}
+
+// emitFunc is called with each document a query returns when the results
+// of a set are being streamed.
+type emitFunc func(doc bson.M) error
+
+// execOpts contains the options for executing the queries of a set.
+type execOpts struct {
+	ctx     context.Context   // Cancels the queries still running.
+	explain bool              // Return the explain output instead of the results.
+	dryRun  bool              // Return the final commands instead of executing them.
+	emit    emitFunc          // Stream the documents to this function as they are read.
+	limits  *limits           // Limits of the set the documents are checked against.
+	sets    []string          // Names of the sets being executed, outermost first.
+	types   map[string]string // Declared types of the variables.
+	caller  *acl.Caller       // Caller executing the set, nil when authentication is off.
+	audit   *audit.Record     // Audit record of the execution, nil when it is not sampled.
+	noVars  bool              // The variables are already substituted in the commands.
+}
+
+// claims returns the claims of the caller executing the set.
+func (opts execOpts) claims() map[string]interface{} {
+	if opts.caller == nil {
+		return nil
+	}
+
+	return opts.caller.Claims
+}
+
+// outcome contains the outcome of executing a single query.
+type outcome struct {
+	result   docs
+	commands []map[string]interface{}
+	saved    map[string]interface{}
+	err      error
+	duration time.Duration
+
+	cancelled bool // The query was cancelled since another query of its wave failed.
+}
+
+// execQuery executes the query based on its type.
+func execQuery(context interface{}, db *db.DB, q *query.Query, vars map[string]string, data map[string]interface{}, opts execOpts) (docs, []map[string]interface{}, error) {
+
+	// Skip the query if its condition is false. The saved results are
+	// not known during a dry run so the query is never skipped for them.
+	dryRunData := opts.dryRun && q.When != nil && q.When.Data != ""
+	if !dryRunData && !execWhen(context, q, vars, data) {
+		return docs{Name: q.Name, Docs: []bson.M{}, Skipped: true}, q.Commands, nil
+	}
+
+	// Sets may not read the collections of xenia itself.
+	if err := checkReserved(context, q.Collection, nil); err != nil {
+		return docs{}, q.Commands, err
+	}
+
+	switch strings.ToLower(q.Type) {
+	case query.TypePipeline:
+		return execPipeline(context, db, q, vars, data, opts)
+
+	case query.TypeFind:
+		return execFind(context, db, q, vars, data, opts)
+
+	case query.TypeCount:
+		return execCount(context, db, q, vars, data, opts)
+
+	case query.TypeDistinct:
+		return execDistinct(context, db, q, vars, data, opts)
+
+	case query.TypeTemplate:
+		return execTemplate(context, db, q, vars, data, opts)
+
+	case query.TypeSet:
+		return execSet(context, db, q, vars, data, opts)
+	}
+
+	return docs{}, q.Commands, fmt.Errorf("Invalid query type %q", q.Type)
+}
+
+// cacheVars returns the variables that form the cache key for the set. The
+// page token variables are always part of the key.
+func cacheVars(set *query.Set) []string {
+	if len(set.Cache.Vars) == 0 {
+		return nil
+	}
+
+	names := append([]string{}, set.Cache.Vars...)
+	for _, q := range set.Queries {
+		if q.Page != nil {
+			names = append(names, q.Page.TokenVar())
+		}
+	}
+
+	return names
+}
+
+// cacheResults stores the results of the set in the cache. Failing to cache
+// the results does not fail the execution of the set.
+func cacheResults(context interface{}, db *db.DB, set *query.Set, key string, results []docs) {
+	ttl, err := set.Cache.Duration()
+	if err != nil {
+		log.Error(context, "cacheResults", err, "Parsing ttl")
+		return
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		log.Error(context, "cacheResults", err, "Marshaling results")
+		return
+	}
+
+	if err := resultCache.Set(context, db, set.Name, key, data, ttl); err != nil {
+		log.Error(context, "cacheResults", err, "Storing results")
+	}
 }
 
 // errResult creates a result value with the error.
@@ -137,18 +497,61 @@ func loadPrePostScripts(context interface{}, db *db.DB, set *query.Set) error {
 		return err
 	}
 
-	// Add the commands to the query scripts. Since order of the
-	// pre/post scripts is maintained, this is simplified.
+	// Add the commands to the query scripts. Each query gets its own copy
+	// of the script commands since variable substitution changes them.
 	for i := range set.Queries {
+
+		// Set queries only hold the command to run the other set.
+		if set.Queries[i].Type == query.TypeSet {
+			continue
+		}
+
+		var commands []map[string]interface{}
+
 		if set.PreScript != "" {
-			scripts[0].Commands = append(scripts[0].Commands, set.Queries[i].Commands...)
-			set.Queries[i].Commands = scripts[0].Commands
+			commands = append(commands, copyDocs(scripts[0].Commands)...)
 		}
 
+		commands = append(commands, set.Queries[i].Commands...)
+
 		if set.PstScript != "" {
-			set.Queries[i].Commands = append(set.Queries[i].Commands, scripts[1].Commands...)
+			commands = append(commands, copyDocs(scripts[1].Commands)...)
 		}
+
+		set.Queries[i].Commands = commands
 	}
 
 	return nil
 }
+
+// copyDocs performs a deep copy of the documents.
+func copyDocs(docs []map[string]interface{}) []map[string]interface{} {
+	cpy := make([]map[string]interface{}, len(docs))
+	for i := range docs {
+		cpy[i] = copyValue(docs[i]).(map[string]interface{})
+	}
+
+	return cpy
+}
+
+// copyValue performs a deep copy of documents and arrays within the value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		doc := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			doc[key] = copyValue(value)
+		}
+		return doc
+
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i := range v {
+			array[i] = copyValue(v[i])
+		}
+		return array
+
+	default:
+		return v
+	}
+}
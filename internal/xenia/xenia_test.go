@@ -49,6 +49,9 @@ func TestExecuteSet(t *testing.T) {
 	}{
 		{typ: "Positive", set: getPosExecSet()},
 		{typ: "Negative", set: getNegExecSet()},
+		{typ: "Find", set: getFindExecSet()},
+		{typ: "Count", set: getCountExecSet()},
+		{typ: "Template", set: getTemplateExecSet()},
 	}
 
 	db, err := db.NewMGO(tests.Context, tests.TestSession)